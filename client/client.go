@@ -0,0 +1,209 @@
+// Package client is a typed Go client for the SlackLite REST and WebSocket
+// API, for tools, bots and integration tests that talk to a running server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Channel is a chat channel
+type Channel struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	CreatedAt       time.Time `json:"created_at"`
+	SlowModeSeconds int       `json:"slow_mode_seconds"`
+	ReadOnly        bool      `json:"read_only"`
+	Topic           string    `json:"topic,omitempty"`
+}
+
+// Message is a message in a channel
+type Message struct {
+	ID        string            `json:"id"`
+	ChannelID string            `json:"channel_id"`
+	Content   string            `json:"content"`
+	Author    string            `json:"author"`
+	ParentID  string            `json:"parent_id,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	EditedAt  *time.Time        `json:"edited_at,omitempty"`
+	IsBot     bool              `json:"is_bot,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Subtype is how the message should be rendered, such as "system" for
+	// notices of channel events; empty for ordinary messages
+	Subtype string `json:"subtype,omitempty"`
+}
+
+// MessagePage is one page of a channel's messages
+type MessagePage struct {
+	Messages []Message `json:"messages"`
+	Page     int       `json:"page,omitempty"`
+	Limit    int       `json:"limit"`
+	Total    int       `json:"total"`
+
+	// NextCursor fetches the following page when passed as
+	// ListMessagesOptions.Cursor; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListMessagesOptions narrows ListMessages. The zero value asks for the
+// server's default first page, oldest first.
+type ListMessagesOptions struct {
+	Page   int
+	Limit  int
+	Cursor string
+	// Desc lists newest first
+	Desc bool
+	// Author lists only that author's messages
+	Author string
+	// After and Before list only messages created strictly between them
+	After  time.Time
+	Before time.Time
+	// Contains lists only messages containing this text, ignoring ASCII case
+	Contains string
+}
+
+// Client talks to one SlackLite server. Its fields may be changed before
+// first use.
+type Client struct {
+	baseURL string
+
+	// HTTPClient makes REST requests
+	HTTPClient *http.Client
+
+	// WSPath is the server's WebSocket path, as reported by /api/config
+	WSPath string
+
+	// BotToken, if set, is sent as "Authorization: Bot <token>" on every
+	// request and WebSocket connection, so the client may post as its bot
+	BotToken string
+}
+
+// NewClient returns a client for the server at baseURL, such as
+// "http://localhost:8080"
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		WSPath:     "/ws",
+	}
+}
+
+// ListChannels returns every channel
+func (c *Client) ListChannels(ctx context.Context) ([]Channel, error) {
+	var channels []Channel
+	err := c.do(ctx, http.MethodGet, "/api/channels", nil, &channels)
+	return channels, err
+}
+
+// CreateChannel creates a channel with the given name
+func (c *Client) CreateChannel(ctx context.Context, name string) (*Channel, error) {
+	var channel Channel
+	if err := c.do(ctx, http.MethodPost, "/api/channels", map[string]string{"name": name}, &channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// ListMessages returns a page of a channel's messages. opts may be nil.
+func (c *Client) ListMessages(ctx context.Context, channelID string, opts *ListMessagesOptions) (*MessagePage, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Page > 0 {
+			query.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.Limit > 0 {
+			query.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.Cursor != "" {
+			query.Set("cursor", opts.Cursor)
+		}
+		if opts.Desc {
+			query.Set("order", "desc")
+		}
+		if opts.Author != "" {
+			query.Set("author", opts.Author)
+		}
+		if !opts.After.IsZero() {
+			query.Set("after", opts.After.Format(time.RFC3339Nano))
+		}
+		if !opts.Before.IsZero() {
+			query.Set("before", opts.Before.Format(time.RFC3339Nano))
+		}
+		if opts.Contains != "" {
+			query.Set("contains", opts.Contains)
+		}
+	}
+
+	path := "/api/channels/" + url.PathEscape(channelID) + "/messages"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page MessagePage
+	if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SendMessage posts a message to a channel as author
+func (c *Client) SendMessage(ctx context.Context, channelID, author, content string) (*Message, error) {
+	body := map[string]string{"author": author, "content": content}
+
+	var message Message
+	if err := c.do(ctx, http.MethodPost, "/api/channels/"+url.PathEscape(channelID)+"/messages", body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// do sends a REST request with body encoded as JSON, if not nil, and decodes
+// a successful response into out. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	c.authorize(req.Header)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// authorize adds the bot token, if any, to request headers
+func (c *Client) authorize(header http.Header) {
+	if c.BotToken != "" {
+		header.Set("Authorization", "Bot "+c.BotToken)
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBody caps how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// Errors that an *Error matches, by status code, with errors.Is
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("unavailable")
+)
+
+// statusErrors maps response statuses to the errors above
+var statusErrors = map[int]error{
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusConflict:           ErrConflict,
+	http.StatusTooManyRequests:    ErrRateLimited,
+	http.StatusServiceUnavailable: ErrUnavailable,
+}
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+
+	// Message is the server's explanation, such as "Channel not found"
+	Message string
+
+	// Limit names the limit that was hit, for rate-limited requests
+	Limit string
+
+	// RetryAfter is how long to wait before retrying, for rate-limited
+	// requests
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("slacklite: %d %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether target is the sentinel error for e's status code
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// rateLimitedBody is the JSON body of a 429 response
+type rateLimitedBody struct {
+	Error             string `json:"error"`
+	Limit             string `json:"limit"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// decodeError builds an *Error from a non-2xx response. Most errors are
+// plain text; rate-limit errors are JSON.
+func decodeError(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		return err
+	}
+
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		var limited rateLimitedBody
+		if json.Unmarshal(body, &limited) == nil && limited.Error != "" {
+			apiErr.Message = limited.Error
+			apiErr.Limit = limited.Limit
+			if limited.RetryAfterSeconds > 0 {
+				apiErr.RetryAfter = time.Duration(limited.RetryAfterSeconds) * time.Second
+			}
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
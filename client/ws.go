@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reconnect backoff bounds for SubscribeWS
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// wsFrame is the part of an inbound frame SubscribeWS reads. Message frames
+// carry the message's fields at the top level; the ready frame carries the
+// session ID used to resume after a reconnect.
+type wsFrame struct {
+	Type    string `json:"type"`
+	Session string `json:"session"`
+	AfterMS int64  `json:"after_ms"`
+	Message
+}
+
+// SubscribeWS connects to a channel over WebSocket and returns the messages
+// posted to it, including thread replies the client is sent. The first
+// connection is made before returning, so a missing channel or a rate limit
+// is reported as an *Error.
+//
+// Dropped connections are retried with exponential backoff, resuming the
+// server-side session. When the server says how long to wait before
+// reconnecting, as it does when shutting down, that wait is used instead. Messages posted while disconnected are not replayed;
+// fetch them with ListMessages if they matter. The returned channel is
+// closed when ctx is done, or when the server closes the connection for
+// good, such as when the channel is deleted or the bot token is rejected.
+func (c *Client) SubscribeWS(ctx context.Context, channelID string) (<-chan Message, error) {
+	conn, err := c.dialWS(ctx, url.Values{"channel": {channelID}})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Message)
+	go c.runSubscription(ctx, conn, channelID, out)
+	return out, nil
+}
+
+// runSubscription reads messages into out, reconnecting until ctx is done or
+// the server closes the connection for good
+func (c *Client) runSubscription(ctx context.Context, conn *websocket.Conn, channelID string, out chan<- Message) {
+	defer close(out)
+
+	var session string
+	delay := minReconnectDelay
+	for {
+		var after time.Duration
+		err := readMessages(ctx, conn, &session, &after, out)
+		conn.Close()
+		if ctx.Err() != nil || isFinalClose(err) {
+			return
+		}
+		if after > 0 {
+			delay = after
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxReconnectDelay)
+
+			query := url.Values{"channel": {channelID}}
+			if session != "" {
+				query.Set("session", session)
+			}
+			if conn, err = c.dialWS(ctx, query); err == nil {
+				delay = minReconnectDelay
+				break
+			}
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+				return
+			}
+		}
+	}
+}
+
+// readMessages reads frames from conn until it fails or ctx is done, sending
+// message frames to out and recording the session from the ready frame and
+// the requested delay from a reconnect frame
+func readMessages(ctx context.Context, conn *websocket.Conn, session *string, after *time.Duration, out chan<- Message) error {
+	// Closing the connection is the only way to interrupt a blocked read
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var frame wsFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			return err
+		}
+		switch frame.Type {
+		case "ready":
+			*session = frame.Session
+		case "reconnect":
+			*after = time.Duration(frame.AfterMS) * time.Millisecond
+		case "message", "thread_reply":
+			select {
+			case out <- frame.Message:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// isFinalClose reports whether the server closed the connection in a way
+// that reconnecting won't fix
+func isFinalClose(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.ClosePolicyViolation)
+}
+
+// dialWS opens a WebSocket connection with the given query. A failed
+// handshake is returned as *Error when the server sent a response.
+func (c *Client) dialWS(ctx context.Context, query url.Values) (*websocket.Conn, error) {
+	wsURL := c.baseURL + c.WSPath + "?" + query.Encode()
+	if rest, ok := strings.CutPrefix(wsURL, "http"); ok {
+		wsURL = "ws" + rest
+	}
+
+	header := http.Header{}
+	c.authorize(header)
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil && errors.Is(err, websocket.ErrBadHandshake) {
+			defer resp.Body.Close()
+			return nil, decodeError(resp)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
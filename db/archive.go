@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// archiveWhere matches the messages ArchiveOldMessages moves: those in a
+// channel created before the cutoff, except pinned ones
+const archiveWhere = "channel_id = ? AND created_at < ? AND id NOT IN (SELECT message_id FROM pins)"
+
+// ArchiveOldMessages moves a channel's messages created before cutoff from
+// messages to archived_messages, in one transaction, keeping the table that
+// every read and write touches small. Pinned messages stay where they are.
+// The reactions, flags, link previews and refs of archived messages are
+// deleted. It returns how many messages were moved, or ErrChannelNotFound
+// if the channel does not exist. Audit entries are recorded in the same
+// transaction.
+func (db *DB) ArchiveOldMessages(channelID string, cutoff time.Time, audit ...AuditEntry) (int64, error) {
+	var archived int64
+	err := db.withTx(func(tx *sql.Tx) error {
+		if err := requireChannel(tx, channelID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			"INSERT INTO archived_messages ("+messageTableColumns+") SELECT "+messageTableColumns+" FROM messages WHERE "+archiveWhere,
+			channelID, cutoff.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		if archived, err = deleteLiveMessagesWhere(tx, archiveWhere, channelID, cutoff.UTC()); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+	return archived, err
+}
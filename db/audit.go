@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AuditEntry records one administrative action. Target is the ID of the
+// channel or message acted on; Detail is free text such as the old and new
+// name of a renamed channel.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// insertAudit records audit entries. It must run inside the transaction that
+// performs the audited action, so an action is never stored without its
+// entry or the other way round.
+func insertAudit(tx *sql.Tx, entries []AuditEntry) error {
+	for _, e := range entries {
+		_, err := tx.Exec(
+			"INSERT INTO audit_log (actor, action, target, detail, created_at) VALUES (?, ?, ?, ?, ?)",
+			e.Actor, e.Action, e.Target, e.Detail, e.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAudit returns one page of audit entries, newest first, along with how
+// many there are in total. An empty action matches every action.
+func (db *DB) ListAudit(action string, limit, offset int) ([]AuditEntry, int, error) {
+	where, args := "", []any{}
+	if action != "" {
+		where, args = " WHERE action = ?", append(args, action)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(
+		"SELECT id, actor, action, target, detail, created_at FROM audit_log"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListMessagesAfterCursorPagesThroughTies(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	// A batch shares one timestamp, as InsertMessages gives it
+	var all []Message
+	for range 5 {
+		all = append(all, insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "batch", CreatedAt: testTime}))
+	}
+	all = append(all, insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "bob", Content: "later", CreatedAt: testTime.Add(time.Nanosecond)}))
+
+	for _, reverse := range []bool{false, true} {
+		want := messageIDs(all)
+		if reverse {
+			slices.Reverse(want)
+		}
+
+		var got []string
+		filter := MessageFilter{Reverse: reverse}
+		for range len(all) {
+			page, err := database.ListMessagesAfterCursor(channel.ID, filter, 2)
+			if err != nil {
+				t.Fatalf("ListMessagesAfterCursor: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			got = append(got, messageIDs(page)...)
+			last := page[len(page)-1]
+			// Cursors come back from clients in whatever zone they were
+			// decoded in
+			filter.Cursor = &Cursor{CreatedAt: last.CreatedAt.In(time.FixedZone("", -7*3600)), ID: last.ID}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("reverse=%t: paged %v, want %v", reverse, got, want)
+		}
+	}
+}
+
+func TestListMessagesAfterCursorAppliesFilter(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	alice1 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "one", CreatedAt: testTime})
+	insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "bob", Content: "two", CreatedAt: testTime.Add(time.Second)})
+	alice2 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "three", CreatedAt: testTime.Add(2 * time.Second)})
+	alice3 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "four", CreatedAt: testTime.Add(3 * time.Second)})
+
+	filter := MessageFilter{Author: "alice", Cursor: &Cursor{CreatedAt: alice1.CreatedAt, ID: alice1.ID}}
+	got, err := database.ListMessagesAfterCursor(channel.ID, filter, 10)
+	if err != nil {
+		t.Fatalf("ListMessagesAfterCursor: %v", err)
+	}
+	if want := []string{alice2.ID, alice3.ID}; !slices.Equal(messageIDs(got), want) {
+		t.Errorf("ListMessagesAfterCursor = %v, want %v", messageIDs(got), want)
+	}
+
+	n, err := database.CountMessages(channel.ID, filter)
+	if err != nil {
+		t.Fatalf("CountMessages: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("CountMessages = %d, want 2", n)
+	}
+}
@@ -3,9 +3,11 @@ package db
 import (
 	"database/sql"
 	"embed"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -15,71 +17,309 @@ var schemaFS embed.FS
 // DB wraps the SQL database connection
 type DB struct {
 	*sql.DB
+
+	// timer is set when Options.TimeQueries is on
+	timer *queryTimer
+
+	ids *idGenerator
 }
 
 // Channel represents a chat channel
 type Channel struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	CreatedAt       time.Time `json:"created_at"`
+	SlowModeSeconds int       `json:"slow_mode_seconds"`
+	ReadOnly        bool      `json:"read_only"`
+	Topic           string    `json:"topic"`
+}
+
+// channelColumns selects a full Channel, in the order expected by channelFields
+const channelColumns = "id, name, created_at, slow_mode_seconds, read_only, topic"
+
+// channelFields returns scan destinations matching channelColumns
+func channelFields(c *Channel) []any {
+	return []any{&c.ID, &c.Name, &c.CreatedAt, &c.SlowModeSeconds, &c.ReadOnly, &c.Topic}
+}
+
+// ChannelUpdate holds the channel fields to change; nil fields are left as they are
+type ChannelUpdate struct {
+	Name            *string
+	Topic           *string
+	SlowModeSeconds *int
+	ReadOnly        *bool
 }
 
 // Message represents a chat message
 type Message struct {
+	ID        string     `json:"id"`
+	ChannelID string     `json:"channel_id"`
+	Author    string     `json:"author"`
+	Content   string     `json:"content"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Hidden    bool       `json:"hidden,omitempty"`
+	IsBot     bool       `json:"is_bot,omitempty"`
+	Metadata  Metadata   `json:"metadata,omitempty"`
+	Subtype   string     `json:"subtype,omitempty"`
+}
+
+// Message subtypes tell clients how to render a message; the empty subtype
+// is an ordinary message from a user. SubtypeSystem and SubtypeJoin are
+// notices the server posts about channel events, and don't count towards
+// NewMessage.IfEmpty.
+const (
+	SubtypeSystem = "system"
+	SubtypeJoin   = "join"
+	SubtypeAction = "action"
+	SubtypeBot    = "bot"
+)
+
+// NewMessage holds the caller-supplied fields of a message to create
+type NewMessage struct {
+	ChannelID string
+	Author    string
+	Content   string
+	ParentID  string
+	IsBot     bool
+	Refs      []Ref
+	Metadata  Metadata
+	Subtype   string
+
+	// IfEmpty makes the insert fail with ErrChannelNotEmpty unless the
+	// channel has no messages other than notices, checked in the same
+	// transaction
+	IfEmpty bool
+}
+
+// messageColumns selects a full Message from the messages table aliased as m,
+// in the order expected by messageFields
+const messageColumns = "m.id, m.channel_id, m.author, m.content, m.parent_id, m.created_at, m.edited_at, m.hidden, m.is_bot, m.metadata, m.subtype"
+
+// messageTableColumns names the columns that messages and archived_messages
+// share, in a fixed order, since migrations may have left the messages
+// table's own column order differing from schema.sql
+const messageTableColumns = "id, channel_id, author, content, parent_id, created_at, edited_at, hidden, is_bot, metadata, subtype"
+
+// messageFields returns scan destinations matching messageColumns
+func messageFields(m *Message) []any {
+	return []any{&m.ID, &m.ChannelID, &m.Author, &m.Content, &m.ParentID, &m.CreatedAt, &m.EditedAt, &m.Hidden, &m.IsBot, &m.Metadata, &m.Subtype}
+}
+
+// AuthorMessage is a message annotated with the name of its channel
+type AuthorMessage struct {
+	Message
+	ChannelName string `json:"channel_name"`
+}
+
+// Flag is a report that a message breaks the rules
+type Flag struct {
 	ID        string    `json:"id"`
-	ChannelID string    `json:"channel_id"`
-	Author    string    `json:"author"`
-	Content   string    `json:"content"`
+	MessageID string    `json:"message_id"`
+	Reporter  string    `json:"reporter"`
+	Reason    string    `json:"reason"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// InitDB initializes the database and creates tables
+// FlaggedMessage is a flag together with the message it refers to
+type FlaggedMessage struct {
+	Flag
+	Message Message `json:"message"`
+}
+
+// ChannelActivity is a channel with its message count over some window
+type ChannelActivity struct {
+	Channel
+	MessageCount int `json:"message_count"`
+}
+
+// RecentChannel is a channel with when an author last posted in it
+type RecentChannel struct {
+	Channel
+	LastPostedAt time.Time `json:"last_posted_at"`
+}
+
+// Options tunes how the SQLite database is opened
+type Options struct {
+	// JournalMode is the SQLite journal mode. WAL lets readers proceed while
+	// a write is in progress.
+	JournalMode string
+
+	// Synchronous is the SQLite synchronous level. NORMAL is safe with WAL and
+	// avoids an fsync on every commit.
+	Synchronous string
+
+	// BusyTimeout is how long a connection waits on a lock before SQLite
+	// returns SQLITE_BUSY
+	BusyTimeout time.Duration
+
+	// MaxOpenConns caps the connection pool. SQLite allows only one writer
+	// at a time, so extra connections just contend for the write lock and
+	// surface as busy errors; a single connection serializes access in Go
+	// instead. Raise it only for read-heavy workloads in WAL mode.
+	MaxOpenConns int
+
+	// TimeQueries logs every statement's SQL and duration through slog at
+	// debug level and totals them for QueryTime. Argument values are never
+	// logged.
+	TimeQueries bool
+
+	// IDScheme is how IDs for new rows are generated; see IDScheme for the
+	// tradeoffs. Empty means IDUUIDv7.
+	IDScheme IDScheme
+
+	// CreateDirs creates the database file's parent directories if they
+	// don't exist, instead of failing with ErrDirNotFound
+	CreateDirs bool
+}
+
+// DefaultOptions returns the recommended settings for the demo's mixed
+// WebSocket and REST load
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:  "WAL",
+		Synchronous:  "NORMAL",
+		BusyTimeout:  5 * time.Second,
+		MaxOpenConns: 1,
+		IDScheme:     IDUUIDv7,
+	}
+}
+
+// InitDB initializes the database with DefaultOptions and creates tables
 func InitDB(dbPath string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
-	if err != nil {
+	return InitDBWithOptions(dbPath, DefaultOptions())
+}
+
+// InitDBWithOptions initializes the database and creates tables
+func InitDBWithOptions(dbPath string, opts Options) (*DB, error) {
+	if err := prepareDir(dbPath, opts.CreateDirs); err != nil {
 		return nil, err
 	}
 
+	// Pragmas are set in the DSN so they apply to every pooled connection,
+	// not just the first one
+	dsn := fmt.Sprintf(
+		"%s?_foreign_keys=on&_journal_mode=%s&_synchronous=%s&_busy_timeout=%d",
+		dbPath, opts.JournalMode, opts.Synchronous, opts.BusyTimeout.Milliseconds(),
+	)
+	var timer *queryTimer
+	var sqlDB *sql.DB
+	if opts.TimeQueries {
+		timer = &queryTimer{}
+		sqlDB = sql.OpenDB(&timingConnector{dsn: dsn, timer: timer})
+	} else {
+		var err error
+		if sqlDB, err = sql.Open("sqlite3", dsn); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+
+	// Migrations run first so that schema.sql can index columns they add
+	if err := migrate(sqlDB); err != nil {
+		return nil, openError(dbPath, err)
+	}
+
 	schema, err := schemaFS.ReadFile("schema.sql")
 	if err != nil {
 		return nil, err
 	}
 
 	if _, err := sqlDB.Exec(string(schema)); err != nil {
-		return nil, err
+		return nil, openError(dbPath, err)
 	}
 
-	return &DB{sqlDB}, nil
+	scheme := opts.IDScheme
+	if scheme == "" {
+		scheme = IDUUIDv7
+	}
+	ids, err := newIDGenerator(sqlDB, scheme)
+	if err != nil {
+		return nil, openError(dbPath, err)
+	}
+
+	return &DB{DB: sqlDB, timer: timer, ids: ids}, nil
 }
 
-// CreateChannel creates a new channel
-func (db *DB) CreateChannel(name string) (*Channel, error) {
+// withTx runs fn inside a transaction, committing if it returns nil and
+// rolling back otherwise. The whole transaction is retried if SQLite reports
+// the database as busy, so fn must not have side effects outside tx.
+func (db *DB) withTx(fn func(tx *sql.Tx) error) error {
+	return retryBusy(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// CreateChannel creates a new channel, recording audit entries in the same
+// transaction. Entries with no Target are given the new channel's ID.
+func (db *DB) CreateChannel(name string, audit ...AuditEntry) (*Channel, error) {
+	channel, _, err := db.CreateChannelWithMessages(name, nil, audit...)
+	return channel, err
+}
+
+// CreateChannelWithMessages creates a new channel as CreateChannel does and
+// inserts messages into it in the same transaction, so the channel is never
+// seen without them. The messages' ChannelID is ignored.
+func (db *DB) CreateChannelWithMessages(name string, ms []NewMessage, audit ...AuditEntry) (*Channel, []Message, error) {
+	now := time.Now()
 	channel := &Channel{
-		ID:        uuid.New().String(),
+		ID:        db.newID(),
 		Name:      name,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
+	}
+	for i := range audit {
+		if audit[i].Target == "" {
+			audit[i].Target = channel.ID
+		}
+	}
+	messages := make([]Message, len(ms))
+	for i, m := range ms {
+		m.ChannelID = channel.ID
+		messages[i] = db.newMessage(m, now)
 	}
 
-	_, err := db.Exec(
-		"INSERT INTO channels (id, name, created_at) VALUES (?, ?, ?)",
-		channel.ID, channel.Name, channel.CreatedAt,
-	)
+	err := db.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO channels (id, name, created_at) VALUES (?, ?, ?)",
+			channel.ID, channel.Name, channel.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		for i, m := range ms {
+			if err := insertMessage(tx, messages[i], m.Refs, false); err != nil {
+				return err
+			}
+		}
+		return insertAudit(tx, audit)
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, translateError(err)
 	}
 
-	return channel, nil
+	return channel, messages, nil
 }
 
 // GetChannel retrieves a channel by ID
 func (db *DB) GetChannel(id string) (*Channel, error) {
 	channel := &Channel{}
 	err := db.QueryRow(
-		"SELECT id, name, created_at FROM channels WHERE id = ?",
+		"SELECT "+channelColumns+" FROM channels WHERE id = ?",
 		id,
-	).Scan(&channel.ID, &channel.Name, &channel.CreatedAt)
+	).Scan(channelFields(channel)...)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return channel, nil
 }
@@ -88,18 +328,18 @@ func (db *DB) GetChannel(id string) (*Channel, error) {
 func (db *DB) GetChannelByName(name string) (*Channel, error) {
 	channel := &Channel{}
 	err := db.QueryRow(
-		"SELECT id, name, created_at FROM channels WHERE name = ?",
+		"SELECT "+channelColumns+" FROM channels WHERE name = ?",
 		name,
-	).Scan(&channel.ID, &channel.Name, &channel.CreatedAt)
+	).Scan(channelFields(channel)...)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return channel, nil
 }
 
 // ListChannels returns all channels
 func (db *DB) ListChannels() ([]Channel, error) {
-	rows, err := db.Query("SELECT id, name, created_at FROM channels ORDER BY name")
+	rows, err := db.Query("SELECT " + channelColumns + " FROM channels ORDER BY name")
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +348,34 @@ func (db *DB) ListChannels() ([]Channel, error) {
 	var channels []Channel
 	for rows.Next() {
 		var c Channel
-		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt); err != nil {
+		if err := rows.Scan(channelFields(&c)...); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// likeEscaper escapes LIKE wildcards so a pattern matches them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListChannelsByPrefix returns up to limit channels whose name starts with
+// prefix, ignoring ASCII case, ordered by name. The LIKE is served by
+// idx_channels_name_nocase.
+func (db *DB) ListChannelsByPrefix(prefix string, limit int) ([]Channel, error) {
+	rows, err := db.Query(
+		"SELECT "+channelColumns+` FROM channels WHERE name LIKE ? ESCAPE '\' ORDER BY name COLLATE NOCASE LIMIT ?`,
+		likeEscaper.Replace(prefix)+"%", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []Channel{}
+	for rows.Next() {
+		var c Channel
+		if err := rows.Scan(channelFields(&c)...); err != nil {
 			return nil, err
 		}
 		channels = append(channels, c)
@@ -116,50 +383,320 @@ func (db *DB) ListChannels() ([]Channel, error) {
 	return channels, rows.Err()
 }
 
-// DeleteChannel deletes a channel by ID
+// UpdateChannel sets the non-nil fields of u in a single statement, recording
+// audit entries in the same transaction. It returns ErrNotFound if the
+// channel does not exist and ErrDuplicate if the new name is already in use.
+func (db *DB) UpdateChannel(id string, u ChannelUpdate, audit ...AuditEntry) error {
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	if u.Name != nil {
+		set("name", *u.Name)
+	}
+	if u.Topic != nil {
+		set("topic", *u.Topic)
+	}
+	if u.SlowModeSeconds != nil {
+		set("slow_mode_seconds", *u.SlowModeSeconds)
+	}
+	if u.ReadOnly != nil {
+		set("read_only", *u.ReadOnly)
+	}
+	if len(sets) == 0 {
+		_, err := db.GetChannel(id)
+		return err
+	}
+
+	args = append(args, id)
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := requireRow(tx.Exec("UPDATE channels SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...)); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+}
+
+// TrendingChannels returns channels ranked by the number of visible messages
+// posted since the given time, busiest first. Notices don't count.
+func (db *DB) TrendingChannels(since time.Time, limit int) ([]ChannelActivity, error) {
+	rows, err := db.Query(
+		`SELECT c.id, c.name, c.created_at, c.slow_mode_seconds, c.read_only, c.topic, COUNT(*) AS recent
+		FROM messages m JOIN channels c ON c.id = m.channel_id
+		WHERE m.created_at > ? AND m.hidden = 0 AND m.subtype NOT IN (?, ?)
+		GROUP BY c.id ORDER BY recent DESC, c.name ASC LIMIT ?`,
+		since.UTC(), SubtypeSystem, SubtypeJoin, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []ChannelActivity
+	for rows.Next() {
+		var c ChannelActivity
+		if err := rows.Scan(append(channelFields(&c.Channel), &c.MessageCount)...); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// RecentChannelsByAuthor returns the channels an author has posted visible
+// messages in, most recently posted in first, ignoring notices
+func (db *DB) RecentChannelsByAuthor(author string, limit int) ([]RecentChannel, error) {
+	// With MAX, SQLite takes the bare m.created_at from the row holding the
+	// maximum
+	rows, err := db.Query(
+		`SELECT c.id, c.name, c.created_at, c.slow_mode_seconds, c.read_only, c.topic, m.created_at, MAX(m.created_at) AS last
+		FROM messages m JOIN channels c ON c.id = m.channel_id
+		WHERE m.author = ? AND m.hidden = 0 AND m.subtype NOT IN (?, ?)
+		GROUP BY c.id ORDER BY last DESC, c.name ASC LIMIT ?`,
+		author, SubtypeSystem, SubtypeJoin, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []RecentChannel{}
+	for rows.Next() {
+		var c RecentChannel
+		var last string
+		if err := rows.Scan(append(channelFields(&c.Channel), &c.LastPostedAt, &last)...); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// DeleteChannel deletes a channel by ID, returning ErrNotFound if it does not exist
 func (db *DB) DeleteChannel(id string) error {
-	_, err := db.Exec("DELETE FROM channels WHERE id = ?", id)
+	return requireRow(db.execRetry("DELETE FROM channels WHERE id = ?", id))
+}
+
+// messageDependents lists the tables whose rows refer to a message by
+// message_id, cleared before the messages themselves are deleted
+var messageDependents = []string{"pins", "flags", "unfurls", "reactions", "message_refs"}
+
+// deleteMessagesWhere deletes the messages matching where, archived ones
+// included, and the rows in messageDependents that refer to them, returning
+// how many messages were deleted. It must run inside a transaction.
+func deleteMessagesWhere(tx *sql.Tx, where string, args ...any) (int64, error) {
+	res, err := tx.Exec("DELETE FROM archived_messages WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := deleteLiveMessagesWhere(tx, where, args...)
+	return archived + deleted, err
+}
+
+// deleteLiveMessagesWhere deletes the messages matching where from the
+// messages table only, and the rows in messageDependents that refer to them.
+// It must run inside a transaction.
+func deleteLiveMessagesWhere(tx *sql.Tx, where string, args ...any) (int64, error) {
+	for _, table := range messageDependents {
+		stmt := "DELETE FROM " + table + " WHERE message_id IN (SELECT id FROM messages WHERE " + where + ")"
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM messages WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// requireChannel returns ErrChannelNotFound unless the channel exists
+func requireChannel(tx *sql.Tx, channelID string) error {
+	var exists int
+	err := tx.QueryRow("SELECT 1 FROM channels WHERE id = ?", channelID).Scan(&exists)
+	if err = translateError(err); errors.Is(err, ErrNotFound) {
+		return ErrChannelNotFound
+	}
 	return err
 }
 
-// CreateMessage creates a new message in a channel
+// DeleteChannelCascade deletes a channel and everything that belongs to it
+// in a single transaction, so a failure never leaves partial state behind.
+// It records audit entries in the same transaction, and returns ErrNotFound
+// if the channel does not exist.
+func (db *DB) DeleteChannelCascade(id string, audit ...AuditEntry) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		if _, err := deleteMessagesWhere(tx, "channel_id = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM drafts WHERE channel_id = ?", id); err != nil {
+			return err
+		}
+
+		if err := requireRow(tx.Exec("DELETE FROM channels WHERE id = ?", id)); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+}
+
+// DeleteAllMessages deletes every message in a channel, along with the rows
+// in messageDependents that refer to them, and records audit entries, in a
+// single transaction. It returns the number of messages deleted, or
+// ErrChannelNotFound if the channel does not exist.
+func (db *DB) DeleteAllMessages(channelID string, audit ...AuditEntry) (int64, error) {
+	var deleted int64
+	err := db.withTx(func(tx *sql.Tx) error {
+		if err := requireChannel(tx, channelID); err != nil {
+			return err
+		}
+
+		var err error
+		if deleted, err = deleteMessagesWhere(tx, "channel_id = ?", channelID); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+	return deleted, err
+}
+
+// DeleteMessagesByAuthor deletes every message an author posted in a
+// channel, hidden ones included, along with the rows in messageDependents
+// that refer to them, and records audit entries, in a single transaction. It
+// returns the number of messages deleted, or ErrChannelNotFound if the
+// channel does not exist.
+func (db *DB) DeleteMessagesByAuthor(channelID, author string, audit ...AuditEntry) (int64, error) {
+	var deleted int64
+	err := db.withTx(func(tx *sql.Tx) error {
+		if err := requireChannel(tx, channelID); err != nil {
+			return err
+		}
+
+		var err error
+		if deleted, err = deleteMessagesWhere(tx, "channel_id = ? AND author = ?", channelID, author); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+	return deleted, err
+}
+
+// CreateMessage creates a new message in a channel, returning
+// ErrChannelNotFound if the channel does not exist
 func (db *DB) CreateMessage(channelID, author, content string) (*Message, error) {
-	msg := &Message{
-		ID:        uuid.New().String(),
-		ChannelID: channelID,
-		Author:    author,
-		Content:   content,
-		CreatedAt: time.Now(),
+	return db.InsertMessage(NewMessage{ChannelID: channelID, Author: author, Content: content})
+}
+
+// InsertMessage creates a message from the given fields, returning
+// ErrChannelNotFound if the channel does not exist and ErrChannelNotEmpty if
+// m.IfEmpty is set and the channel already has messages
+func (db *DB) InsertMessage(m NewMessage) (*Message, error) {
+	messages, err := db.InsertMessages([]NewMessage{m})
+	if err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// InsertMessages creates messages from the given fields in a single
+// transaction, so either all of them are stored or none are. It returns
+// ErrChannelNotFound if any channel does not exist and ErrChannelNotEmpty if
+// any has IfEmpty set and its channel already has messages.
+func (db *DB) InsertMessages(ms []NewMessage) ([]Message, error) {
+	now := time.Now()
+	messages := make([]Message, len(ms))
+	for i, m := range ms {
+		messages[i] = db.newMessage(m, now)
 	}
 
-	_, err := db.Exec(
-		"INSERT INTO messages (id, channel_id, author, content, created_at) VALUES (?, ?, ?, ?, ?)",
-		msg.ID, msg.ChannelID, msg.Author, msg.Content, msg.CreatedAt,
-	)
+	err := db.withTx(func(tx *sql.Tx) error {
+		for i, m := range ms {
+			if err := insertMessage(tx, messages[i], m.Refs, m.IfEmpty); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
+		if err = translateError(err); errors.Is(err, ErrNotFound) {
+			return nil, ErrChannelNotFound
+		}
 		return nil, err
 	}
 
-	return msg, nil
+	return messages, nil
+}
+
+// newMessage builds the row for m with a new ID, created at now
+func (db *DB) newMessage(m NewMessage, now time.Time) Message {
+	return Message{
+		ID:        db.newID(),
+		ChannelID: m.ChannelID,
+		Author:    m.Author,
+		Content:   m.Content,
+		ParentID:  m.ParentID,
+		IsBot:     m.IsBot,
+		Metadata:  m.Metadata,
+		Subtype:   m.Subtype,
+		CreatedAt: now,
+	}
+}
+
+// insertMessage inserts msg and its refs, first checking the channel is
+// empty if ifEmpty is set. It must run inside a transaction.
+//
+// created_at is stored in UTC whatever the server's zone, so that the
+// stored text sorts and compares as the instant it records, to the
+// nanosecond, and queries can range over idx_messages_channel_created.
+func insertMessage(tx *sql.Tx, msg Message, refs []Ref, ifEmpty bool) error {
+	if ifEmpty {
+		var hasMessages bool
+		if err := tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM messages WHERE channel_id = ? AND subtype NOT IN (?, ?))",
+			msg.ChannelID, SubtypeSystem, SubtypeJoin,
+		).Scan(&hasMessages); err != nil {
+			return err
+		}
+		if hasMessages {
+			return ErrChannelNotEmpty
+		}
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO messages (id, channel_id, author, content, parent_id, is_bot, metadata, subtype, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		msg.ID, msg.ChannelID, msg.Author, msg.Content, msg.ParentID, msg.IsBot, msg.Metadata, msg.Subtype, msg.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return insertRefs(tx, msg.ID, refs)
 }
 
 // GetMessage retrieves a message by ID
 func (db *DB) GetMessage(id string) (*Message, error) {
 	msg := &Message{}
 	err := db.QueryRow(
-		"SELECT id, channel_id, author, content, created_at FROM messages WHERE id = ?",
+		"SELECT "+messageColumns+" FROM messages m WHERE m.id = ?",
 		id,
-	).Scan(&msg.ID, &msg.ChannelID, &msg.Author, &msg.Content, &msg.CreatedAt)
+	).Scan(messageFields(msg)...)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	return msg, nil
 }
 
-// ListMessages returns messages for a channel, ordered by creation time
+// ListMessages returns visible messages for a channel, ordered by creation time
 func (db *DB) ListMessages(channelID string, limit int) ([]Message, error) {
 	rows, err := db.Query(
-		"SELECT id, channel_id, author, content, created_at FROM messages WHERE channel_id = ? ORDER BY created_at ASC LIMIT ?",
+		"SELECT "+messageColumns+" FROM messages m WHERE m.channel_id = ? AND m.hidden = 0 ORDER BY m.created_at ASC LIMIT ?",
 		channelID, limit,
 	)
 	if err != nil {
@@ -170,7 +707,95 @@ func (db *DB) ListMessages(channelID string, limit int) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var m Message
-		if err := rows.Scan(&m.ID, &m.ChannelID, &m.Author, &m.Content, &m.CreatedAt); err != nil {
+		if err := rows.Scan(messageFields(&m)...); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// ListMessagesAfterCursor returns up to limit of a channel's messages
+// matching filter, from filter.Cursor onwards (or from the start without
+// one), ordered by creation time and then ID. With filter.Reverse set it
+// returns newest first. Resuming from the last message's position visits
+// every match exactly once, even among messages sharing a timestamp.
+func (db *DB) ListMessagesAfterCursor(channelID string, filter MessageFilter, limit int) ([]Message, error) {
+	order := "ASC"
+	if filter.Reverse {
+		order = "DESC"
+	}
+	where, args := filter.where(channelID)
+	rows, err := db.Query(
+		"SELECT "+messageColumns+" FROM "+filter.from()+" m WHERE "+where+
+			" ORDER BY m.created_at "+order+", m.id "+order+" LIMIT ?",
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(messageFields(&m)...); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// ListAllMessages returns every message in a channel, including hidden ones,
+// ordered by creation time and then ID
+func (db *DB) ListAllMessages(channelID string) ([]Message, error) {
+	rows, err := db.Query(
+		"SELECT "+messageColumns+" FROM messages m WHERE m.channel_id = ? ORDER BY m.created_at ASC, m.id ASC",
+		channelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(messageFields(&m)...); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// EditMessage replaces a message's content and records when it was edited,
+// returning ErrNotFound if the message does not exist
+func (db *DB) EditMessage(id, content string, editedAt time.Time) error {
+	return requireRow(db.execRetry(
+		"UPDATE messages SET content = ?, edited_at = ? WHERE id = ?",
+		content, editedAt, id,
+	))
+}
+
+// ListMessagesByAuthor returns visible messages by an author across all channels, newest first
+func (db *DB) ListMessagesByAuthor(author string, limit, offset int) ([]AuthorMessage, error) {
+	rows, err := db.Query(
+		`SELECT `+messageColumns+`, c.name
+		FROM messages m JOIN channels c ON c.id = m.channel_id
+		WHERE m.author = ? AND m.hidden = 0 ORDER BY m.created_at DESC, m.id DESC LIMIT ? OFFSET ?`,
+		author, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []AuthorMessage
+	for rows.Next() {
+		var m AuthorMessage
+		if err := rows.Scan(append(messageFields(&m.Message), &m.ChannelName)...); err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
@@ -178,8 +803,168 @@ func (db *DB) ListMessages(channelID string, limit int) ([]Message, error) {
 	return messages, rows.Err()
 }
 
-// DeleteMessage deletes a message by ID
+// CountMessagesByAuthor returns how many messages ListMessagesByAuthor can
+// page through for an author
+func (db *DB) CountMessagesByAuthor(author string) (int, error) {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM messages m JOIN channels c ON c.id = m.channel_id
+		WHERE m.author = ? AND m.hidden = 0`,
+		author,
+	).Scan(&n)
+	return n, err
+}
+
+// SetMessageHidden hides or unhides a message. Hidden messages are kept for
+// audit purposes but excluded from ListMessages. Audit entries are recorded
+// in the same transaction. It returns ErrNotFound if the message does not
+// exist.
+func (db *DB) SetMessageHidden(id string, hidden bool, audit ...AuditEntry) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := requireRow(tx.Exec("UPDATE messages SET hidden = ? WHERE id = ?", hidden, id)); err != nil {
+			return err
+		}
+		return insertAudit(tx, audit)
+	})
+}
+
+// DeleteMessage deletes a message by ID, returning ErrNotFound if it does not exist
 func (db *DB) DeleteMessage(id string) error {
-	_, err := db.Exec("DELETE FROM messages WHERE id = ?", id)
-	return err
+	return requireRow(db.execRetry("DELETE FROM messages WHERE id = ?", id))
+}
+
+// FlagMessage records a report against a message. A reporter may flag a
+// given message only once; repeats return ErrDuplicate.
+func (db *DB) FlagMessage(messageID, reporter, reason string) (*Flag, error) {
+	flag := &Flag{
+		ID:        db.newID(),
+		MessageID: messageID,
+		Reporter:  reporter,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := db.execRetry(
+		"INSERT INTO flags (id, message_id, reporter, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+		flag.ID, flag.MessageID, flag.Reporter, flag.Reason, flag.CreatedAt,
+	)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return flag, nil
+}
+
+// CountFlags returns how many reports have been made against a message
+func (db *DB) CountFlags(messageID string) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM flags WHERE message_id = ?", messageID).Scan(&n)
+	return n, err
+}
+
+// ListFlags returns all reports with their flagged messages, oldest first
+func (db *DB) ListFlags() ([]FlaggedMessage, error) {
+	rows, err := db.Query(
+		`SELECT f.id, f.message_id, f.reporter, f.reason, f.created_at, ` + messageColumns + `
+		FROM flags f JOIN messages m ON m.id = f.message_id
+		ORDER BY f.created_at ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []FlaggedMessage
+	for rows.Next() {
+		var f FlaggedMessage
+		dest := append([]any{&f.ID, &f.MessageID, &f.Reporter, &f.Reason, &f.CreatedAt}, messageFields(&f.Message)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// ErrNotPinned is returned when reordering pins with an ID that isn't pinned
+var ErrNotPinned = errors.New("message is not pinned in this channel")
+
+// PinMessage pins a message at the end of its channel's pin list. It returns
+// ErrDuplicate if the message is already pinned.
+func (db *DB) PinMessage(channelID, messageID string) error {
+	_, err := db.execRetry(
+		`INSERT INTO pins (channel_id, message_id, position, pinned_at)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM pins WHERE channel_id = ?), ?)`,
+		channelID, messageID, channelID, time.Now(),
+	)
+	return translateError(err)
+}
+
+// UnpinMessage removes a message from its channel's pin list, returning
+// ErrNotFound if it was not pinned
+func (db *DB) UnpinMessage(channelID, messageID string) error {
+	return requireRow(db.execRetry("DELETE FROM pins WHERE channel_id = ? AND message_id = ?", channelID, messageID))
+}
+
+// ListPinned returns a channel's pinned messages in position order
+func (db *DB) ListPinned(channelID string) ([]Message, error) {
+	rows, err := db.Query(
+		`SELECT `+messageColumns+`
+		FROM pins p JOIN messages m ON m.id = p.message_id
+		WHERE p.channel_id = ? ORDER BY p.position ASC`,
+		channelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(messageFields(&m)...); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// ReorderPins sets the position of each pinned message to its index in
+// messageIDs. Every ID must currently be pinned in the channel and every pin
+// must be listed, otherwise ErrNotPinned is returned and nothing changes.
+func (db *DB) ReorderPins(channelID string, messageIDs []string) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pins WHERE channel_id = ?", channelID).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(messageIDs) {
+			return ErrNotPinned
+		}
+
+		seen := make(map[string]bool, len(messageIDs))
+		for i, id := range messageIDs {
+			if seen[id] {
+				return ErrNotPinned
+			}
+			seen[id] = true
+
+			res, err := tx.Exec(
+				"UPDATE pins SET position = ? WHERE channel_id = ? AND message_id = ?",
+				i, channelID, id,
+			)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrNotPinned
+			}
+		}
+		return nil
+	})
 }
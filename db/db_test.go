@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDB opens a fresh database in a temporary directory, closed when the
+// test ends
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// newTestChannel creates a channel with the given name
+func newTestChannel(t *testing.T, database *DB, name string) *Channel {
+	t.Helper()
+	channel, err := database.CreateChannel(name)
+	if err != nil {
+		t.Fatalf("CreateChannel(%q): %v", name, err)
+	}
+	return channel
+}
+
+// insertTestMessage stores msg as given, created_at included, filling in an
+// ID if it has none
+func insertTestMessage(t *testing.T, database *DB, msg Message) Message {
+	t.Helper()
+	if msg.ID == "" {
+		msg.ID = database.newID()
+	}
+	err := database.withTx(func(tx *sql.Tx) error {
+		return insertMessage(tx, msg, nil, false)
+	})
+	if err != nil {
+		t.Fatalf("insertMessage(%q): %v", msg.Content, err)
+	}
+	return msg
+}
+
+// messageIDs returns the IDs of messages, in order
+func messageIDs(messages []Message) []string {
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// testTime is a fixed instant with a nanosecond part that julianday()
+// would round away
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
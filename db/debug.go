@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// queryTimer accumulates how long statements take when Options.TimeQueries
+// is set, logging each one at debug level
+type queryTimer struct {
+	total atomic.Int64
+}
+
+// record adds one statement's duration. Only the SQL text is logged, never
+// the bound arguments, since those can hold message content.
+func (t *queryTimer) record(query string, d time.Duration) {
+	t.total.Add(int64(d))
+	slog.Debug("sql query", "query", strings.Join(strings.Fields(query), " "), "duration", d)
+}
+
+// QueryTime returns the total time spent running statements since the
+// database was opened, or zero if Options.TimeQueries is off
+func (db *DB) QueryTime() time.Duration {
+	if db.timer == nil {
+		return 0
+	}
+	return time.Duration(db.timer.total.Load())
+}
+
+// timingConnector opens SQLite connections that report to a queryTimer
+type timingConnector struct {
+	dsn   string
+	timer *queryTimer
+}
+
+// Connect opens a new timed connection
+func (c *timingConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timingConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), timer: c.timer}, nil
+}
+
+// Driver returns the underlying SQLite driver
+func (c *timingConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// timingConn times statements run directly on the connection, which is how
+// database/sql runs every Exec and Query in this package, transactions
+// included
+type timingConn struct {
+	*sqlite3.SQLiteConn
+	timer *queryTimer
+}
+
+// ExecContext runs a statement and records its duration
+func (c *timingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	c.timer.record(query, time.Since(start))
+	return res, err
+}
+
+// QueryContext starts a query whose duration is recorded when its rows close
+func (c *timingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		c.timer.record(query, time.Since(start))
+		return nil, err
+	}
+	return &timingRows{Rows: rows, query: query, timer: c.timer, elapsed: time.Since(start)}, nil
+}
+
+// BeginTx starts a transaction whose commit or rollback is also timed
+func (c *timingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	c.timer.record("BEGIN", time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	return &timingTx{Tx: tx, timer: c.timer}, nil
+}
+
+// timingTx times the end of a transaction, where SQLite writes it out
+type timingTx struct {
+	driver.Tx
+	timer *queryTimer
+}
+
+// Commit commits the transaction and records how long it took
+func (t *timingTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.timer.record("COMMIT", time.Since(start))
+	return err
+}
+
+// Rollback rolls the transaction back and records how long it took
+func (t *timingTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.timer.record("ROLLBACK", time.Since(start))
+	return err
+}
+
+// timingRows adds the time spent stepping through results, where SQLite does
+// most of a query's work, and records the total when the rows are closed
+type timingRows struct {
+	driver.Rows
+	query   string
+	timer   *queryTimer
+	elapsed time.Duration
+}
+
+// Next reads the next row, adding the time taken to the query
+func (r *timingRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := r.Rows.Next(dest)
+	r.elapsed += time.Since(start)
+	return err
+}
+
+// Close closes the rows and records the query's total duration
+func (r *timingRows) Close() error {
+	err := r.Rows.Close()
+	r.timer.record(r.query, r.elapsed)
+	return err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// Draft is an unsent message an author is composing in a channel
+type Draft struct {
+	ChannelID string    `json:"channel_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveDraft creates or replaces an author's draft in a channel, returning
+// ErrChannelNotFound if the channel does not exist
+func (db *DB) SaveDraft(channelID, author, content string) (*Draft, error) {
+	draft := &Draft{
+		ChannelID: channelID,
+		Author:    author,
+		Content:   content,
+		UpdatedAt: time.Now(),
+	}
+
+	_, err := db.execRetry(
+		`INSERT INTO drafts (channel_id, author, content, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, author) DO UPDATE SET content = excluded.content, updated_at = excluded.updated_at`,
+		draft.ChannelID, draft.Author, draft.Content, draft.UpdatedAt,
+	)
+	if err != nil {
+		if err = translateError(err); errors.Is(err, ErrNotFound) {
+			return nil, ErrChannelNotFound
+		}
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+// DeleteDraft removes an author's draft in a channel. Deleting a draft that
+// does not exist is not an error.
+func (db *DB) DeleteDraft(channelID, author string) error {
+	_, err := db.execRetry("DELETE FROM drafts WHERE channel_id = ? AND author = ?", channelID, author)
+	return translateError(err)
+}
+
+// ListDrafts returns every saved draft
+func (db *DB) ListDrafts() ([]Draft, error) {
+	rows, err := db.Query("SELECT channel_id, author, content, updated_at FROM drafts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		var d Draft
+		if err := rows.Scan(&d.ChannelID, &d.Author, &d.Content, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
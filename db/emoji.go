@@ -0,0 +1,43 @@
+package db
+
+import "time"
+
+// CustomEmoji is an image registered under a name, for use as a reaction
+type CustomEmoji struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddCustomEmoji registers an emoji image under name, returning
+// ErrDuplicate if the name is taken
+func (db *DB) AddCustomEmoji(name, url string) (*CustomEmoji, error) {
+	emoji := &CustomEmoji{Name: name, URL: url, CreatedAt: time.Now()}
+	_, err := db.execRetry(
+		"INSERT INTO custom_emoji (name, url, created_at) VALUES (?, ?, ?)",
+		emoji.Name, emoji.URL, emoji.CreatedAt,
+	)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return emoji, nil
+}
+
+// ListCustomEmoji returns every custom emoji, by name
+func (db *DB) ListCustomEmoji() ([]CustomEmoji, error) {
+	rows, err := db.Query("SELECT name, url, created_at FROM custom_emoji ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emoji []CustomEmoji
+	for rows.Next() {
+		var e CustomEmoji
+		if err := rows.Scan(&e.Name, &e.URL, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		emoji = append(emoji, e)
+	}
+	return emoji, rows.Err()
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Typed errors returned by DB methods. Callers should compare with errors.Is.
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrChannelNotFound is returned when a write refers to a channel that
+	// does not exist. It also matches ErrNotFound.
+	ErrChannelNotFound = fmt.Errorf("channel %w", ErrNotFound)
+
+	// ErrDuplicate is returned when a write violates a UNIQUE or PRIMARY KEY constraint
+	ErrDuplicate = errors.New("already exists")
+
+	// ErrChannelNotEmpty is returned by conditional inserts that require an
+	// empty channel
+	ErrChannelNotEmpty = errors.New("channel is not empty")
+
+	// ErrUsernameTaken is returned when a username matches an existing one,
+	// ignoring case. It also matches ErrDuplicate.
+	ErrUsernameTaken = fmt.Errorf("username %w", ErrDuplicate)
+
+	// ErrInvalidMessage is returned when a write would break one of the
+	// schema's CHECK constraints on messages. The errors below say which,
+	// and each also matches ErrInvalidMessage.
+	ErrInvalidMessage = errors.New("invalid message")
+	ErrContentEmpty   = fmt.Errorf("%w: content is empty", ErrInvalidMessage)
+	ErrContentTooLong = fmt.Errorf("%w: content exceeds %d characters", ErrInvalidMessage, MaxContentLength)
+	ErrAuthorEmpty    = fmt.Errorf("%w: author is empty", ErrInvalidMessage)
+
+	// ErrReactionLimit is returned by ToggleReaction when adding a reaction
+	// would break one of its ReactionLimits. The errors below say which, and
+	// each also matches ErrReactionLimit.
+	ErrReactionLimit    = errors.New("reaction limit reached")
+	ErrTooManyEmoji     = fmt.Errorf("%w: message has the most different reactions allowed", ErrReactionLimit)
+	ErrTooManyReactions = fmt.Errorf("%w: author has added the most reactions allowed to this message", ErrReactionLimit)
+
+	// Errors returned by InitDB when the database file can't be opened,
+	// wrapped with its path
+	ErrDirNotFound = errors.New("directory does not exist")
+	ErrPermission  = errors.New("permission denied")
+	ErrLocked      = errors.New("database is locked by another process")
+	ErrNotDatabase = errors.New("file is not a SQLite database")
+)
+
+// MaxContentLength is the longest message content the schema accepts, in
+// characters. Handlers may set a lower limit but not a higher one.
+const MaxContentLength = 4000
+
+// checkErrors maps the schema's named CHECK constraints to typed errors
+var checkErrors = map[string]error{
+	"messages_content_not_empty":  ErrContentEmpty,
+	"messages_content_max_length": ErrContentTooLong,
+	"messages_author_not_empty":   ErrAuthorEmpty,
+}
+
+// translateError maps driver errors onto the package's typed errors, leaving
+// anything it doesn't recognize unchanged
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: %v", ErrDuplicate, err)
+		case sqlite3.ErrConstraintForeignKey:
+			return fmt.Errorf("%w: %v", ErrNotFound, err)
+		case sqlite3.ErrConstraintCheck:
+			// SQLite names the failed constraint after this prefix
+			name := strings.TrimPrefix(sqliteErr.Error(), "CHECK constraint failed: ")
+			if typed, ok := checkErrors[name]; ok {
+				return typed
+			}
+		}
+	}
+	return err
+}
+
+// requireRow checks the result of an UPDATE or DELETE, returning ErrNotFound
+// if it matched no rows
+func requireRow(res sql.Result, err error) error {
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	t.Run("message in missing channel", func(t *testing.T) {
+		_, err := database.CreateMessage("no-such-channel", "alice", "hi")
+		if !errors.Is(err, ErrChannelNotFound) {
+			t.Errorf("CreateMessage = %v, want ErrChannelNotFound", err)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("CreateMessage = %v, want it to match ErrNotFound too", err)
+		}
+	})
+
+	t.Run("missing message", func(t *testing.T) {
+		if _, err := database.GetMessage("no-such-message"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMessage = %v, want ErrNotFound", err)
+		}
+		if err := database.DeleteMessage("no-such-message"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteMessage = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("duplicate channel name", func(t *testing.T) {
+		if _, err := database.CreateChannel(channel.Name); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("CreateChannel = %v, want ErrDuplicate", err)
+		}
+	})
+
+	t.Run("duplicate flag", func(t *testing.T) {
+		msg, err := database.CreateMessage(channel.ID, "alice", "spam")
+		if err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+		if _, err := database.FlagMessage(msg.ID, "bob", "spam"); err != nil {
+			t.Fatalf("FlagMessage: %v", err)
+		}
+		if _, err := database.FlagMessage(msg.ID, "bob", "spam"); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("second FlagMessage = %v, want ErrDuplicate", err)
+		}
+	})
+
+	t.Run("channel not empty", func(t *testing.T) {
+		if _, err := database.CreateMessage(channel.ID, "alice", "first"); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+		_, err := database.InsertMessage(NewMessage{ChannelID: channel.ID, Author: "bot", Content: "intro", IfEmpty: true})
+		if !errors.Is(err, ErrChannelNotEmpty) {
+			t.Errorf("InsertMessage with IfEmpty = %v, want ErrChannelNotEmpty", err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Cursor is a position in a channel's timeline, which is ordered by creation
+// time and then ID, so a position is unambiguous even among messages that
+// share a timestamp
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// MessageFilter narrows QueryMessages and CountMessages. Zero fields don't filter, and set
+// fields combine with AND.
+type MessageFilter struct {
+	// Author matches messages posted by exactly this author
+	Author string
+
+	// After and Before match messages created strictly after or before them
+	After  time.Time
+	Before time.Time
+
+	// Contains matches messages whose content includes this text, ignoring
+	// ASCII case as LIKE does
+	Contains string
+
+	// IncludeHidden also matches messages hidden by moderation
+	IncludeHidden bool
+
+	// IncludeArchived also matches messages moved to archived_messages by
+	// ArchiveOldMessages
+	IncludeArchived bool
+
+	// Cursor matches messages that come after it in the timeline, or before
+	// it when Reverse is set
+	Cursor  *Cursor
+	Reverse bool
+}
+
+// from returns the table or subquery that filter's messages are read from,
+// to be aliased m
+func (filter MessageFilter) from() string {
+	if !filter.IncludeArchived {
+		return "messages"
+	}
+	return "(SELECT " + messageTableColumns + " FROM messages UNION ALL SELECT " + messageTableColumns + " FROM archived_messages)"
+}
+
+// where returns the WHERE clause matching a channel's messages that pass the
+// filter, and its args. The clause is assembled from fixed conditions with
+// every value bound as a placeholder, so filter values never reach the SQL.
+func (filter MessageFilter) where(channelID string) (string, []any) {
+	where := []string{"m.channel_id = ?"}
+	args := []any{channelID}
+	if !filter.IncludeHidden {
+		where = append(where, "m.hidden = 0")
+	}
+	if filter.Author != "" {
+		where, args = append(where, "m.author = ?"), append(args, filter.Author)
+	}
+	// Stored timestamps are UTC text, so bounds given in UTC compare exactly
+	// as text, to the nanosecond, where julianday() would round to the
+	// millisecond
+	if !filter.After.IsZero() {
+		where, args = append(where, "m.created_at > ?"), append(args, filter.After.UTC())
+	}
+	if !filter.Before.IsZero() {
+		where, args = append(where, "m.created_at < ?"), append(args, filter.Before.UTC())
+	}
+	if filter.Cursor != nil {
+		cmp := ">"
+		if filter.Reverse {
+			cmp = "<"
+		}
+		where = append(where, "(m.created_at, m.id) "+cmp+" (?, ?)")
+		args = append(args, filter.Cursor.CreatedAt.UTC(), filter.Cursor.ID)
+	}
+	if filter.Contains != "" {
+		where = append(where, `m.content LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(filter.Contains)+"%")
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// QueryMessages returns a channel's messages matching filter, ordered by
+// creation time and then ID
+func (db *DB) QueryMessages(channelID string, filter MessageFilter) ([]Message, error) {
+	where, args := filter.where(channelID)
+	rows, err := db.Query(
+		"SELECT "+messageColumns+" FROM "+filter.from()+" m WHERE "+where+" ORDER BY m.created_at ASC, m.id ASC",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(messageFields(&m)...); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// CountMessages returns how many of a channel's messages match filter
+func (db *DB) CountMessages(channelID string, filter MessageFilter) (int, error) {
+	where, args := filter.where(channelID)
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM "+filter.from()+" m WHERE "+where, args...).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryMessagesFilters(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+	other := newTestChannel(t, database, "random")
+
+	at := func(d time.Duration) time.Time { return testTime.Add(d) }
+	alice1 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "Deploy started", CreatedAt: at(0)})
+	bob1 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "bob", Content: "deploy looks good", CreatedAt: at(time.Minute)})
+	alice2 := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "lunch?", CreatedAt: at(2 * time.Minute)})
+	hidden := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "deploy spam", CreatedAt: at(3 * time.Minute)})
+	insertTestMessage(t, database, Message{ChannelID: other.ID, Author: "alice", Content: "deploy elsewhere", CreatedAt: at(time.Minute)})
+	if err := database.SetMessageHidden(hidden.ID, true); err != nil {
+		t.Fatalf("SetMessageHidden: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter MessageFilter
+		want   []Message
+	}{
+		{"none", MessageFilter{}, []Message{alice1, bob1, alice2}},
+		{"include hidden", MessageFilter{IncludeHidden: true}, []Message{alice1, bob1, alice2, hidden}},
+		{"author", MessageFilter{Author: "alice"}, []Message{alice1, alice2}},
+		{"after", MessageFilter{After: at(0)}, []Message{bob1, alice2}},
+		{"before", MessageFilter{Before: at(2 * time.Minute)}, []Message{alice1, bob1}},
+		{"after and before", MessageFilter{After: at(0), Before: at(2 * time.Minute)}, []Message{bob1}},
+		{"contains ignores case", MessageFilter{Contains: "DEPLOY"}, []Message{alice1, bob1}},
+		{"author and contains", MessageFilter{Author: "alice", Contains: "deploy"}, []Message{alice1}},
+		{"all combined", MessageFilter{Author: "bob", After: at(-time.Second), Before: at(time.Hour), Contains: "good"}, []Message{bob1}},
+		{"no match", MessageFilter{Author: "carol"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.QueryMessages(channel.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("QueryMessages: %v", err)
+			}
+			if !slices.Equal(messageIDs(got), messageIDs(tt.want)) {
+				t.Errorf("QueryMessages = %v, want %v", messageIDs(got), messageIDs(tt.want))
+			}
+
+			n, err := database.CountMessages(channel.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("CountMessages: %v", err)
+			}
+			if n != len(tt.want) {
+				t.Errorf("CountMessages = %d, want %d", n, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestQueryMessagesTimeBoundsKeepFullPrecision(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	// Both messages fall in the same millisecond as testTime
+	msg := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "first", CreatedAt: testTime})
+	next := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "second", CreatedAt: testTime.Add(time.Nanosecond)})
+
+	tests := []struct {
+		name   string
+		filter MessageFilter
+		want   []Message
+	}{
+		{"after the instant itself", MessageFilter{After: testTime}, []Message{next}},
+		{"after a nanosecond earlier", MessageFilter{After: testTime.Add(-time.Nanosecond)}, []Message{msg, next}},
+		{"before the later instant", MessageFilter{Before: testTime.Add(time.Nanosecond)}, []Message{msg}},
+		{"before the instant itself", MessageFilter{Before: testTime}, nil},
+		// Bounds in another zone name the same instants
+		{"after in another zone", MessageFilter{After: testTime.In(time.FixedZone("UTC-7", -7*3600))}, []Message{next}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.QueryMessages(channel.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("QueryMessages: %v", err)
+			}
+			if !slices.Equal(messageIDs(got), messageIDs(tt.want)) {
+				t.Errorf("QueryMessages = %v, want %v", messageIDs(got), messageIDs(tt.want))
+			}
+		})
+	}
+}
+
+func TestQueryMessagesStoresCreatedAtInUTC(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	// Stored in a zone ahead of UTC, this message's local text would sort
+	// after the later one's
+	east := time.FixedZone("UTC+9", 9*3600)
+	early := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "early", CreatedAt: testTime.In(east)})
+	late := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "late", CreatedAt: testTime.Add(time.Hour)})
+
+	got, err := database.QueryMessages(channel.ID, MessageFilter{After: testTime.Add(-time.Nanosecond)})
+	if err != nil {
+		t.Fatalf("QueryMessages: %v", err)
+	}
+	if want := []Message{early, late}; !slices.Equal(messageIDs(got), messageIDs(want)) {
+		t.Errorf("QueryMessages = %v, want %v", messageIDs(got), messageIDs(want))
+	}
+	if len(got) > 0 && !got[0].CreatedAt.Equal(testTime) {
+		t.Errorf("CreatedAt = %v, want %v", got[0].CreatedAt, testTime)
+	}
+}
+
+func TestQueryMessagesTreatsFilterValuesAsData(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	literal := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "100% done_now", CreatedAt: testTime})
+	insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "1000 donexnow", CreatedAt: testTime.Add(time.Second)})
+
+	tests := []struct {
+		name   string
+		filter MessageFilter
+		want   []Message
+	}{
+		{"percent is literal", MessageFilter{Contains: "0% d"}, []Message{literal}},
+		{"underscore is literal", MessageFilter{Contains: "done_now"}, []Message{literal}},
+		{"quote in author", MessageFilter{Author: "alice' OR '1'='1"}, nil},
+		{"statement in contains", MessageFilter{Contains: "'; DROP TABLE messages; --"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.QueryMessages(channel.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("QueryMessages: %v", err)
+			}
+			if !slices.Equal(messageIDs(got), messageIDs(tt.want)) {
+				t.Errorf("QueryMessages = %v, want %v", messageIDs(got), messageIDs(tt.want))
+			}
+		})
+	}
+
+	if _, err := database.ListAllMessages(channel.ID); err != nil {
+		t.Errorf("messages table unusable after injection attempts: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package db
+
+import "time"
+
+// Highlight is a keyword a user wants to be notified about
+type Highlight struct {
+	Username  string    `json:"username"`
+	Keyword   string    `json:"keyword"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddHighlight registers a keyword for a user, returning ErrDuplicate if they
+// already have it
+func (db *DB) AddHighlight(username, keyword string) error {
+	_, err := db.execRetry(
+		"INSERT INTO highlights (username, keyword, created_at) VALUES (?, ?, ?)",
+		username, keyword, time.Now(),
+	)
+	return translateError(err)
+}
+
+// RemoveHighlight removes a user's keyword, returning ErrNotFound if they
+// don't have it
+func (db *DB) RemoveHighlight(username, keyword string) error {
+	return requireRow(db.execRetry("DELETE FROM highlights WHERE username = ? AND keyword = ?", username, keyword))
+}
+
+// ListHighlights returns every registered keyword, grouped by user
+func (db *DB) ListHighlights() ([]Highlight, error) {
+	rows, err := db.Query("SELECT username, keyword, created_at FROM highlights ORDER BY username, keyword")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var highlights []Highlight
+	for rows.Next() {
+		var h Highlight
+		if err := rows.Scan(&h.Username, &h.Keyword, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		highlights = append(highlights, h)
+	}
+	return highlights, rows.Err()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// IDScheme selects how IDs are generated for new channels, messages, flags
+// and users. IDs are stored as TEXT whatever the scheme, so the schema and
+// queries don't change with it, and a database may hold IDs from several
+// schemes if the setting changes over its lifetime; only IDs made under the
+// same scheme compare meaningfully.
+type IDScheme string
+
+const (
+	// IDUUIDv4 IDs are random. They reveal nothing about the row, but they
+	// don't sort by creation and inserting them scatters writes across the
+	// primary key index.
+	IDUUIDv4 IDScheme = "uuidv4"
+
+	// IDUUIDv7 IDs start with a millisecond timestamp, so they sort by
+	// creation as text and inserts append to the index, and an ID can serve
+	// as a pagination cursor. They reveal when the row was created, and IDs
+	// made within the same millisecond are ordered randomly.
+	IDUUIDv7 IDScheme = "uuidv7"
+
+	// IDSequence IDs are a counter shared by every table, zero-padded so
+	// they sort numerically as text. They are short and strictly ordered,
+	// but guessable and they reveal how many rows exist. The counter is
+	// seeded from the database at startup and kept in the process, so only
+	// one process may write to the database.
+	IDSequence IDScheme = "sequence"
+)
+
+// sequenceIDWidth is how many digits sequence IDs are padded to
+const sequenceIDWidth = 12
+
+// ParseIDScheme validates an ID scheme name
+func ParseIDScheme(name string) (IDScheme, error) {
+	switch scheme := IDScheme(name); scheme {
+	case IDUUIDv4, IDUUIDv7, IDSequence:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("unknown ID scheme %q (want %s, %s or %s)", name, IDUUIDv4, IDUUIDv7, IDSequence)
+	}
+}
+
+// idGenerator makes IDs for new rows under one scheme
+type idGenerator struct {
+	scheme IDScheme
+
+	// seq is the last sequence ID handed out
+	seq atomic.Int64
+}
+
+// newIDGenerator returns a generator for scheme. For IDSequence it resumes
+// after the highest numeric ID already stored, archived messages included:
+// they are still read by ID with IncludeArchived, and archiving a message
+// that reused one would fail on archived_messages' primary key.
+func newIDGenerator(sqlDB *sql.DB, scheme IDScheme) (*idGenerator, error) {
+	g := &idGenerator{scheme: scheme}
+	if scheme != IDSequence {
+		return g, nil
+	}
+
+	var last sql.NullInt64
+	err := sqlDB.QueryRow(`SELECT MAX(n) FROM (
+		SELECT CAST(id AS INTEGER) AS n FROM channels WHERE id NOT GLOB '*[^0-9]*'
+		UNION ALL SELECT CAST(id AS INTEGER) FROM messages WHERE id NOT GLOB '*[^0-9]*'
+		UNION ALL SELECT CAST(id AS INTEGER) FROM archived_messages WHERE id NOT GLOB '*[^0-9]*'
+		UNION ALL SELECT CAST(id AS INTEGER) FROM flags WHERE id NOT GLOB '*[^0-9]*'
+		UNION ALL SELECT CAST(id AS INTEGER) FROM users WHERE id NOT GLOB '*[^0-9]*'
+	)`).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+	g.seq.Store(last.Int64)
+	return g, nil
+}
+
+// next returns a new ID
+func (g *idGenerator) next() string {
+	switch g.scheme {
+	case IDUUIDv4:
+		return uuid.New().String()
+	case IDSequence:
+		return fmt.Sprintf("%0*d", sequenceIDWidth, g.seq.Add(1))
+	default:
+		return uuid.Must(uuid.NewV7()).String()
+	}
+}
+
+// newID returns an ID for a new row under the database's ID scheme
+func (db *DB) newID() string {
+	return db.ids.next()
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSequenceIDsResumeAfterArchivedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	opts := DefaultOptions()
+	opts.IDScheme = IDSequence
+
+	database, err := InitDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("InitDBWithOptions: %v", err)
+	}
+	channel := newTestChannel(t, database, "general")
+	old := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "old", CreatedAt: testTime})
+	if _, err := database.ArchiveOldMessages(channel.ID, testTime.Add(time.Second)); err != nil {
+		t.Fatalf("ArchiveOldMessages: %v", err)
+	}
+	database.Close()
+
+	// The archived message holds the highest ID, so a restart must not
+	// hand it out again
+	database, err = InitDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer database.Close()
+	if id := database.newID(); id <= old.ID {
+		t.Errorf("newID after restart = %s, want after archived %s", id, old.ID)
+	}
+	next := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "new", CreatedAt: testTime})
+	if _, err := database.ArchiveOldMessages(channel.ID, testTime.Add(time.Second)); err != nil {
+		t.Fatalf("archiving %s alongside %s: %v", next.ID, old.ID, err)
+	}
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Metadata is a message's app-defined key-value pairs, stored as a JSON
+// object in a TEXT column. Empty metadata is stored as NULL.
+type Metadata map[string]string
+
+// Value implements driver.Valuer
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (m *Metadata) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	case []byte:
+		return json.Unmarshal(src, m)
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+}
@@ -0,0 +1,348 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// migration is a schema change for databases created by an older schema.sql.
+// Migrations must be safe to run against a fresh, empty database too.
+type migration struct {
+	name  string
+	apply func(tx *sql.Tx) error
+
+	// foreignKeysOff runs apply with foreign key enforcement off, as SQLite
+	// requires when rebuilding a table other tables reference. Dropping the
+	// old table would otherwise cascade to their rows.
+	foreignKeysOff bool
+}
+
+// migrations are applied in order, each exactly once, tracked via PRAGMA user_version.
+// Append new entries; never reorder or remove existing ones.
+var migrations = []migration{
+	{
+		name: "drop idx_messages_channel_id, superseded by idx_messages_channel_created",
+		apply: func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP INDEX IF EXISTS idx_messages_channel_id")
+			return err
+		},
+	},
+	{
+		name: "add messages.hidden",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "messages", "hidden", "BOOLEAN NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		name: "add messages.parent_id and messages.edited_at",
+		apply: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "messages", "parent_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+			return addColumn(tx, "messages", "edited_at", "DATETIME")
+		},
+	},
+	{
+		name: "add channels.slow_mode_seconds",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "channels", "slow_mode_seconds", "INTEGER NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		name: "add channels.read_only",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "channels", "read_only", "BOOLEAN NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		name: "add messages.is_bot",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "messages", "is_bot", "BOOLEAN NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		name: "add channels.topic",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "channels", "topic", "TEXT NOT NULL DEFAULT ''")
+		},
+	},
+	{
+		name: "add users.last_active_at",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "users", "last_active_at", "DATETIME")
+		},
+	},
+	{
+		name: "add CHECK constraints on messages.content and messages.author",
+		apply: func(tx *sql.Tx) error {
+			if err := fitMessageChecks(tx); err != nil {
+				return err
+			}
+			return rebuildTable(tx, "messages", `CREATE TABLE messages_new (
+				id TEXT PRIMARY KEY,
+				channel_id TEXT NOT NULL,
+				author TEXT NOT NULL,
+				content TEXT NOT NULL,
+				parent_id TEXT NOT NULL DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				edited_at DATETIME,
+				hidden BOOLEAN NOT NULL DEFAULT 0,
+				is_bot BOOLEAN NOT NULL DEFAULT 0,
+				CONSTRAINT messages_content_not_empty CHECK (length(content) > 0),
+				CONSTRAINT messages_content_max_length CHECK (length(content) <= 4000),
+				CONSTRAINT messages_author_not_empty CHECK (length(author) > 0),
+				FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+			)`, "id, channel_id, author, content, parent_id, created_at, edited_at, hidden, is_bot")
+		},
+		foreignKeysOff: true,
+	},
+	{
+		name: "add messages.metadata",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "messages", "metadata", "TEXT")
+		},
+	},
+	{
+		name: "add messages.subtype",
+		apply: func(tx *sql.Tx) error {
+			return addColumn(tx, "messages", "subtype", "TEXT NOT NULL DEFAULT ''")
+		},
+	},
+	{
+		name: "store messages.created_at in UTC",
+		apply: func(tx *sql.Tx) error {
+			if err := utcTimestamps(tx, "messages", "created_at"); err != nil {
+				return err
+			}
+			return utcTimestamps(tx, "archived_messages", "created_at")
+		},
+	},
+}
+
+// migrate applies any migrations newer than the database's user_version.
+// They run on one connection, so pragmas set for a migration apply to it.
+func migrate(sqlDB *sql.DB) error {
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(ctx, conn, i); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", i+1, migrations[i].name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs migrations[i] in a transaction and records it in
+// user_version
+func applyMigration(ctx context.Context, conn *sql.Conn, i int) error {
+	m := migrations[i]
+	if m.foreignKeysOff {
+		// The pragma has no effect inside a transaction
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := m.apply(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if m.foreignKeysOff {
+		if err := checkForeignKeys(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkForeignKeys fails if any row references one that doesn't exist, which
+// a migration run with foreign keys off could otherwise leave behind
+func checkForeignKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	violations := 0
+	for rows.Next() {
+		violations++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d rows violate foreign keys", violations)
+	}
+	return nil
+}
+
+// rebuildTable recreates a table with a new definition, the way SQLite
+// changes constraints that ALTER TABLE can't. create must create the
+// replacement as <table>_new with the given columns; rows are copied across
+// and the old table is dropped, taking its indexes with it for schema.sql
+// to recreate. It does nothing if the table is missing, since schema.sql
+// will create it.
+func rebuildTable(tx *sql.Tx, table, create, columns string) error {
+	exists, err := tableExists(tx, table)
+	if err != nil || !exists {
+		return err
+	}
+
+	for _, stmt := range []string{
+		create,
+		fmt.Sprintf("INSERT INTO %s_new (%s) SELECT %s FROM %s", table, columns, columns, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s_new RENAME TO %s", table, table),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// fitMessageChecks prepares existing messages for the CHECK constraints on
+// content and author before the table is rebuilt with them, since one bad
+// row would otherwise fail the copy with nothing but the constraint's name.
+// Content over the limit is trimmed to it, logging how many messages were.
+// Empty content or authors can't be repaired without guessing, so they fail
+// the migration with a count and what to do about them.
+func fitMessageChecks(tx *sql.Tx) error {
+	exists, err := tableExists(tx, "messages")
+	if err != nil || !exists {
+		return err
+	}
+
+	var empty int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM messages WHERE length(content) = 0 OR length(author) = 0").Scan(&empty); err != nil {
+		return err
+	}
+	if empty > 0 {
+		return fmt.Errorf("%d messages have empty content or an empty author, which the new schema rejects; "+
+			"delete or fix them (SELECT id FROM messages WHERE content = '' OR author = '') and restart", empty)
+	}
+
+	// The limit is spelled out rather than taken from MaxContentLength,
+	// since it must match the constraint this migration creates
+	res, err := tx.Exec("UPDATE messages SET content = substr(content, 1, 4000) WHERE length(content) > 4000")
+	if err != nil {
+		return err
+	}
+	trimmed, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if trimmed > 0 {
+		slog.Warn("trimmed over-long messages to fit the content limit", "count", trimmed, "limit", 4000)
+	}
+	return nil
+}
+
+// tableExists reports whether the database has a table with the given name
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", table).Scan(&exists)
+	return exists, err
+}
+
+// utcTimestamps rewrites the timestamps in a table's column that aren't
+// stored in UTC, as older versions stored them with the server's offset, so
+// that they compare as text. It does nothing if the table is missing.
+func utcTimestamps(tx *sql.Tx, table, column string) error {
+	exists, err := tableExists(tx, table)
+	if err != nil || !exists {
+		return err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf(
+		"SELECT id, %s FROM %s WHERE %s IS NOT NULL AND %s NOT LIKE '%%+00:00'",
+		column, table, column, column,
+	))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stamps := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var t time.Time
+		if err := rows.Scan(&id, &t); err != nil {
+			return err
+		}
+		stamps[id] = t
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, t := range stamps {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column), t.UTC(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to a table unless the table is missing (schema.sql
+// will create it with the column) or already has it
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	exists := false
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull bool
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		exists = true
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUTCTimestampsRewritesOffsets(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+	msg := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "hi", CreatedAt: testTime})
+
+	// As an older version would have stored testTime on a server at UTC-7
+	if _, err := database.Exec("UPDATE messages SET created_at = ? WHERE id = ?", "2024-03-01 05:00:00.123456789-07:00", msg.ID); err != nil {
+		t.Fatalf("UPDATE: %v", err)
+	}
+
+	err := database.withTx(func(tx *sql.Tx) error {
+		return utcTimestamps(tx, "messages", "created_at")
+	})
+	if err != nil {
+		t.Fatalf("utcTimestamps: %v", err)
+	}
+
+	var stored string
+	if err := database.QueryRow("SELECT CAST(created_at AS TEXT) FROM messages WHERE id = ?", msg.ID).Scan(&stored); err != nil {
+		t.Fatalf("SELECT: %v", err)
+	}
+	if want := "2024-03-01 12:00:00.123456789+00:00"; stored != want {
+		t.Errorf("created_at = %q, want %q", stored, want)
+	}
+}
+
+func TestUTCTimestampsSkipsMissingTable(t *testing.T) {
+	database := newTestDB(t)
+	err := database.withTx(func(tx *sql.Tx) error {
+		return utcTimestamps(tx, "no_such_table", "created_at")
+	})
+	if err != nil {
+		t.Errorf("utcTimestamps on a missing table: %v", err)
+	}
+}
+
+// openOldMessagesTable opens a bare database holding a messages table
+// without the CHECK constraints, as databases from before them had
+func openOldMessagesTable(t *testing.T) *sql.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "old.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if _, err := sqlDB.Exec("CREATE TABLE messages (id TEXT PRIMARY KEY, author TEXT NOT NULL, content TEXT NOT NULL)"); err != nil {
+		t.Fatalf("CREATE TABLE: %v", err)
+	}
+	return sqlDB
+}
+
+// fitOldMessages runs fitMessageChecks against sqlDB in a transaction
+func fitOldMessages(sqlDB *sql.DB) error {
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fitMessageChecks(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestFitMessageChecksTrimsLongContent(t *testing.T) {
+	sqlDB := openOldMessagesTable(t)
+	long := strings.Repeat("é", 4001)
+	if _, err := sqlDB.Exec("INSERT INTO messages VALUES ('1', 'alice', ?), ('2', 'bob', 'fine')", long); err != nil {
+		t.Fatalf("INSERT: %v", err)
+	}
+
+	if err := fitOldMessages(sqlDB); err != nil {
+		t.Fatalf("fitMessageChecks: %v", err)
+	}
+
+	var content string
+	if err := sqlDB.QueryRow("SELECT content FROM messages WHERE id = '1'").Scan(&content); err != nil {
+		t.Fatalf("SELECT: %v", err)
+	}
+	if want := long[:4000*len("é")]; content != want {
+		t.Errorf("trimmed content has %d characters, want 4000", utf8.RuneCountInString(content))
+	}
+	if err := sqlDB.QueryRow("SELECT content FROM messages WHERE id = '2'").Scan(&content); err != nil || content != "fine" {
+		t.Errorf("untouched content = %q, %v", content, err)
+	}
+}
+
+func TestFitMessageChecksRejectsEmptyFields(t *testing.T) {
+	for _, row := range [][2]string{{"alice", ""}, {"", "hi"}} {
+		sqlDB := openOldMessagesTable(t)
+		if _, err := sqlDB.Exec("INSERT INTO messages VALUES ('1', ?, ?)", row[0], row[1]); err != nil {
+			t.Fatalf("INSERT: %v", err)
+		}
+		err := fitOldMessages(sqlDB)
+		if err == nil || !strings.Contains(err.Error(), "1 messages have empty content or an empty author") {
+			t.Errorf("author %q, content %q: fitMessageChecks = %v, want a count of the empty rows", row[0], row[1], err)
+		}
+	}
+}
+
+func TestMessageChecksRejectDirectInserts(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+
+	tests := []struct {
+		name            string
+		author, content string
+		want            error
+	}{
+		{"empty content", "alice", "", ErrContentEmpty},
+		{"content too long", "alice", strings.Repeat("x", MaxContentLength+1), ErrContentTooLong},
+		{"empty author", "", "hi", ErrAuthorEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Straight to SQL, past any validation in Go
+			_, err := database.Exec(
+				"INSERT INTO messages (id, channel_id, author, content) VALUES (?, ?, ?, ?)",
+				database.newID(), channel.ID, tt.author, tt.content,
+			)
+			if err = translateError(err); !errors.Is(err, tt.want) {
+				t.Errorf("INSERT = %v, want %v", err, tt.want)
+			}
+			if !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("INSERT = %v, want it to match ErrInvalidMessage too", err)
+			}
+		})
+	}
+
+	// At the limit is allowed
+	_, err := database.Exec(
+		"INSERT INTO messages (id, channel_id, author, content) VALUES (?, ?, ?, ?)",
+		database.newID(), channel.ID, "alice", strings.Repeat("x", MaxContentLength),
+	)
+	if err != nil {
+		t.Errorf("INSERT at the content limit: %v", err)
+	}
+}
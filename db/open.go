@@ -0,0 +1,101 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// prepareDir checks that the directory for the database file at path exists,
+// creating it first when create is set. In-memory databases and URI
+// filenames are left to SQLite.
+func prepareDir(path string, create bool) error {
+	if path == ":memory:" || strings.HasPrefix(path, "file:") {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	if create {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cannot create database at %s: %w", path, fsError(err))
+		}
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot create database at %s: %w", path, fsError(err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot create database at %s: %s is not a directory", path, dir)
+	}
+	return nil
+}
+
+// openError explains a failure to open or set up the database at path in
+// terms an operator can act on. SQLite opens the file lazily, so these
+// surface from the first statement rather than from sql.Open. Errors it
+// doesn't recognize are returned unchanged.
+func openError(path string, err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return fmt.Errorf("cannot open database at %s: %w", path, ErrLocked)
+	case sqlite3.ErrReadonly, sqlite3.ErrPerm:
+		return fmt.Errorf("cannot write database at %s: %w", path, ErrPermission)
+	case sqlite3.ErrNotADB:
+		return fmt.Errorf("cannot open database at %s: %w", path, ErrNotDatabase)
+	case sqlite3.ErrCantOpen:
+		if cause := diagnoseOpen(path); cause != nil {
+			return fmt.Errorf("cannot open database at %s: %w", path, cause)
+		}
+	}
+	return err
+}
+
+// diagnoseOpen works out why SQLite, which says only "unable to open
+// database file", couldn't open path. SQLite needs to write the file and to
+// create its journal files beside it, so both are probed. It returns nil if
+// neither turns up a problem.
+func diagnoseOpen(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	probe, err := os.CreateTemp(filepath.Dir(path), ".slacklite-probe-*")
+	if err != nil {
+		return fsError(err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fsError(err)
+	}
+	if f != nil {
+		f.Close()
+	}
+	return nil
+}
+
+// fsError maps a filesystem error onto ErrDirNotFound or ErrPermission,
+// leaving anything else unchanged
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrDirNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Reaction is one author's emoji reaction to a message
+type Reaction struct {
+	MessageID string    `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionLimits caps the reactions on one message. Zero fields don't limit.
+type ReactionLimits struct {
+	// MaxEmoji is how many different emoji the message may carry
+	MaxEmoji int
+
+	// MaxPerAuthor is how many of them one author may add
+	MaxPerAuthor int
+}
+
+// ToggleReaction adds an author's emoji reaction to a message, or removes it
+// if they have already reacted with that emoji, in a single transaction. It
+// reports whether the reaction exists afterwards, and returns ErrNotFound if
+// the message does not exist, or ErrTooManyEmoji or ErrTooManyReactions if
+// adding it would break limits. Removing a reaction is always allowed.
+func (db *DB) ToggleReaction(messageID, emoji, author string, limits ReactionLimits) (bool, error) {
+	var added bool
+	err := db.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			"DELETE FROM reactions WHERE message_id = ? AND emoji = ? AND author = ?",
+			messageID, emoji, author,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if added = n == 0; !added {
+			return nil
+		}
+		if err := checkReactionLimits(tx, messageID, emoji, author, limits); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO reactions (message_id, emoji, author, created_at) VALUES (?, ?, ?, ?)",
+			messageID, emoji, author, time.Now(),
+		)
+		return err
+	})
+	return added, translateError(err)
+}
+
+// checkReactionLimits returns ErrTooManyEmoji or ErrTooManyReactions if
+// adding author's emoji to a message would break limits
+func checkReactionLimits(tx *sql.Tx, messageID, emoji, author string, limits ReactionLimits) error {
+	if limits.MaxEmoji > 0 {
+		var count int
+		var present bool
+		err := tx.QueryRow(
+			"SELECT COUNT(DISTINCT emoji), COALESCE(MAX(emoji = ?), 0) FROM reactions WHERE message_id = ?",
+			emoji, messageID,
+		).Scan(&count, &present)
+		if err != nil {
+			return err
+		}
+		if !present && count >= limits.MaxEmoji {
+			return ErrTooManyEmoji
+		}
+	}
+
+	if limits.MaxPerAuthor > 0 {
+		var given int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM reactions WHERE message_id = ? AND author = ?",
+			messageID, author,
+		).Scan(&given)
+		if err != nil {
+			return err
+		}
+		if given >= limits.MaxPerAuthor {
+			return ErrTooManyReactions
+		}
+	}
+	return nil
+}
+
+// ListReactions returns every reaction, oldest first
+func (db *DB) ListReactions() ([]Reaction, error) {
+	rows, err := db.Query("SELECT message_id, emoji, author, created_at FROM reactions ORDER BY created_at ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.MessageID, &r.Emoji, &r.Author, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+// ListReactionAuthors returns one page of the authors who reacted to a
+// message with emoji, in the order they reacted, along with how many there
+// are in total
+func (db *DB) ListReactionAuthors(messageID, emoji string, limit, offset int) ([]string, int, error) {
+	var total int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM reactions WHERE message_id = ? AND emoji = ?",
+		messageID, emoji,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(
+		`SELECT author FROM reactions WHERE message_id = ? AND emoji = ?
+		ORDER BY created_at ASC, author ASC LIMIT ? OFFSET ?`,
+		messageID, emoji, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	authors := []string{}
+	for rows.Next() {
+		var author string
+		if err := rows.Scan(&author); err != nil {
+			return nil, 0, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, total, rows.Err()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToggleReactionLimits(t *testing.T) {
+	database := newTestDB(t)
+	channel := newTestChannel(t, database, "general")
+	msg := insertTestMessage(t, database, Message{ChannelID: channel.ID, Author: "alice", Content: "vote", CreatedAt: testTime})
+
+	// Steps run in order against the same message, each seeing the
+	// reactions left by the ones before
+	steps := []struct {
+		name          string
+		emoji, author string
+		limits        ReactionLimits
+		want          error
+	}{
+		{"first emoji", "👍", "bob", ReactionLimits{MaxEmoji: 2}, nil},
+		{"second emoji", "👎", "bob", ReactionLimits{MaxEmoji: 2}, nil},
+		{"existing emoji at the emoji limit", "👍", "carol", ReactionLimits{MaxEmoji: 2}, nil},
+		{"new emoji past the emoji limit", "🎉", "carol", ReactionLimits{MaxEmoji: 2}, ErrTooManyEmoji},
+		{"author past their limit", "🎉", "bob", ReactionLimits{MaxPerAuthor: 2}, ErrTooManyReactions},
+		{"other author under their limit", "🎉", "carol", ReactionLimits{MaxPerAuthor: 2}, nil},
+		{"removing at the limit", "👍", "bob", ReactionLimits{MaxEmoji: 1, MaxPerAuthor: 1}, nil},
+		{"adding after removing", "🎉", "bob", ReactionLimits{MaxPerAuthor: 2}, nil},
+		{"no limits", "🚀", "bob", ReactionLimits{}, nil},
+	}
+	for _, step := range steps {
+		_, err := database.ToggleReaction(msg.ID, step.emoji, step.author, step.limits)
+		if !errors.Is(err, step.want) {
+			t.Errorf("%s: ToggleReaction = %v, want %v", step.name, err, step.want)
+		}
+		if step.want != nil && !errors.Is(err, ErrReactionLimit) {
+			t.Errorf("%s: ToggleReaction = %v, want it to match ErrReactionLimit too", step.name, err)
+		}
+	}
+
+	// Rejected reactions leave nothing behind
+	authors, _, err := database.ListReactionAuthors(msg.ID, "🎉", 10, 0)
+	if err != nil {
+		t.Fatalf("ListReactionAuthors: %v", err)
+	}
+	if len(authors) != 2 || authors[0] != "carol" || authors[1] != "bob" {
+		t.Errorf("🎉 authors = %v, want [carol bob]", authors)
+	}
+}
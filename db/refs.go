@@ -0,0 +1,46 @@
+package db
+
+import "database/sql"
+
+// Ref is one cross-reference from a message to another message, a user or a
+// channel. Position keeps refs in the order they were given.
+type Ref struct {
+	MessageID string `json:"message_id"`
+	Position  int    `json:"position"`
+	Kind      string `json:"kind"`
+	Target    string `json:"target"`
+}
+
+// insertRefs stores a new message's refs. It must run inside the
+// transaction that inserts the message.
+func insertRefs(tx *sql.Tx, messageID string, refs []Ref) error {
+	for i, r := range refs {
+		_, err := tx.Exec(
+			"INSERT INTO message_refs (message_id, position, kind, target) VALUES (?, ?, ?, ?)",
+			messageID, i, r.Kind, r.Target,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRefs returns every stored ref, in order within each message
+func (db *DB) ListRefs() ([]Ref, error) {
+	rows, err := db.Query("SELECT message_id, position, kind, target FROM message_refs ORDER BY message_id, position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []Ref
+	for rows.Next() {
+		var r Ref
+		if err := rows.Scan(&r.MessageID, &r.Position, &r.Kind, &r.Target); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
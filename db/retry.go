@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBusy is returned when a write still finds the database locked after
+// all retries are exhausted
+var ErrBusy = errors.New("database is busy")
+
+const (
+	// busyRetries is how many times a write is retried after SQLITE_BUSY
+	busyRetries = 5
+
+	// busyBackoff is the delay before the first retry; it doubles each attempt
+	busyBackoff = 10 * time.Millisecond
+)
+
+// isBusy reports whether err is SQLite reporting a locked database
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryBusy runs fn, retrying with exponential backoff while SQLite reports
+// the database as busy. Other errors are returned immediately.
+func retryBusy(fn func() error) error {
+	backoff := busyBackoff
+	var err error
+	for attempt := 0; attempt <= busyRetries; attempt++ {
+		if err = fn(); !isBusy(err) {
+			return err
+		}
+		if attempt < busyRetries {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrBusy, err)
+}
+
+// execRetry is db.Exec with retryBusy applied, for single-statement writes
+func (db *DB) execRetry(query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(func() error {
+		var err error
+		res, err = db.Exec(query, args...)
+		return err
+	})
+	return res, err
+}
@@ -3,20 +3,165 @@
 CREATE TABLE IF NOT EXISTS channels (
     id TEXT PRIMARY KEY,
     name TEXT UNIQUE NOT NULL,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    slow_mode_seconds INTEGER NOT NULL DEFAULT 0,
+    read_only BOOLEAN NOT NULL DEFAULT 0,
+    topic TEXT NOT NULL DEFAULT ''
 );
 
+-- The CHECK constraints hold whichever code path writes a message; their
+-- names are mapped to typed errors, and 4000 is db.MaxContentLength
 CREATE TABLE IF NOT EXISTS messages (
     id TEXT PRIMARY KEY,
     channel_id TEXT NOT NULL,
     author TEXT NOT NULL,
     content TEXT NOT NULL,
+    parent_id TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    edited_at DATETIME,
+    hidden BOOLEAN NOT NULL DEFAULT 0,
+    is_bot BOOLEAN NOT NULL DEFAULT 0,
+    metadata TEXT,
+    subtype TEXT NOT NULL DEFAULT '',
+    CONSTRAINT messages_content_not_empty CHECK (length(content) > 0),
+    CONSTRAINT messages_content_max_length CHECK (length(content) <= 4000),
+    CONSTRAINT messages_author_not_empty CHECK (length(author) > 0),
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS flags (
+    id TEXT PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    reporter TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, reporter),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- username keeps the display case; username_key is its lowercase form and
+-- carries the UNIQUE constraint so "Alice" and "alice" can't both register
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    username_key TEXT UNIQUE NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_active_at DATETIME
+);
+
+-- Link preview for the first URL in a message, filled in after posting
+CREATE TABLE IF NOT EXISTS unfurls (
+    message_id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- One row per author per emoji per message
+CREATE TABLE IF NOT EXISTS reactions (
+    message_id TEXT NOT NULL,
+    emoji TEXT NOT NULL,
+    author TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, emoji, author),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Cross-references from a message to other messages, users or channels,
+-- resolved when messages are read
+CREATE TABLE IF NOT EXISTS message_refs (
+    message_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    PRIMARY KEY (message_id, position),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- One draft per author per channel, replaced on each save
+CREATE TABLE IF NOT EXISTS drafts (
+    channel_id TEXT NOT NULL,
+    author TEXT NOT NULL,
+    content TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, author),
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
+
+-- Keywords stored lowercase; matching is case-insensitive on word boundaries
+CREATE TABLE IF NOT EXISTS highlights (
+    username TEXT NOT NULL,
+    keyword TEXT NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, keyword)
+);
+
+-- Cold storage for old messages, moved here by ArchiveOldMessages with the
+-- same columns as messages. Their reactions, link previews and refs are
+-- dropped when they move.
+CREATE TABLE IF NOT EXISTS archived_messages (
+    id TEXT PRIMARY KEY,
+    channel_id TEXT NOT NULL,
+    author TEXT NOT NULL,
+    content TEXT NOT NULL,
+    parent_id TEXT NOT NULL DEFAULT '',
+    created_at DATETIME,
+    edited_at DATETIME,
+    hidden BOOLEAN NOT NULL DEFAULT 0,
+    is_bot BOOLEAN NOT NULL DEFAULT 0,
+    metadata TEXT,
+    subtype TEXT NOT NULL DEFAULT '',
     FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
 );
 
--- Index for faster message queries by channel
-CREATE INDEX IF NOT EXISTS idx_messages_channel_id ON messages(channel_id);
+-- Reactions to custom emoji store the name in shortcode form, ":name:"
+CREATE TABLE IF NOT EXISTS custom_emoji (
+    name TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS pins (
+    channel_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    pinned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, message_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Administrative actions, written in the same transaction as the action
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes are created with IF NOT EXISTS so re-running this file on an
+-- existing database adds any that are missing.
+
+-- Channel name prefix search: ListChannelsByPrefix (name LIKE 'eng%'), which
+-- only uses an index with the same case-insensitivity as LIKE
+CREATE INDEX IF NOT EXISTS idx_channels_name_nocase ON channels(name COLLATE NOCASE);
+
+-- Channel timeline: ListMessages (WHERE channel_id = ? ORDER BY created_at)
+-- and the ON DELETE CASCADE lookup when a channel is removed
+CREATE INDEX IF NOT EXISTS idx_messages_channel_created ON messages(channel_id, created_at);
 
--- Index for message ordering
+-- Cross-channel ordering by time
 CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+
+-- Per-author queries: ListMessagesByAuthor, mentions, rate limiting stats
+CREATE INDEX IF NOT EXISTS idx_messages_author ON messages(author);
+
+-- Archived messages by channel, for ?include_archived=true
+CREATE INDEX IF NOT EXISTS idx_archived_messages_channel_created ON archived_messages(channel_id, created_at);
+
+-- Audit log filtered by action, newest first
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, id);
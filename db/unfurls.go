@@ -0,0 +1,43 @@
+package db
+
+import "time"
+
+// Unfurl is link preview metadata fetched for the first URL in a message
+type Unfurl struct {
+	MessageID   string    `json:"message_id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// SaveUnfurl stores or replaces a message's link preview, returning
+// ErrNotFound if the message does not exist
+func (db *DB) SaveUnfurl(u Unfurl) error {
+	_, err := db.execRetry(
+		`INSERT INTO unfurls (message_id, url, title, description, fetched_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE SET url = excluded.url, title = excluded.title,
+			description = excluded.description, fetched_at = excluded.fetched_at`,
+		u.MessageID, u.URL, u.Title, u.Description, u.FetchedAt,
+	)
+	return translateError(err)
+}
+
+// ListUnfurls returns every stored link preview
+func (db *DB) ListUnfurls() ([]Unfurl, error) {
+	rows, err := db.Query("SELECT message_id, url, title, description, fetched_at FROM unfurls")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unfurls []Unfurl
+	for rows.Next() {
+		var u Unfurl
+		if err := rows.Scan(&u.MessageID, &u.URL, &u.Title, &u.Description, &u.FetchedAt); err != nil {
+			return nil, err
+		}
+		unfurls = append(unfurls, u)
+	}
+	return unfurls, rows.Err()
+}
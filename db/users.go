@@ -0,0 +1,89 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// User is a registered username. Username keeps the case the user chose;
+// uniqueness and lookups ignore case.
+type User struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastActiveAt *time.Time `json:"last_active_at,omitempty"`
+}
+
+// usernameKey normalizes a username for case-insensitive comparison. It is
+// done in Go because SQLite's lower() only folds ASCII.
+func usernameKey(username string) string {
+	return strings.ToLower(username)
+}
+
+// CreateUser registers a username, returning ErrUsernameTaken if it differs
+// from an existing one only by case
+func (db *DB) CreateUser(username string) (*User, error) {
+	user := &User{
+		ID:        db.newID(),
+		Username:  username,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := db.execRetry(
+		"INSERT INTO users (id, username, username_key, created_at) VALUES (?, ?, ?, ?)",
+		user.ID, user.Username, usernameKey(username), user.CreatedAt,
+	)
+	if err != nil {
+		if err = translateError(err); errors.Is(err, ErrDuplicate) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by username, ignoring case
+func (db *DB) GetUserByUsername(username string) (*User, error) {
+	user := &User{}
+	err := db.QueryRow(
+		"SELECT id, username, created_at, last_active_at FROM users WHERE username_key = ?",
+		usernameKey(username),
+	).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.LastActiveAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return user, nil
+}
+
+// TouchUser records that username was active at the given time. Authors
+// don't have to register before posting, so a user seen for the first time
+// is created here.
+func (db *DB) TouchUser(username string, at time.Time) error {
+	_, err := db.execRetry(
+		`INSERT INTO users (id, username, username_key, created_at, last_active_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (username_key) DO UPDATE SET last_active_at = excluded.last_active_at`,
+		db.newID(), username, usernameKey(username), at, at,
+	)
+	return err
+}
+
+// ListActiveUsers returns every user that has been active, with when
+func (db *DB) ListActiveUsers() ([]User, error) {
+	rows, err := db.Query("SELECT id, username, created_at, last_active_at FROM users WHERE last_active_at IS NOT NULL ORDER BY username_key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.LastActiveAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
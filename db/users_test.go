@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUsernamesIgnoreCase(t *testing.T) {
+	database := newTestDB(t)
+
+	alice, err := database.CreateUser("Alice")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := database.CreateUser("aLICE"); !errors.Is(err, ErrUsernameTaken) || !errors.Is(err, ErrDuplicate) {
+		t.Errorf("CreateUser with another case = %v, want ErrUsernameTaken", err)
+	}
+
+	got, err := database.GetUserByUsername("ALICE")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != alice.ID || got.Username != "Alice" {
+		t.Errorf("GetUserByUsername = %+v, want %+v", got, alice)
+	}
+	if _, err := database.GetUserByUsername("bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserByUsername(bob) = %v, want ErrNotFound", err)
+	}
+
+	// An author seen posting holds their name as if registered
+	if err := database.TouchUser("Bob", testTime); err != nil {
+		t.Fatalf("TouchUser: %v", err)
+	}
+	if _, err := database.CreateUser("bob"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("CreateUser for an active author = %v, want ErrUsernameTaken", err)
+	}
+}
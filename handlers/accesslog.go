@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AccessLog logs each request's method, path, status, duration and response
+// size through slog. Only a Config.AccessLogSampleRate fraction of requests
+// is logged, except server errors, which always are. WebSocket upgrades are
+// logged once, when the handshake finishes, and never sampled away, since
+// connections are far rarer than requests. Paths in
+// Config.AccessLogExclude are never logged.
+func AccessLog(next http.Handler, cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if excludedFromAccessLog(r.URL.Path, cfg.AccessLogExclude) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		status := lw.statusCode()
+
+		upgrade := r.Header.Get("Upgrade") != ""
+		if !upgrade && status < 500 && rand.Float64() >= cfg.AccessLogSampleRate {
+			return
+		}
+
+		level, msg := slog.LevelInfo, "http request"
+		if upgrade {
+			msg = "websocket connect"
+		}
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, msg,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+			"bytes", lw.bytes,
+			"ip", clientIP(r, cfg.TrustedProxies),
+		)
+	})
+}
+
+// excludedFromAccessLog reports whether path matches one of exclude. As with
+// http.ServeMux, entries ending in a slash match every path under them.
+func excludedFromAccessLog(path string, exclude []string) bool {
+	for _, e := range exclude {
+		if path == e || strings.HasSuffix(e, "/") && strings.HasPrefix(path, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggingResponseWriter records the status and body size of a response. It
+// passes flushes and hijacks through, so streams and WebSocket upgrades work
+// behind it.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+// statusCode returns the status sent, which is 101 for a hijacked
+// connection and 200 if the handler never set one
+func (w *loggingResponseWriter) statusCode() int {
+	switch {
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	case w.status == 0:
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// WriteHeader records the first status and sends it
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written
+func (w *loggingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying response, if it supports flushing
+func (w *loggingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, for WebSocket upgrades
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// activityWriteInterval is how often a user's last activity is written to
+// the database. Activity in between only updates memory, so a busy client
+// doesn't cost a write per frame.
+const activityWriteInterval = time.Minute
+
+// activityTracker records when each user was last active: when they last
+// sent a message or a WebSocket frame. It lives on the Hub so the REST and
+// WebSocket paths update the same record. Users are keyed case-insensitively,
+// like registered usernames.
+type activityTracker struct {
+	mu         sync.Mutex
+	lastActive map[string]time.Time
+	written    map[string]time.Time
+
+	// db is set by load; without it activity is kept in memory only
+	db *db.DB
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{
+		lastActive: make(map[string]time.Time),
+		written:    make(map[string]time.Time),
+	}
+}
+
+// activityKey normalizes a username for the tracker's maps
+func activityKey(username string) string {
+	return strings.ToLower(username)
+}
+
+// load restores stored activity and persists later activity to database,
+// if not nil
+func (t *activityTracker) load(database *db.DB, users []db.User) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, u := range users {
+		key := activityKey(u.Username)
+		t.lastActive[key] = *u.LastActiveAt
+		t.written[key] = *u.LastActiveAt
+	}
+	t.db = database
+}
+
+// touch records that username is active now. The database is written at
+// most once per activityWriteInterval per user; a failed write is logged
+// rather than failing whatever the user was doing.
+func (t *activityTracker) touch(username string) {
+	if username == "" {
+		return
+	}
+	now := time.Now()
+	key := activityKey(username)
+
+	t.mu.Lock()
+	t.lastActive[key] = now
+	write := t.db != nil && now.Sub(t.written[key]) >= activityWriteInterval
+	if write {
+		t.written[key] = now
+	}
+	database := t.db
+	t.mu.Unlock()
+
+	if write {
+		if err := database.TouchUser(username, now); err != nil {
+			log.Printf("Failed to record activity for %s: %v", username, err)
+		}
+	}
+}
+
+// get returns when username was last active, or nil if never
+func (t *activityTracker) get(username string) *time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	at, ok := t.lastActive[activityKey(username)]
+	if !ok {
+		return nil
+	}
+	return &at
+}
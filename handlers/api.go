@@ -2,27 +2,79 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"gastowndemo/db"
+
+	"github.com/gorilla/websocket"
 )
 
+// Response types follow one JSON field policy:
+//   - IDs, names, timestamps, settings, counts and pagination fields (page,
+//     limit, total) are always present, even when zero, so clients can rely
+//     on them.
+//   - Optional fields that are usually unset, such as parent_id, edited_at,
+//     topic and reactions, use omitempty rather than sending null or "".
+//   - The list a response exists to return is always an array, never null:
+//     build it with make or an empty literal.
+//   - Event frames that describe new state, such as channel_update, always
+//     carry every field, so an empty value means the field was cleared.
+
 // Channel represents a chat channel
 type Channel struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	CreatedAt       time.Time `json:"created_at"`
+	SlowModeSeconds int       `json:"slow_mode_seconds"`
+	ReadOnly        bool      `json:"read_only"`
+	Topic           string    `json:"topic,omitempty"`
 }
 
 // Message represents a message in a channel
 type Message struct {
-	ID        string    `json:"id"`
-	ChannelID string    `json:"channel_id"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string     `json:"id"`
+	ChannelID string     `json:"channel_id"`
+	Content   string     `json:"content"`
+	Author    string     `json:"author"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Hidden    bool       `json:"hidden,omitempty"`
+	IsBot     bool       `json:"is_bot,omitempty"`
+	Unfurl    *Unfurl    `json:"unfurl,omitempty"`
+	Reactions []Reaction `json:"reactions,omitempty"`
+	Refs      []Ref      `json:"refs,omitempty"`
+
+	// Metadata holds app-defined key-value pairs, such as button payloads
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Subtype tells clients how to render the message, such as "system"
+	// for notices of channel events; empty for ordinary messages
+	Subtype string `json:"subtype,omitempty"`
+
+	// ResolvedRefs carries display data for Refs, in the same order. It is
+	// only set on getMessages and getThread responses.
+	ResolvedRefs []ResolvedRef `json:"resolved_refs,omitempty"`
+
+	// CreatedAtLocal is CreatedAt rendered in the timezone the client asked
+	// for with ?tz=. It is only set on getMessages responses.
+	CreatedAtLocal string `json:"created_at_local,omitempty"`
+}
+
+// MessageDetail is the response for a single message lookup
+type MessageDetail struct {
+	Message
+	// EditableSeconds is how much longer the message may be edited; omitted when editing is not time limited
+	EditableSeconds *int `json:"editable_seconds,omitempty"`
 }
 
 // CreateChannelRequest is the request body for creating a channel
@@ -32,39 +84,195 @@ type CreateChannelRequest struct {
 
 // CreateMessageRequest is the request body for sending a message
 type CreateMessageRequest struct {
+	Content  string `json:"content"`
+	Author   string `json:"author"`
+	ParentID string `json:"parent_id"`
+	Refs     []Ref  `json:"refs"`
+	Subtype  string `json:"subtype"`
+
+	// Metadata must be a flat object of strings; it is decoded by
+	// parseMetadata so errors can say what is wrong
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// ChannelMessageResponse is the response to a message posted with
+// ?create_channel=true: the channel it was posted to, whether the post
+// created that channel, and the message
+type ChannelMessageResponse struct {
+	Channel *Channel `json:"channel"`
+	Created bool     `json:"created"`
+	Message Message  `json:"message"`
+}
+
+// UpdateChannelRequest is the request body for updating a channel. It is a
+// merge patch: omitted fields are left unchanged and null clears a field,
+// except name, which can't be cleared.
+type UpdateChannelRequest struct {
+	Name            patchField[string] `json:"name"`
+	Topic           patchField[string] `json:"topic"`
+	SlowModeSeconds patchField[int]    `json:"slow_mode_seconds"`
+	ReadOnly        patchField[bool]   `json:"read_only"`
+}
+
+// MessageDeletedEvent tells clients in a channel to remove a message from view
+type MessageDeletedEvent struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+}
+
+// MessageEditedEvent tells clients in a channel to replace a message's content
+type MessageEditedEvent struct {
+	Frame
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+// ChannelUpdateEvent is broadcast to all WebSocket clients when a channel changes
+type ChannelUpdateEvent struct {
+	Frame
+	ChannelID       string `json:"channel_id"`
+	OldName         string `json:"old_name"`
+	Name            string `json:"name"`
+	SlowModeSeconds int    `json:"slow_mode_seconds"`
+	ReadOnly        bool   `json:"read_only"`
+	Topic           string `json:"topic"`
+}
+
+// ChannelClearedEvent is broadcast to a channel's clients when its history is deleted
+type ChannelClearedEvent struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+}
+
+// ClearMessagesResponse reports how many messages a history clear removed
+type ClearMessagesResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// EditMessageRequest is the request body for editing a message
+type EditMessageRequest struct {
 	Content string `json:"content"`
 	Author  string `json:"author"`
 }
 
 // PaginatedMessages is the response for paginated message retrieval
 type PaginatedMessages struct {
-	Messages []Message `json:"messages"`
-	Page     int       `json:"page"`
-	Limit    int       `json:"limit"`
-	Total    int       `json:"total"`
+	Messages   []Message `json:"messages"`
+	Page       int       `json:"page,omitempty"`
+	Limit      int       `json:"limit"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// UserMessage is a message annotated with the name of its channel
+type UserMessage struct {
+	Message
+	ChannelName string `json:"channel_name"`
+}
+
+// PaginatedUserMessages is the response for a user's message history
+type PaginatedUserMessages struct {
+	Messages []UserMessage `json:"messages"`
+	Page     int           `json:"page"`
+	Limit    int           `json:"limit"`
+	Total    int           `json:"total"`
+}
+
+// ServerTime is the response for GET /api/time
+type ServerTime struct {
+	Time        string `json:"time"`
+	EpochMillis int64  `json:"epoch_ms"`
 }
 
 // API holds the state and handlers for the REST API
 type API struct {
-	mu          sync.RWMutex
-	channels    map[string]*Channel
-	messages    map[string][]Message
-	channelSeq  int
-	messageSeq  int
+	mu       sync.RWMutex
+	cfg      *Config
+	hub      *Hub
+	db       *db.DB
+	channels map[string]*Channel
+	messages map[string][]Message
+
+	// channelNames maps each normalized channel name to its channel's ID, so
+	// names stay unique without a database as well as with one
+	channelNames map[string]string
+
+	pins       map[string][]string
+	waiters    map[string]chan struct{}
+	threadSubs map[string]map[string]bool
+	drafts     map[draftKey]Draft
+	unfurler   *unfurler
+	cache      *responseCache
+	flags      []Flag
+
+	// customEmoji maps each custom emoji's name to it
+	customEmoji map[string]CustomEmoji
+
+	// users maps the lowercased names of registered users to them when
+	// there is no database to register them in
+	users map[string]UserResponse
+
+	channelSeq int
+	messageSeq int
+	flagSeq    int
+	userSeq    int
+
+	// audit holds the audit log when there is no database to write it to
+	audit    []AuditEntry
+	auditSeq int64
 }
 
-// NewAPI creates a new API instance
-func NewAPI() *API {
-	return &API{
-		channels: make(map[string]*Channel),
-		messages: make(map[string][]Message),
+// NewAPI creates a new API instance. Events are broadcast through hub, which
+// may be nil; a private hub with no clients is used instead, since the hub
+// also holds state such as slow mode that the API relies on.
+func NewAPI(cfg Config, hub *Hub) *API {
+	if hub == nil {
+		hub = NewHub()
+	}
+	a := &API{
+		cfg:          &cfg,
+		hub:          hub,
+		channels:     make(map[string]*Channel),
+		messages:     make(map[string][]Message),
+		channelNames: make(map[string]string),
+		customEmoji:  make(map[string]CustomEmoji),
+		users:        make(map[string]UserResponse),
+		pins:         make(map[string][]string),
+		waiters:      make(map[string]chan struct{}),
+		threadSubs:   make(map[string]map[string]bool),
+		drafts:       make(map[draftKey]Draft),
+		cache:        newResponseCache(cfg.CacheTTL),
+	}
+	if cfg.Unfurl {
+		a.unfurler = newUnfurler()
 	}
+	hub.react = a.setReaction
+	hub.catchUp = a.catchUp
+	return a
 }
 
 // RegisterRoutes sets up the API routes on the given mux
 func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/openapi.json", a.handleOpenAPI)
+	mux.HandleFunc("/api/config", a.handleConfig)
+	mux.HandleFunc("/api/time", a.handleTime)
+	mux.HandleFunc("/api/emoji", a.handleEmoji)
+	mux.HandleFunc("/api/emoji/custom", a.handleCustomEmoji)
 	mux.HandleFunc("/api/channels", a.handleChannels)
 	mux.HandleFunc("/api/channels/", a.handleChannelByID)
+	mux.HandleFunc("/api/users", a.handleUsers)
+	mux.HandleFunc("/api/users/", a.handleUserByName)
+	mux.HandleFunc("/api/messages/broadcast", a.handleBroadcast)
+	mux.HandleFunc("/api/flags", a.handleFlags)
+	mux.HandleFunc("/api/audit", a.handleAudit)
+	mux.HandleFunc("/api/stats", a.handleStats)
+	if a.cfg.DebugHub {
+		mux.HandleFunc("/debug/hub", a.handleDebugHub)
+	}
 }
 
 // handleChannels handles GET and POST /api/channels
@@ -79,7 +287,23 @@ func (a *API) handleChannels(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleChannelByID routes requests for /api/channels/:id and /api/channels/:id/messages
+// handleTime returns the server's clock so clients can correct for skew
+func (a *API) handleTime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, ServerTime{
+		Time:        now.Format(time.RFC3339Nano),
+		EpochMillis: now.UnixMilli(),
+	})
+}
+
+// handleChannelByID routes requests for /api/channels/:id and /api/channels/:id/messages.
+// :id is a channel ID or name:<name>; responses always carry the ID.
 func (a *API) handleChannelByID(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/channels/")
 	parts := strings.Split(path, "/")
@@ -91,11 +315,37 @@ func (a *API) handleChannelByID(w http.ResponseWriter, r *http.Request) {
 
 	channelID := parts[0]
 
+	if len(parts) == 1 && channelID == "trending" {
+		// /api/channels/trending
+		a.getTrendingChannels(w, r)
+		return
+	}
+
+	if name, ok := strings.CutPrefix(channelID, channelNamePrefix); ok {
+		if a.cfg.AutoCreateChannels && len(parts) == 2 && parts[1] == "messages" &&
+			r.Method == http.MethodPost && r.URL.Query().Get("create_channel") == "true" {
+			// POST /api/channels/name:<name>/messages?create_channel=true
+			a.sendMessageCreatingChannel(w, r, name)
+			return
+		}
+
+		// /api/channels/name:<name>/...
+		if channelID, ok = a.channelIDByName(name); !ok {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+	}
+
 	if len(parts) == 1 {
 		// /api/channels/:id
-		if r.Method == http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
 			a.getChannel(w, r, channelID)
-		} else {
+		case http.MethodPatch:
+			a.updateChannel(w, r, channelID)
+		case http.MethodDelete:
+			a.deleteChannel(w, r, channelID)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 		return
@@ -105,28 +355,298 @@ func (a *API) handleChannelByID(w http.ResponseWriter, r *http.Request) {
 		// /api/channels/:id/messages
 		switch r.Method {
 		case http.MethodGet:
-			a.getMessages(w, r, channelID)
+			if r.URL.Query().Get("count_only") == "true" {
+				a.countMessages(w, r, channelID)
+			} else {
+				a.getMessages(w, r, channelID)
+			}
+		case http.MethodHead:
+			a.countMessages(w, r, channelID)
 		case http.MethodPost:
 			a.sendMessage(w, r, channelID)
+		case http.MethodDelete:
+			a.clearMessages(w, r, channelID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "draft" {
+		// /api/channels/:id/draft
+		a.handleDraft(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "archive" {
+		// /api/channels/:id/archive
+		a.archiveMessages(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "pins" {
+		// /api/channels/:id/pins
+		a.handlePins(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "messages" && parts[2] == "poll" {
+		// /api/channels/:id/messages/poll
+		a.pollMessages(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "messages" && parts[2] == "since" {
+		// /api/channels/:id/messages/since
+		a.messagesSince(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "messages" && parts[2] == "ephemeral" {
+		// /api/channels/:id/messages/ephemeral
+		a.sendEphemeral(w, r, channelID)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "messages" && parts[2] != "" {
+		// /api/channels/:id/messages/:msgID
+		switch r.Method {
+		case http.MethodGet:
+			a.getMessage(w, r, channelID, parts[2])
+		case http.MethodPatch:
+			a.editMessage(w, r, channelID, parts[2])
+		case http.MethodDelete:
+			a.deleteMessage(w, r, channelID, parts[2])
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 		return
 	}
 
+	if len(parts) == 4 && parts[1] == "messages" && parts[3] == "reactions" {
+		// /api/channels/:id/messages/:msgID/reactions
+		a.listReactionAuthors(w, r, channelID, parts[2])
+		return
+	}
+
+	if len(parts) == 5 && parts[1] == "messages" && parts[3] == "reactions" && parts[4] == "toggle" {
+		// /api/channels/:id/messages/:msgID/reactions/toggle
+		a.toggleReaction(w, r, channelID, parts[2])
+		return
+	}
+
+	if len(parts) == 4 && parts[1] == "messages" && parts[2] != "" && parts[3] == "thread" {
+		// /api/channels/:id/messages/:msgID/thread
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.getThread(w, r, channelID, parts[2])
+		return
+	}
+
+	if len(parts) == 4 && parts[1] == "messages" && parts[2] != "" {
+		// /api/channels/:id/messages/:msgID/:action
+		a.handleMessageAction(w, r, channelID, parts[2], parts[3])
+		return
+	}
+
+	http.Error(w, "Not found", http.StatusNotFound)
+}
+
+// channelNamePrefix marks a channel route segment as a name rather than an ID
+const channelNamePrefix = "name:"
+
+// channelIDByName returns the ID of the channel with the given name,
+// compared after normalizing
+func (a *API) channelIDByName(name string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	id, ok := a.channelNames[normalizeChannelName(name)]
+	return id, ok
+}
+
+// channelNameTakenLocked reports whether a channel other than channelID
+// already has name, compared after normalizing
+func (a *API) channelNameTakenLocked(name, channelID string) bool {
+	id, ok := a.channelNames[normalizeChannelName(name)]
+	return ok && id != channelID
+}
+
+// indexChannelNameLocked adds a channel to the name index. A database from
+// before names were normalized may hold several channels with the same
+// normalized name; the oldest keeps it.
+func (a *API) indexChannelNameLocked(channel *Channel) {
+	key := normalizeChannelName(channel.Name)
+	if other, ok := a.channels[a.channelNames[key]]; ok && other.ID != channel.ID && other.CreatedAt.Before(channel.CreatedAt) {
+		return
+	}
+	a.channelNames[key] = channel.ID
+}
+
+// unindexChannelNameLocked removes a channel from the name index, handing
+// its name to any other channel that shares it
+func (a *API) unindexChannelNameLocked(channel *Channel) {
+	key := normalizeChannelName(channel.Name)
+	if a.channelNames[key] != channel.ID {
+		return
+	}
+	delete(a.channelNames, key)
+	for _, other := range a.channels {
+		if other.ID != channel.ID && normalizeChannelName(other.Name) == key {
+			a.indexChannelNameLocked(other)
+		}
+	}
+}
+
+// handleMessageAction routes POST /api/channels/:id/messages/:msgID/:action
+func (a *API) handleMessageAction(w http.ResponseWriter, r *http.Request, channelID, messageID, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "flag":
+		a.flagMessage(w, r, channelID, messageID)
+	case "hide":
+		a.setMessageHidden(w, r, channelID, messageID, true)
+	case "unhide":
+		a.setMessageHidden(w, r, channelID, messageID, false)
+	case "pin":
+		a.pinMessage(w, r, channelID, messageID)
+	case "unpin":
+		a.unpinMessage(w, r, channelID, messageID)
+	case "subscribe":
+		a.setThreadSubscription(w, r, channelID, messageID, true)
+	case "unsubscribe":
+		a.setThreadSubscription(w, r, channelID, messageID, false)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleUserByName routes requests for /api/users/:name and its subresources
+func (a *API) handleUserByName(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 0 || parts[0] == "" {
+		http.Error(w, "User name required", http.StatusBadRequest)
+		return
+	}
+
+	name := parts[0]
+
+	if len(parts) == 1 {
+		// /api/users/:name
+		if r.Method == http.MethodGet {
+			a.getUser(w, r, name)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "messages" {
+		// /api/users/:name/messages
+		if r.Method == http.MethodGet {
+			a.getUserMessages(w, r, name)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "recent-channels" {
+		// /api/users/:name/recent-channels
+		if r.Method == http.MethodGet {
+			a.getRecentChannels(w, r, name)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if len(parts) >= 2 && len(parts) <= 3 && parts[1] == "highlights" {
+		// /api/users/:name/highlights and /api/users/:name/highlights/:keyword
+		keyword := ""
+		if len(parts) == 3 {
+			if keyword = parts[2]; keyword == "" {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+		}
+		a.handleHighlights(w, r, name, keyword)
+		return
+	}
+
 	http.Error(w, "Not found", http.StatusNotFound)
 }
 
-// listChannels returns all channels
-func (a *API) listChannels(w http.ResponseWriter, _ *http.Request) {
+// channelPrefixLimit caps how many channels a ?prefix= lookup returns
+const channelPrefixLimit = 20
+
+// listChannels returns all channels, with their number in X-Total-Count, or
+// with ?prefix= the first channelPrefixLimit by name whose normalized name
+// starts with the prefix, for the channel switcher's autocomplete
+func (a *API) listChannels(w http.ResponseWriter, r *http.Request) {
+	if query := r.URL.Query(); query.Has("prefix") {
+		a.listChannelsByPrefix(w, normalizeChannelName(query.Get("prefix")))
+		return
+	}
+
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
+	setTotalCount(w, len(a.channels))
+	if body, ok := a.cache.get(channelListScope, "channels"); ok {
+		respondBody(w, body)
+		return
+	}
+
 	channels := make([]Channel, 0, len(a.channels))
 	for _, ch := range a.channels {
 		channels = append(channels, *ch)
 	}
 
+	a.respondCacheable(w, channelListScope, "channels", channels)
+}
+
+// listChannelsByPrefix responds with the channels matching a normalized
+// prefix, from the database's name index when persisting
+func (a *API) listChannelsByPrefix(w http.ResponseWriter, prefix string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	channels := []Channel{}
+	if a.db != nil {
+		stored, err := a.db.ListChannelsByPrefix(prefix, channelPrefixLimit)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		for _, c := range stored {
+			if ch, ok := a.channels[c.ID]; ok {
+				channels = append(channels, *ch)
+			}
+		}
+		respondJSON(w, http.StatusOK, channels)
+		return
+	}
+
+	for _, ch := range a.channels {
+		if strings.HasPrefix(normalizeChannelName(ch.Name), prefix) {
+			channels = append(channels, *ch)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return strings.ToLower(channels[i].Name) < strings.ToLower(channels[j].Name)
+	})
+	if len(channels) > channelPrefixLimit {
+		channels = channels[:channelPrefixLimit]
+	}
 	respondJSON(w, http.StatusOK, channels)
 }
 
@@ -138,6 +658,8 @@ func (a *API) createChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Names are stored normalized, as updateChannel stores them
+	req.Name = normalizeChannelName(req.Name)
 	if req.Name == "" {
 		http.Error(w, "Channel name is required", http.StatusBadRequest)
 		return
@@ -146,14 +668,20 @@ func (a *API) createChannel(w http.ResponseWriter, r *http.Request) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	a.channelSeq++
-	channel := &Channel{
-		ID:        strconv.Itoa(a.channelSeq),
-		Name:      req.Name,
-		CreatedAt: time.Now(),
+	if a.channelNameTakenLocked(req.Name, "") {
+		http.Error(w, "Channel name already in use", http.StatusConflict)
+		return
+	}
+
+	channel, err := a.createChannelLocked(req.Name, a.auditActor(r))
+	if errors.Is(err, db.ErrDuplicate) {
+		http.Error(w, "Channel name already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
 	}
-	a.channels[channel.ID] = channel
-	a.messages[channel.ID] = []Message{}
 
 	respondJSON(w, http.StatusCreated, channel)
 }
@@ -172,100 +700,980 @@ func (a *API) getChannel(w http.ResponseWriter, _ *http.Request, channelID strin
 	respondJSON(w, http.StatusOK, channel)
 }
 
-// getMessages returns messages for a channel with pagination
-func (a *API) getMessages(w http.ResponseWriter, r *http.Request, channelID string) {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
+// maxTopicLength is the longest channel topic allowed, in runes
+const maxTopicLength = 250
 
-	if _, ok := a.channels[channelID]; !ok {
-		http.Error(w, "Channel not found", http.StatusNotFound)
+// updateChannel applies a merge patch to a channel's name, topic, slow mode
+// and read-only flag, rejecting names already in use
+func (a *API) updateChannel(w http.ResponseWriter, r *http.Request, channelID string) {
+	var req UpdateChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Parse pagination params
-	page := 1
-	limit := 20
+	if !req.Name.Set && !req.Topic.Set && !req.SlowModeSeconds.Set && !req.ReadOnly.Set {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
 
-	if p := r.URL.Query().Get("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
+	if req.Name.Set {
+		req.Name.Value = normalizeChannelName(req.Name.Value)
+		if req.Name.Value == "" {
+			http.Error(w, "Channel name is required", http.StatusBadRequest)
+			return
 		}
 	}
 
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
-			limit = parsed
-		}
+	req.Topic.Value = strings.TrimSpace(req.Topic.Value)
+	if utf8.RuneCountInString(req.Topic.Value) > maxTopicLength {
+		http.Error(w, fmt.Sprintf("Topic exceeds maximum length of %d characters", maxTopicLength), http.StatusBadRequest)
+		return
 	}
 
-	messages := a.messages[channelID]
-	total := len(messages)
+	if req.SlowModeSeconds.Value < 0 {
+		http.Error(w, "Slow mode seconds must not be negative", http.StatusBadRequest)
+		return
+	}
 
-	// Calculate pagination
-	start := (page - 1) * limit
-	end := start + limit
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	if start >= total {
-		respondJSON(w, http.StatusOK, PaginatedMessages{
-			Messages: []Message{},
-			Page:     page,
-			Limit:    limit,
-			Total:    total,
-		})
+	channel, ok := a.channels[channelID]
+	if !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
 		return
 	}
 
-	if end > total {
-		end = total
+	update := db.ChannelUpdate{
+		Name:            req.Name.update(),
+		Topic:           req.Topic.update(),
+		SlowModeSeconds: req.SlowModeSeconds.update(),
+		ReadOnly:        req.ReadOnly.update(),
 	}
 
-	respondJSON(w, http.StatusOK, PaginatedMessages{
-		Messages: messages[start:end],
-		Page:     page,
-		Limit:    limit,
-		Total:    total,
-	})
-}
-
-// sendMessage sends a message to a channel
-func (a *API) sendMessage(w http.ResponseWriter, r *http.Request, channelID string) {
-	var req CreateMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if update.Name != nil && a.channelNameTakenLocked(*update.Name, channelID) {
+		http.Error(w, "Channel name already in use", http.StatusConflict)
 		return
 	}
 
-	if req.Content == "" {
-		http.Error(w, "Message content is required", http.StatusBadRequest)
-		return
+	audit := channelUpdateAudit(a.auditActor(r), channel, update)
+	if a.db != nil {
+		if err := a.db.UpdateChannel(channelID, update, audit...); err != nil {
+			respondStoreError(w, err)
+			return
+		}
 	}
+	a.recordAuditLocked(audit...)
 
-	if req.Author == "" {
-		http.Error(w, "Author is required", http.StatusBadRequest)
-		return
+	before := *channel
+	a.cache.invalidate(channelListScope)
+	if update.Name != nil {
+		a.unindexChannelNameLocked(channel)
+		channel.Name = *update.Name
+		a.indexChannelNameLocked(channel)
+	}
+	if update.Topic != nil {
+		channel.Topic = *update.Topic
+	}
+	if update.SlowModeSeconds != nil {
+		channel.SlowModeSeconds = *update.SlowModeSeconds
+		a.hub.slowMode.setCooldown(channelID, time.Duration(channel.SlowModeSeconds)*time.Second)
+	}
+	if update.ReadOnly != nil {
+		channel.ReadOnly = *update.ReadOnly
+		a.hub.readOnly.set(channelID, channel.ReadOnly)
+	}
+
+	if *channel != before {
+		a.broadcastAll(ChannelUpdateEvent{
+			Frame:           newFrame("channel_update"),
+			ChannelID:       channel.ID,
+			OldName:         before.Name,
+			Name:            channel.Name,
+			SlowModeSeconds: channel.SlowModeSeconds,
+			ReadOnly:        channel.ReadOnly,
+			Topic:           channel.Topic,
+		})
 	}
 
+	respondJSON(w, http.StatusOK, channel)
+}
+
+// deleteChannel deletes a channel along with all of its messages
+func (a *API) deleteChannel(w http.ResponseWriter, r *http.Request, channelID string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if _, ok := a.channels[channelID]; !ok {
+	channel, ok := a.channels[channelID]
+	if !ok {
 		http.Error(w, "Channel not found", http.StatusNotFound)
 		return
 	}
 
-	a.messageSeq++
+	audit := newAudit(a.auditActor(r), auditChannelDelete, channelID, "#"+channel.Name)
+	if a.db != nil {
+		if err := a.db.DeleteChannelCascade(channelID, audit); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.recordAuditLocked(audit)
+
+	a.dropMessagesLocked(channelID)
+	a.hub.slowMode.setCooldown(channelID, 0)
+	a.hub.readOnly.set(channelID, false)
+	for key := range a.drafts {
+		if key.channelID == channelID {
+			delete(a.drafts, key)
+		}
+	}
+	delete(a.messages, channelID)
+	a.notifyLocked(channelID)
+	a.cache.invalidate(channelID)
+	a.cache.invalidate(channelListScope)
+	a.unindexChannelNameLocked(channel)
+	delete(a.channels, channelID)
+	// Close frames are written without holding a.mu
+	go a.hub.closeChannel(channelID, websocket.CloseNormalClosure, "channel deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearMessages deletes every message in a channel, or with author=<name>
+// every message that author posted there, for cleaning up after spam. The
+// caller must pass confirm=true so a stray request can't wipe a channel's
+// history.
+func (a *API) clearMessages(w http.ResponseWriter, r *http.Request, channelID string) {
+	if r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "Pass confirm=true to delete messages", http.StatusBadRequest)
+		return
+	}
+
+	actor := a.auditActor(r)
+	if author := r.URL.Query().Get("author"); author != "" {
+		a.clearAuthorMessages(w, channelID, author, actor)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	deleted := len(a.messages[channelID])
+	audit := newAudit(actor, auditMessagesClear, channelID, fmt.Sprintf("%d messages", deleted))
+	if a.db != nil {
+		n, err := a.db.DeleteAllMessages(channelID, audit)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		deleted = int(n)
+	}
+	a.recordAuditLocked(audit)
+
+	a.dropMessagesLocked(channelID)
+	a.messages[channelID] = []Message{}
+	a.cache.invalidate(channelID)
+
+	a.broadcast(channelID, ChannelClearedEvent{
+		Frame:     newFrame("channel_cleared"),
+		ChannelID: channelID,
+	})
+
+	respondJSON(w, http.StatusOK, ClearMessagesResponse{Deleted: deleted})
+}
+
+// clearAuthorMessages deletes an author's messages in a channel, hidden ones
+// included, and tells clients to remove each of them
+func (a *API) clearAuthorMessages(w http.ResponseWriter, channelID, author, actor string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	count := len(messagesByAuthor(a.messages[channelID], author))
+	audit := newAudit(actor, auditMessagesByAuthor, channelID, fmt.Sprintf("%d messages by %s", count, author))
+	if a.db != nil {
+		if _, err := a.db.DeleteMessagesByAuthor(channelID, author, audit); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.recordAuditLocked(audit)
+
+	kept := a.messages[channelID][:0]
+	removed := make(map[string]bool)
+	for _, m := range a.messages[channelID] {
+		if m.Author != author {
+			kept = append(kept, m)
+			continue
+		}
+		removed[m.ID] = true
+		a.removePin(channelID, m.ID)
+		delete(a.threadSubs, m.ID)
+		a.broadcast(channelID, MessageDeletedEvent{
+			Frame:     newFrame("message_deleted"),
+			ChannelID: channelID,
+			MessageID: m.ID,
+		})
+	}
+	clear(a.messages[channelID][len(kept):])
+	a.messages[channelID] = kept
+	a.cache.invalidate(channelID)
+
+	flags := a.flags[:0]
+	for _, f := range a.flags {
+		if !removed[f.MessageID] {
+			flags = append(flags, f)
+		}
+	}
+	a.flags = flags
+
+	respondJSON(w, http.StatusOK, ClearMessagesResponse{Deleted: len(removed)})
+}
+
+// dropMessagesLocked forgets the thread subscriptions, pins and flags that
+// belong to a channel's messages. Callers must hold a.mu.
+func (a *API) dropMessagesLocked(channelID string) {
+	for _, m := range a.messages[channelID] {
+		delete(a.threadSubs, m.ID)
+	}
+	delete(a.pins, channelID)
+
+	flags := a.flags[:0]
+	for _, f := range a.flags {
+		if f.ChannelID != channelID {
+			flags = append(flags, f)
+		}
+	}
+	a.flags = flags
+}
+
+// getMessages returns messages for a channel with pagination, oldest first
+// or newest first with order=desc. The author, after, before and contains
+// params narrow the results, combined with AND. A fields param, such as fields=id,content,author,
+// limits each message to the named fields to save bandwidth. A viewer param
+// marks each reaction with whether that user gave it.
+//
+// Offset mode (?page=) counts from the start of the ordering, so with
+// order=desc a message posted between requests shifts every later page and
+// the client sees a repeat. Cursor mode (?cursor=) avoids this: each page
+// carries next_cursor, an opaque token for the position of its last message,
+// and the next page starts right after it whatever has been posted since. In
+// cursor mode Total counts the messages remaining after the cursor.
+func (a *API) getMessages(w http.ResponseWriter, r *http.Request, channelID string) {
+	query := r.URL.Query()
+
+	var loc *time.Location
+	if tz := query.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, "Unknown timezone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "Order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	desc := order == "desc"
+
+	fields, err := parseFields(query.Get("fields"))
+	if err != nil {
+		http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseMessageFilter(query)
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if wantsStream(r) {
+		a.streamMessages(w, r, channelID, loc, desc, fields, filter)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	page, limit, err := a.parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Cursor = (*db.Cursor)(&c)
+		filter.Reverse = desc
+	}
+
+	// Only the plain first page is cached, since that is what polling
+	// clients ask for over and over
+	cacheKey := ""
+	if page == 1 && cursor == "" && fields == nil && loc == nil && !narrows(filter) && !filter.IncludeHidden && !filter.IncludeArchived && query.Get("viewer") == "" {
+		cacheKey = fmt.Sprintf("messages?limit=%d&desc=%t", limit, desc)
+		if body, ok := a.cache.get(channelID, cacheKey); ok {
+			respondBody(w, body)
+			return
+		}
+	}
+
+	// A cursor page is read from the cursor onwards, and Total counts what
+	// remains after it; a numbered page is cut from the whole listing
+	var messages []Message
+	start, total := 0, 0
+	if filter.Cursor != nil {
+		page = 0
+		if messages, err = a.pageMessagesLocked(channelID, filter, limit); err == nil {
+			total, err = a.countMessagesLocked(channelID, filter)
+		}
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	} else {
+		all, err := a.filterMessagesLocked(channelID, filter)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		if desc {
+			all = reversedMessages(all)
+		}
+		total = len(all)
+		start = min((page-1)*limit, total)
+		messages = all[start:min(start+limit, total)]
+	}
+	end := start + len(messages)
+
+	results := localizeMessages(append([]Message{}, messages...), loc)
+	results = reactionsForViewer(results, query.Get("viewer"))
+	a.resolveRefsLocked(results)
+
+	resp := PaginatedMessages{
+		Messages: results,
+		Page:     page,
+		Limit:    limit,
+		Total:    total,
+	}
+	if end < total && len(messages) > 0 {
+		resp.NextCursor = encodeCursor(cursorOf(messages[len(messages)-1]))
+	}
+	if fields != nil {
+		projected, err := projectPage(resp, fields)
+		if err != nil {
+			http.Error(w, "Failed to encode messages", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, projected)
+		return
+	}
+	if cacheKey != "" {
+		a.respondCacheable(w, channelID, cacheKey, resp)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// getUserMessages returns messages by an author across all channels, newest
+// first. When persisting, the page is read with db.ListMessagesByAuthor
+// rather than by scanning every channel.
+func (a *API) getUserMessages(w http.ResponseWriter, r *http.Request, author string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	page, limit, err := a.parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if a.db != nil {
+		messages, total, err := a.storedUserMessagesLocked(author, limit, (page-1)*limit)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, PaginatedUserMessages{
+			Messages: messages,
+			Page:     page,
+			Limit:    limit,
+			Total:    total,
+		})
+		return
+	}
+
+	var messages []UserMessage
+	for channelID, channelMessages := range a.messages {
+		channel, ok := a.channels[channelID]
+		if !ok {
+			continue
+		}
+		for _, m := range channelMessages {
+			if m.Author == author && !m.Hidden {
+				messages = append(messages, UserMessage{Message: m, ChannelName: channel.Name})
+			}
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+
+	total := len(messages)
+	start := (page - 1) * limit
+	end := start + limit
+
+	if start >= total {
+		respondJSON(w, http.StatusOK, PaginatedUserMessages{
+			Messages: []UserMessage{},
+			Page:     page,
+			Limit:    limit,
+			Total:    total,
+		})
+		return
+	}
+
+	if end > total {
+		end = total
+	}
+
+	respondJSON(w, http.StatusOK, PaginatedUserMessages{
+		Messages: messages[start:end],
+		Page:     page,
+		Limit:    limit,
+		Total:    total,
+	})
+}
+
+// storedUserMessagesLocked returns a page of an author's messages from the
+// database, and how many there are in all. Each message is taken from
+// memory when it is there, so it carries reactions and other state the
+// database rows don't. Callers must hold a.mu.
+func (a *API) storedUserMessagesLocked(author string, limit, offset int) ([]UserMessage, int, error) {
+	stored, err := a.db.ListMessagesByAuthor(author, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := a.db.CountMessagesByAuthor(author)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	messages := make([]UserMessage, 0, len(stored))
+	for _, m := range stored {
+		message := messageFromDB(m.Message)
+		if i := a.findMessage(m.ChannelID, m.ID); i >= 0 {
+			message = a.messages[m.ChannelID][i]
+		}
+		messages = append(messages, UserMessage{Message: message, ChannelName: m.ChannelName})
+	}
+	return messages, total, nil
+}
+
+// sendMessage sends a message to a channel. With an X-If-Empty: true header
+// the message is only posted if the channel has no messages besides
+// notices, hidden ones included, so a bot can post a one-time intro without racing other writers.
+// With ?dry_run=true the message is validated and processed but only
+// returned, for compose previews: it isn't stored or broadcast, has no ID,
+// and doesn't count against slow mode.
+func (a *API) sendMessage(w http.ResponseWriter, r *http.Request, channelID string) {
+	a.postMessage(w, r, channelID, "")
+}
+
+// sendMessageCreatingChannel sends a message as sendMessage does to the
+// channel named name, creating the channel first if there is none, for bots
+// that post to well-known channels. The channel and message are stored
+// together, and the response carries both.
+func (a *API) sendMessageCreatingChannel(w http.ResponseWriter, r *http.Request, name string) {
+	name = normalizeChannelName(name)
+	if name == "" {
+		http.Error(w, "Channel name is required", http.StatusBadRequest)
+		return
+	}
+	a.postMessage(w, r, "", name)
+}
+
+// postMessage implements sendMessage and sendMessageCreatingChannel. When
+// createName is set the channel is looked up by that name under the lock
+// rather than by channelID, and created if missing.
+func (a *API) postMessage(w http.ResponseWriter, r *http.Request, channelID, createName string) {
+	var req CreateMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	content, err := a.cfg.sanitizeContent(req.Content)
+	if err != nil {
+		http.Error(w, "Message content "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Content = expandEmoji(content)
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.cfg.contentTooLong(req.Content) {
+		http.Error(w, fmt.Sprintf("Message content exceeds maximum length of %d characters", a.cfg.MaxMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRefs(req.Refs); err != nil {
+		http.Error(w, "Invalid refs: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseMetadata(req.Metadata)
+	if err != nil {
+		http.Error(w, "Invalid metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	isBot, err := a.cfg.botAuthor(a.cfg.botFromRequest(r), req.Author)
+	if err != nil {
+		http.Error(w, "Invalid bot token", http.StatusUnauthorized)
+		return
+	}
+
+	if err := checkSubtype(req.Subtype, isBot); err != nil {
+		http.Error(w, "Invalid subtype: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	create := false
+	if createName != "" {
+		id, ok := a.channelNames[createName]
+		channelID, create = id, !ok
+	}
+	if _, ok := a.channels[channelID]; !ok && !create {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	ifEmpty := r.Header.Get("X-If-Empty") == "true"
+	if ifEmpty && a.hasUserMessagesLocked(channelID) {
+		http.Error(w, "Channel is not empty", http.StatusConflict)
+		return
+	}
+
+	if !a.hub.readOnly.allows(channelID, isBot) {
+		http.Error(w, "Channel is read-only", http.StatusForbidden)
+		return
+	}
+
+	var parent *Message
+	if req.ParentID != "" {
+		i := a.findMessage(channelID, req.ParentID)
+		if i < 0 {
+			http.Error(w, "Parent message not found", http.StatusBadRequest)
+			return
+		}
+		parent = &a.messages[channelID][i]
+		if parent.ParentID != "" {
+			http.Error(w, "Cannot reply to a reply", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Slow mode is only charged once the message is stored, so a failed or
+	// dry-run post doesn't hold back the author's next one
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	if !isBot {
+		if wait, ok := a.hub.slowMode.check(channelID, req.Author); !ok {
+			respondRateLimited(w, limitSlowMode, wait)
+			return
+		}
+	}
+
+	if dryRun {
+		respondJSON(w, http.StatusOK, Message{
+			ChannelID: channelID,
+			Content:   req.Content,
+			Author:    req.Author,
+			ParentID:  req.ParentID,
+			IsBot:     isBot,
+			Refs:      req.Refs,
+			Metadata:  metadata,
+			Subtype:   req.Subtype,
+			CreatedAt: time.Now(),
+		})
+		return
+	}
+
+	// The parent's author follows the thread from its first reply
+	if parent != nil {
+		if _, ok := a.threadSubs[parent.ID]; !ok {
+			a.subscribeLocked(parent.ID, parent.Author)
+		}
+	}
+
 	message := Message{
-		ID:        strconv.Itoa(a.messageSeq),
 		ChannelID: channelID,
 		Content:   req.Content,
 		Author:    req.Author,
-		CreatedAt: time.Now(),
+		ParentID:  req.ParentID,
+		IsBot:     isBot,
+		Refs:      req.Refs,
+		Metadata:  metadata,
+		Subtype:   req.Subtype,
+	}
+	var channel *Channel
+	if create {
+		var created []Message
+		channel, created, err = a.createChannelWithMessagesLocked(createName, a.auditActor(r), []Message{message})
+		if err == nil {
+			message, channelID = created[0], channel.ID
+		}
+	} else {
+		message, err = a.appendMessageLocked(message, ifEmpty)
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	if !isBot {
+		a.hub.slowMode.allow(channelID, message.Author)
 	}
-	a.messages[channelID] = append(a.messages[channelID], message)
+	a.publishMessageLocked(message)
+	a.hub.notifyHighlights(channelID, message.ID, message.Author, message.Content)
+	a.hub.activity.touch(message.Author)
+	a.clearSentDraftLocked(channelID, message.Author)
+	a.unfurlLocked(message)
+	log.Printf("Message sent to channel %s by %s (%s)", channelID, message.Author, clientIP(r, a.cfg.TrustedProxies))
 
+	if createName != "" {
+		if channel == nil {
+			channel = a.channels[channelID]
+		}
+		respondJSON(w, http.StatusCreated, ChannelMessageResponse{Channel: channel, Message: message, Created: create})
+		return
+	}
 	respondJSON(w, http.StatusCreated, message)
 }
 
+// paginationError reports a page or limit query param that is present but
+// invalid. Absent params fall back to defaults instead.
+type paginationError struct {
+	// Param is "page" or "limit"
+	Param string
+	Value string
+
+	// Max is the largest limit allowed, or zero for page errors
+	Max int
+}
+
+func (e *paginationError) Error() string {
+	if e.Max > 0 {
+		return fmt.Sprintf("Invalid %s %q: must be an integer from 1 to %d", e.Param, e.Value, e.Max)
+	}
+	return fmt.Sprintf("Invalid %s %q: must be a positive integer", e.Param, e.Value)
+}
+
+// parsePagination reads the page and limit query params, falling back to
+// defaults when they are absent. A page below 1, or a limit outside 1 to
+// Config.MaxPageSize, is a *paginationError rather than being clamped, so
+// client bugs surface.
+func (a *API) parsePagination(r *http.Request) (page, limit int, err error) {
+	page = 1
+	limit = a.cfg.DefaultPageSize
+
+	if p := r.URL.Query().Get("page"); p != "" {
+		parsed, err := strconv.Atoi(p)
+		if err != nil || parsed < 1 {
+			return 0, 0, &paginationError{Param: "page", Value: p}
+		}
+		page = parsed
+	}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > a.cfg.MaxPageSize {
+			return 0, 0, &paginationError{Param: "limit", Value: l, Max: a.cfg.MaxPageSize}
+		}
+		limit = parsed
+	}
+
+	return page, limit, nil
+}
+
+// localizeMessages returns copies of messages with CreatedAtLocal set for
+// loc, keeping CreatedAt in UTC. A nil loc returns messages unchanged.
+func localizeMessages(messages []Message, loc *time.Location) []Message {
+	if loc == nil {
+		return messages
+	}
+
+	localized := make([]Message, len(messages))
+	for i, m := range messages {
+		m.CreatedAt = m.CreatedAt.UTC()
+		m.CreatedAtLocal = m.CreatedAt.In(loc).Format(time.RFC3339)
+		localized[i] = m
+	}
+	return localized
+}
+
+// reversedMessages returns a copy of messages in reverse order
+func reversedMessages(messages []Message) []Message {
+	reversed := make([]Message, len(messages))
+	for i, m := range messages {
+		reversed[len(messages)-1-i] = m
+	}
+	return reversed
+}
+
+// messagesByAuthor returns the messages posted by author
+func messagesByAuthor(messages []Message, author string) []Message {
+	matching := make([]Message, 0)
+	for _, m := range messages {
+		if m.Author == author {
+			matching = append(matching, m)
+		}
+	}
+	return matching
+}
+
+// visibleMessages returns the messages that have not been hidden by moderation
+func visibleMessages(messages []Message) []Message {
+	visible := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		if !m.Hidden {
+			visible = append(visible, m)
+		}
+	}
+	return visible
+}
+
+// findMessage returns the index of a message within its channel's slice, or -1.
+// Callers must hold a.mu.
+func (a *API) findMessage(channelID, messageID string) int {
+	for i, m := range a.messages[channelID] {
+		if m.ID == messageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// getMessage returns a single message, including how long it remains
+// editable. A message hidden by moderation is not found unless
+// ?include_hidden=true, as in getMessages.
+func (a *API) getMessage(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	includeHidden := r.URL.Query().Get("include_hidden") == "true"
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 || a.messages[channelID][i].Hidden && !includeHidden {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	message := a.messages[channelID][i]
+	detail := MessageDetail{Message: message}
+	if remaining, limited := a.cfg.editableFor(message.CreatedAt); limited {
+		secs := int(remaining.Seconds())
+		detail.EditableSeconds = &secs
+	}
+
+	respondJSON(w, http.StatusOK, detail)
+}
+
+// editMessage replaces a message's content if the edit window has not passed
+func (a *API) editMessage(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	var req EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	content, err := a.cfg.sanitizeContent(req.Content)
+	if err != nil {
+		http.Error(w, "Message content "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Content = expandEmoji(content)
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.cfg.contentTooLong(req.Content) {
+		http.Error(w, fmt.Sprintf("Message content exceeds maximum length of %d characters", a.cfg.MaxMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	message := &a.messages[channelID][i]
+	if req.Author != message.Author {
+		http.Error(w, "Only the author can edit this message", http.StatusForbidden)
+		return
+	}
+
+	if remaining, limited := a.cfg.editableFor(message.CreatedAt); limited && remaining == 0 {
+		http.Error(w, "Edit window has expired", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	if a.db != nil {
+		if err := a.db.EditMessage(messageID, req.Content, now); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+
+	message.Content = req.Content
+	message.EditedAt = &now
+	a.cache.invalidate(channelID)
+
+	a.broadcast(channelID, MessageEditedEvent{
+		Frame:     newFrame("message_edited"),
+		ChannelID: channelID,
+		MessageID: messageID,
+		Content:   message.Content,
+		EditedAt:  now,
+	})
+
+	respondJSON(w, http.StatusOK, message)
+}
+
+// deleteMessage permanently deletes a message. Only its author, given as the
+// author query param, may delete it; moderators hide messages instead.
+func (a *API) deleteMessage(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("author") != a.messages[channelID][i].Author {
+		http.Error(w, "Only the author can delete this message", http.StatusForbidden)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.DeleteMessage(messageID); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+
+	a.messages[channelID] = append(a.messages[channelID][:i], a.messages[channelID][i+1:]...)
+	a.cache.invalidate(channelID)
+	a.removePin(channelID, messageID)
+	delete(a.threadSubs, messageID)
+
+	flags := a.flags[:0]
+	for _, f := range a.flags {
+		if f.MessageID != messageID {
+			flags = append(flags, f)
+		}
+	}
+	a.flags = flags
+
+	a.broadcast(channelID, MessageDeletedEvent{
+		Frame:     newFrame("message_deleted"),
+		ChannelID: channelID,
+		MessageID: messageID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeChannelName lowercases a channel name and joins its words with hyphens
+func normalizeChannelName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// broadcast sends an event to the WebSocket clients in a channel
+func (a *API) broadcast(channelID string, event any) {
+	if a.hub == nil {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal event: %v", err)
+		return
+	}
+	a.hub.Broadcast(channelID, data)
+}
+
+// broadcastAll sends an event to every connected WebSocket client
+func (a *API) broadcastAll(event any) {
+	if a.hub == nil {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal event: %v", err)
+		return
+	}
+	a.hub.BroadcastAll(data)
+}
+
 // respondJSON writes a JSON response
 func respondJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ArchiveMessagesRequest is the request body for archiving a channel's old
+// messages
+type ArchiveMessagesRequest struct {
+	// Before is the cutoff: messages created before it are archived
+	Before time.Time `json:"before"`
+}
+
+// ArchiveMessagesResponse reports how many messages an archive moved
+type ArchiveMessagesResponse struct {
+	Archived int `json:"archived"`
+}
+
+// archiveMessages handles POST /api/channels/:id/archive, moving the
+// channel's messages created before a cutoff to cold storage so that large
+// channels stay fast. Archived messages leave memory too; getMessages reads
+// them back from the database with ?include_archived=true, without their
+// reactions, link previews or refs. Pinned messages are never archived.
+// Archiving needs a database, since that is where archived messages live.
+func (a *API) archiveMessages(w http.ResponseWriter, r *http.Request, channelID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ArchiveMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Before.IsZero() {
+		http.Error(w, "Before is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.db == nil {
+		http.Error(w, "Archiving requires a database", http.StatusNotImplemented)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	pinned := a.pins[channelID]
+	count := 0
+	for _, m := range a.messages[channelID] {
+		if m.CreatedAt.Before(req.Before) && !slices.Contains(pinned, m.ID) {
+			count++
+		}
+	}
+
+	audit := newAudit(a.auditActor(r), auditMessagesArchive, channelID,
+		fmt.Sprintf("%d messages before %s", count, req.Before.UTC().Format(time.RFC3339)))
+	n, err := a.db.ArchiveOldMessages(channelID, req.Before, audit)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	a.recordAuditLocked(audit)
+
+	kept := a.messages[channelID][:0]
+	archived := make(map[string]bool)
+	for _, m := range a.messages[channelID] {
+		if !m.CreatedAt.Before(req.Before) || slices.Contains(pinned, m.ID) {
+			kept = append(kept, m)
+			continue
+		}
+		archived[m.ID] = true
+		delete(a.threadSubs, m.ID)
+	}
+	clear(a.messages[channelID][len(kept):])
+	a.messages[channelID] = kept
+	a.cache.invalidate(channelID)
+
+	flags := a.flags[:0]
+	for _, f := range a.flags {
+		if !archived[f.MessageID] {
+			flags = append(flags, f)
+		}
+	}
+	a.flags = flags
+
+	respondJSON(w, http.StatusOK, ArchiveMessagesResponse{Archived: int(n)})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// Audited administrative actions
+const (
+	auditChannelCreate    = "channel.create"
+	auditChannelRename    = "channel.rename"
+	auditChannelUpdate    = "channel.update"
+	auditChannelDelete    = "channel.delete"
+	auditMessageHide      = "message.hide"
+	auditMessageUnhide    = "message.unhide"
+	auditMessagesClear    = "messages.clear"
+	auditMessagesByAuthor = "messages.delete_by_author"
+	auditMessagesArchive  = "messages.archive"
+)
+
+// auditActorSystem is the actor for actions the server takes on its own,
+// such as hiding a message that reached the flag threshold
+const auditActorSystem = "system"
+
+// AuditEntry records one administrative action: who did what to which
+// channel or message, and when
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PaginatedAuditEntries is the response for GET /api/audit
+type PaginatedAuditEntries struct {
+	Entries []AuditEntry `json:"entries"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+	Total   int          `json:"total"`
+}
+
+// auditActor names who made a request: the bot its token authenticates, or
+// else the X-Actor header. Like author fields, X-Actor is taken on trust.
+func (a *API) auditActor(r *http.Request) string {
+	if bot := a.cfg.botFromRequest(r); bot != "" {
+		return bot
+	}
+	if actor := strings.TrimSpace(r.Header.Get("X-Actor")); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// newAudit describes an action taken by actor on target
+func newAudit(actor, action, target, detail string) db.AuditEntry {
+	return db.AuditEntry{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+}
+
+// channelUpdateAudit describes what update changes about channel: a rename
+// entry if the name changes, and an update entry listing any other settings
+// that change
+func channelUpdateAudit(actor string, channel *Channel, update db.ChannelUpdate) []db.AuditEntry {
+	var entries []db.AuditEntry
+	if update.Name != nil && *update.Name != channel.Name {
+		entries = append(entries, newAudit(actor, auditChannelRename, channel.ID, "#"+channel.Name+" to #"+*update.Name))
+	}
+
+	var changes []string
+	if update.Topic != nil && *update.Topic != channel.Topic {
+		changes = append(changes, fmt.Sprintf("topic=%q", *update.Topic))
+	}
+	if update.SlowModeSeconds != nil && *update.SlowModeSeconds != channel.SlowModeSeconds {
+		changes = append(changes, fmt.Sprintf("slow_mode_seconds=%d", *update.SlowModeSeconds))
+	}
+	if update.ReadOnly != nil && *update.ReadOnly != channel.ReadOnly {
+		changes = append(changes, fmt.Sprintf("read_only=%t", *update.ReadOnly))
+	}
+	if len(changes) > 0 {
+		entries = append(entries, newAudit(actor, auditChannelUpdate, channel.ID, strings.Join(changes, ", ")))
+	}
+	return entries
+}
+
+// recordAuditLocked keeps audit entries in memory when there is no database.
+// When persisting it does nothing: the entries were written in the audited
+// action's transaction. Callers must hold a.mu.
+func (a *API) recordAuditLocked(entries ...db.AuditEntry) {
+	if a.db != nil {
+		return
+	}
+	for _, e := range entries {
+		a.auditSeq++
+		e.ID = a.auditSeq
+		a.audit = append(a.audit, AuditEntry(e))
+	}
+}
+
+// handleAudit handles GET /api/audit, listing administrative actions newest
+// first for moderators, optionally only those with the given action
+func (a *API) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	page, limit, err := a.parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := (page - 1) * limit
+
+	resp := PaginatedAuditEntries{Entries: []AuditEntry{}, Page: page, Limit: limit}
+
+	if a.db != nil {
+		entries, total, err := a.db.ListAudit(action, limit, offset)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		for _, e := range entries {
+			resp.Entries = append(resp.Entries, AuditEntry(e))
+		}
+		resp.Total = total
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var matched []AuditEntry
+	for i := len(a.audit) - 1; i >= 0; i-- {
+		if action == "" || a.audit[i].Action == action {
+			matched = append(matched, a.audit[i])
+		}
+	}
+	resp.Total = len(matched)
+	resp.Entries = append(resp.Entries, matched[min(offset, len(matched)):min(offset+limit, len(matched))]...)
+	respondJSON(w, http.StatusOK, resp)
+}
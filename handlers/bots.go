@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// botAuthScheme prefixes the bot token in the Authorization header
+const botAuthScheme = "Bot "
+
+// errInvalidBotToken is returned when a post uses a bot's author name
+// without presenting that bot's token
+var errInvalidBotToken = errors.New("invalid bot token")
+
+// LoadBotTokens reads bot credentials from a file with one "author token"
+// pair per line. Blank lines and lines starting with # are ignored.
+func LoadBotTokens(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"author token\"", path, line)
+		}
+		if _, ok := tokens[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate bot %q", path, line, fields[0])
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	return tokens, scanner.Err()
+}
+
+// botFromRequest returns the bot whose token the request presents, or "" if
+// it presents none or an unknown one
+func (c *Config) botFromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, botAuthScheme) {
+		return ""
+	}
+	token := []byte(strings.TrimPrefix(header, botAuthScheme))
+
+	for author, want := range c.BotTokens {
+		if subtle.ConstantTimeCompare(token, []byte(want)) == 1 {
+			return author
+		}
+	}
+	return ""
+}
+
+// isBot reports whether the name belongs to a configured bot
+func (c *Config) isBot(name string) bool {
+	_, ok := c.BotTokens[name]
+	return ok
+}
+
+// botAuthor reports whether author posts as a bot, given the bot
+// authenticated on the request. Bot names are reserved, so claiming one
+// without its token fails with errInvalidBotToken.
+func (c *Config) botAuthor(bot, author string) (bool, error) {
+	if !c.isBot(author) {
+		return false, nil
+	}
+	if author != bot {
+		return false, errInvalidBotToken
+	}
+	return true, nil
+}
+
+// UserResponse is the response for GET /api/users/:name and POST /api/users
+type UserResponse struct {
+	Name  string `json:"name"`
+	IsBot bool   `json:"is_bot"`
+
+	// ID and CreatedAt are set for registered users, whose Name keeps the
+	// case they registered with
+	ID        string     `json:"id,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// LastActiveAt is when the user last sent a message or WebSocket frame;
+	// omitted if they never have
+	LastActiveAt *time.Time `json:"last_active_at,omitempty"`
+}
+
+// getUser returns what the server knows about an author, including their
+// registration if the name, ignoring case, is registered
+func (a *API) getUser(w http.ResponseWriter, _ *http.Request, name string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, err := a.registeredUserLocked(name)
+	if errors.Is(err, db.ErrNotFound) {
+		user, err = UserResponse{Name: name}, nil
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	user.IsBot = a.cfg.isBot(name)
+	user.LastActiveAt = a.hub.activity.get(name)
+	respondJSON(w, http.StatusOK, user)
+}
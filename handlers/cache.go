@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// channelListScope is the cache scope of the channel list. Channel IDs are
+// never empty, so it can't collide with a channel's scope.
+const channelListScope = ""
+
+// responseCache keeps encoded JSON responses for the hot read endpoints,
+// the channel list and the first page of a channel's messages, so repeated
+// polls and dashboard refreshes skip copying and encoding. Entries are
+// grouped by scope, a channel ID or channelListScope, and writes to a
+// channel invalidate its scope at once.
+//
+// Entries are stored while a.mu is read-locked and invalidated while it is
+// write-locked, so an entry can't be stored from state older than the last
+// invalidation. Changes that show up in a page without writing to its
+// channel, such as an edit to a message it references, aren't tracked;
+// the TTL bounds how long those stay stale.
+//
+// A nil *responseCache is valid and caches nothing.
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string]cacheEntry
+}
+
+// cacheEntry is one encoded response
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// newResponseCache returns a cache whose entries live for ttl, or nil if ttl
+// is not positive
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &responseCache{ttl: ttl, entries: make(map[string]map[string]cacheEntry)}
+}
+
+// get returns the unexpired response stored under scope and key
+func (c *responseCache) get(scope, key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[scope][key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.body, true
+}
+
+// put stores body under scope and key. Callers must hold a.mu for reading.
+func (c *responseCache) put(scope, key string, body []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[scope] == nil {
+		c.entries[scope] = make(map[string]cacheEntry)
+	}
+	c.entries[scope][key] = cacheEntry{body: body, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate drops every response stored under scope. Callers must hold
+// a.mu for writing.
+func (c *responseCache) invalidate(scope string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, scope)
+}
+
+// respondCacheable writes data as respondJSON does with a 200, storing the
+// encoded body under scope and key
+func (a *API) respondCacheable(w http.ResponseWriter, scope, key string, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+	a.cache.put(scope, key, body)
+	respondBody(w, body)
+}
+
+// respondBody writes an already encoded JSON body with a 200
+func respondBody(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
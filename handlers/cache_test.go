@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCachingAPI returns a test API whose cache entries outlive the test
+// and a mux serving its routes
+func newTestCachingAPI(t *testing.T, persist bool) (*API, *http.ServeMux) {
+	t.Helper()
+	a := newTestAPI(t, persist)
+	a.cache = newResponseCache(time.Hour)
+	mux := http.NewServeMux()
+	a.RegisterRoutes(mux)
+	return a, mux
+}
+
+// serveTest sends a request through mux and returns the response
+func serveTest(mux *http.ServeMux, method, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	return w
+}
+
+func TestMessagesFirstPageCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(channelID, messageID string) (method, url, body string)
+		// want is text the first page must show, or lose if missing is set
+		want    string
+		missing bool
+	}{
+		{"send", func(channelID, _ string) (string, string, string) {
+			return http.MethodPost, "/api/channels/" + channelID + "/messages", `{"author":"bob","content":"brand new"}`
+		}, "brand new", false},
+		{"edit", func(channelID, messageID string) (string, string, string) {
+			return http.MethodPatch, "/api/channels/" + channelID + "/messages/" + messageID, `{"author":"alice","content":"edited hello"}`
+		}, "edited hello", false},
+		{"delete", func(channelID, messageID string) (string, string, string) {
+			return http.MethodDelete, "/api/channels/" + channelID + "/messages/" + messageID + "?author=alice", ""
+		}, "original hello", true},
+	}
+	for _, persist := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run("persist="+strconv.FormatBool(persist)+"/"+tt.name, func(t *testing.T) {
+				a, mux := newTestCachingAPI(t, persist)
+				channel := newTestChannel(t, a, "general")
+				message := postTestMessages(t, a, channel.ID, "original hello")[0]
+				page := "/api/channels/" + channel.ID + "/messages"
+
+				first := serveTest(mux, http.MethodGet, page, "")
+				if first.Code != http.StatusOK {
+					t.Fatalf("GET = %d %s", first.Code, first.Body)
+				}
+				if cached := serveTest(mux, http.MethodGet, page, ""); cached.Body.String() != first.Body.String() {
+					t.Fatalf("second GET = %s, want the cached %s", cached.Body, first.Body)
+				}
+
+				method, url, body := tt.write(channel.ID, message.ID)
+				if w := serveTest(mux, method, url, body); w.Code >= 300 {
+					t.Fatalf("%s %s = %d %s", method, url, w.Code, w.Body)
+				}
+
+				got := serveTest(mux, http.MethodGet, page, "").Body.String()
+				if strings.Contains(got, tt.want) == tt.missing {
+					t.Errorf("first page after %s = %s, stale", tt.name, got)
+				}
+			})
+		}
+	}
+}
+
+func TestMessagesFirstPageServedFromCache(t *testing.T) {
+	a, mux := newTestCachingAPI(t, false)
+	channel := newTestChannel(t, a, "general")
+	postTestMessages(t, a, channel.ID, "original hello")
+	page := "/api/channels/" + channel.ID + "/messages"
+	serveTest(mux, http.MethodGet, page, "")
+
+	// A change that bypasses invalidation only shows past the first page
+	a.mu.Lock()
+	a.messages[channel.ID][len(a.messages[channel.ID])-1].Content = "changed behind the cache"
+	a.mu.Unlock()
+
+	if got := serveTest(mux, http.MethodGet, page, "").Body.String(); !strings.Contains(got, "original hello") {
+		t.Errorf("cached first page = %s, want the stored response", got)
+	}
+	if got := serveTest(mux, http.MethodGet, page+"?author=alice", "").Body.String(); !strings.Contains(got, "changed behind the cache") {
+		t.Errorf("filtered page = %s, want it read uncached", got)
+	}
+}
+
+func TestChannelListCacheInvalidation(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a, mux := newTestCachingAPI(t, persist)
+			channel := newTestChannel(t, a, "general")
+			list := func() string {
+				return serveTest(mux, http.MethodGet, "/api/channels", "").Body.String()
+			}
+			if got := list(); !strings.Contains(got, `"general"`) {
+				t.Fatalf("channel list = %s, want general", got)
+			}
+
+			if w := serveTest(mux, http.MethodPost, "/api/channels", `{"name":"random"}`); w.Code != http.StatusCreated {
+				t.Fatalf("create = %d %s", w.Code, w.Body)
+			}
+			if got := list(); !strings.Contains(got, `"random"`) {
+				t.Errorf("channel list after create = %s, want random", got)
+			}
+
+			if w := serveTest(mux, http.MethodPatch, "/api/channels/"+channel.ID, `{"name":"announcements","topic":"news"}`); w.Code != http.StatusOK {
+				t.Fatalf("update = %d %s", w.Code, w.Body)
+			}
+			if got := list(); !strings.Contains(got, `"announcements"`) || !strings.Contains(got, `"news"`) || strings.Contains(got, `"general"`) {
+				t.Errorf("channel list after update = %s, want general renamed with a topic", got)
+			}
+
+			if w := serveTest(mux, http.MethodDelete, "/api/channels/"+channel.ID, ""); w.Code >= 300 {
+				t.Fatalf("delete = %d %s", w.Code, w.Body)
+			}
+			if got := list(); strings.Contains(got, `"announcements"`) {
+				t.Errorf("channel list after delete = %s, want announcements gone", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// postTestChannel calls createChannel with name
+func postTestChannel(a *API, name string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(CreateChannelRequest{Name: name})
+	w := httptest.NewRecorder()
+	a.createChannel(w, httptest.NewRequest(http.MethodPost, "/api/channels", strings.NewReader(string(body))))
+	return w
+}
+
+func TestCreateChannelStoresNormalizedName(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+
+			w := postTestChannel(a, "  Release  Notes ")
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create = %d %s", w.Code, w.Body)
+			}
+			var channel Channel
+			if err := json.Unmarshal(w.Body.Bytes(), &channel); err != nil {
+				t.Fatalf("decoding channel: %v", err)
+			}
+			if channel.Name != "release-notes" {
+				t.Errorf("Name = %q, want %q", channel.Name, "release-notes")
+			}
+
+			if w := postTestChannel(a, "RELEASE notes"); w.Code != http.StatusConflict {
+				t.Errorf("create with the same normalized name = %d, want %d", w.Code, http.StatusConflict)
+			}
+			if w := postTestChannel(a, "   "); w.Code != http.StatusBadRequest {
+				t.Errorf("create with a blank name = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCreateChannelConcurrentSameName(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+
+			names := []string{"deploys", "Deploys", " DEPLOYS "}
+			codes := make([]int, 2*len(names))
+			var wg sync.WaitGroup
+			for i := range codes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes[i] = postTestChannel(a, names[i%len(names)]).Code
+				}()
+			}
+			wg.Wait()
+
+			created, conflicts := 0, 0
+			for _, code := range codes {
+				switch code {
+				case http.StatusCreated:
+					created++
+				case http.StatusConflict:
+					conflicts++
+				default:
+					t.Errorf("unexpected status %d", code)
+				}
+			}
+			if created != 1 || conflicts != len(codes)-1 {
+				t.Errorf("%d created and %d conflicts, want 1 and %d", created, conflicts, len(codes)-1)
+			}
+			if len(a.channels) != 1 {
+				t.Errorf("%d channels exist, want 1", len(a.channels))
+			}
+		})
+	}
+}
+
+// patchTestChannel calls updateChannel with body
+func patchTestChannel(a *API, channelID, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	a.updateChannel(w, httptest.NewRequest(http.MethodPatch, "/api/channels/"+channelID, strings.NewReader(body)), channelID)
+	return w
+}
+
+func TestUpdateChannelPartial(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		// topic is the wanted topic; every other field must be unchanged
+		topic string
+	}{
+		{"update only topic", `{"topic":"release day"}`, http.StatusOK, "release day"},
+		{"trim topic", `{"topic":"  release day "}`, http.StatusOK, "release day"},
+		{"clear topic with null", `{"topic":null}`, http.StatusOK, ""},
+		{"clear topic with empty string", `{"topic":""}`, http.StatusOK, ""},
+		{"no fields", `{}`, http.StatusBadRequest, "weekly sync"},
+		{"null name", `{"name":null,"topic":"release day"}`, http.StatusBadRequest, "weekly sync"},
+	}
+	for _, persist := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run("persist="+strconv.FormatBool(persist)+"/"+tt.name, func(t *testing.T) {
+				a := newTestAPI(t, persist)
+				channel := newTestChannel(t, a, "general")
+				if w := patchTestChannel(a, channel.ID, `{"topic":"weekly sync","slow_mode_seconds":5,"read_only":true}`); w.Code != http.StatusOK {
+					t.Fatalf("setup PATCH = %d %s", w.Code, w.Body)
+				}
+
+				if w := patchTestChannel(a, channel.ID, tt.body); w.Code != tt.wantCode {
+					t.Fatalf("PATCH %s = %d %s, want %d", tt.body, w.Code, w.Body, tt.wantCode)
+				}
+
+				want := Channel{
+					ID:              channel.ID,
+					Name:            "general",
+					CreatedAt:       channel.CreatedAt,
+					SlowModeSeconds: 5,
+					ReadOnly:        true,
+					Topic:           tt.topic,
+				}
+				if got := *a.channels[channel.ID]; got != want {
+					t.Errorf("channel = %+v, want %+v", got, want)
+				}
+				if persist {
+					stored, err := a.db.GetChannel(channel.ID)
+					if err != nil {
+						t.Fatalf("GetChannel: %v", err)
+					}
+					if got := Channel(*stored); !got.CreatedAt.Equal(want.CreatedAt) || got.Name != want.Name ||
+						got.SlowModeSeconds != want.SlowModeSeconds || got.ReadOnly != want.ReadOnly || got.Topic != want.Topic {
+						t.Errorf("stored channel = %+v, want %+v", got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFailedPostDoesNotStartSlowMode(t *testing.T) {
+	a := newTestAPI(t, true)
+	channel := newTestChannel(t, a, "general")
+	a.hub.slowMode.setCooldown(channel.ID, time.Minute)
+
+	post := func(query string) int {
+		w := httptest.NewRecorder()
+		a.sendMessage(w, httptest.NewRequest(http.MethodPost, "/api/channels/"+channel.ID+"/messages?"+query, strings.NewReader(`{"author":"bob","content":"hi"}`)), channel.ID)
+		return w.Code
+	}
+
+	if code := post("dry_run=true"); code != http.StatusOK {
+		t.Fatalf("dry run = %d, want %d", code, http.StatusOK)
+	}
+
+	// Storing fails once the database is gone
+	a.db.Close()
+	if code := post(""); code < 500 {
+		t.Fatalf("post with the database closed = %d, want a server error", code)
+	}
+	if wait, ok := a.hub.slowMode.check(channel.ID, "bob"); !ok {
+		t.Errorf("bob must wait %v after a dry run and a failed post, want no cooldown", wait)
+	}
+}
+
+func TestEnsureDefaultChannel(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			if err := a.EnsureDefaultChannel(" General "); err != nil {
+				t.Fatalf("EnsureDefaultChannel: %v", err)
+			}
+			id, ok := a.channelIDByName("general")
+			if !ok || len(a.channels) != 1 {
+				t.Fatalf("channels = %v, want only general", a.channels)
+			}
+
+			page := getTestMessages(t, a, id, "")
+			if len(page.Messages) != 1 || page.Messages[0].Subtype != db.SubtypeSystem || page.Messages[0].Author != auditActorSystem {
+				t.Errorf("messages = %+v, want the creation notice by the system", page.Messages)
+			}
+
+			w := httptest.NewRecorder()
+			a.handleAudit(w, httptest.NewRequest(http.MethodGet, "/api/audit?action="+auditChannelCreate, nil))
+			var audit PaginatedAuditEntries
+			if err := json.Unmarshal(w.Body.Bytes(), &audit); err != nil {
+				t.Fatalf("decoding audit: %v", err)
+			}
+			if len(audit.Entries) != 1 || audit.Entries[0].Actor != auditActorSystem || audit.Entries[0].Target != id {
+				t.Errorf("audit = %+v, want one channel.create by the system", audit.Entries)
+			}
+
+			// Once there are channels it does nothing
+			if err := a.EnsureDefaultChannel("lobby"); err != nil || len(a.channels) != 1 {
+				t.Errorf("second EnsureDefaultChannel = %v with %d channels, want nothing created", err, len(a.channels))
+			}
+		})
+	}
+}
+
+func TestEnsureDefaultChannelAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for range 2 {
+		database, err := db.InitDB(path)
+		if err != nil {
+			t.Fatalf("InitDB: %v", err)
+		}
+		a := NewAPI(DefaultConfig(), nil)
+		if err := a.Persist(database); err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+		if err := a.EnsureDefaultChannel("general"); err != nil {
+			t.Fatalf("EnsureDefaultChannel: %v", err)
+		}
+		database.Close()
+	}
+
+	database, err := db.InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer database.Close()
+	channels, err := database.ListChannels()
+	if err != nil || len(channels) != 1 {
+		t.Fatalf("ListChannels = %v, %v, want one channel", channels, err)
+	}
+	messages, err := database.ListAllMessages(channels[0].ID)
+	if err != nil || len(messages) != 1 {
+		t.Errorf("ListAllMessages = %d messages, %v, want the one creation notice", len(messages), err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the address of the client that made r. Forwarding headers
+// are only honored when the direct peer is a trusted proxy; otherwise anyone
+// could spoof their address by setting X-Forwarded-For.
+func clientIP(r *http.Request, trusted []net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	if !ipTrusted(remote, trusted) {
+		return remote
+	}
+
+	// Walk X-Forwarded-For from the nearest hop back, skipping our own proxies
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if !ipTrusted(hop, trusted) {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+
+	return remote
+}
+
+// ipTrusted reports whether addr falls within any of the trusted networks
+func ipTrusted(addr string, trusted []net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses a comma-separated list of CIDR blocks
+func ParseCIDRs(list string) ([]net.IPNet, error) {
+	var networks []net.IPNet
+	for _, block := range strings.Split(list, ",") {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", block, err)
+		}
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
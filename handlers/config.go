@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"gastowndemo/db"
+)
+
+// Config holds limits shared by the REST and WebSocket handlers
+type Config struct {
+	// MaxMessageLength is the maximum message content length, in runes
+	MaxMessageLength int
+
+	// DefaultPageSize is the page size used when a request omits limit
+	DefaultPageSize int
+
+	// MaxPageSize is the largest limit a request may ask for
+	MaxPageSize int
+
+	// EditWindow is how long after posting a message may be edited; zero means unlimited
+	EditWindow time.Duration
+
+	// Compression enables gzip for REST responses
+	Compression bool
+
+	// FlagHideThreshold hides a message once this many reporters flag it; zero disables auto-hiding
+	FlagHideThreshold int
+
+	// MaxPinsPerChannel caps how many messages a channel may pin; zero means unlimited
+	MaxPinsPerChannel int
+
+	// Sanitize is what happens to control and format characters in message
+	// content that can spoof its display; the zero value strips them
+	Sanitize SanitizeMode
+
+	// MaxReactionEmoji caps how many different emoji a message may carry,
+	// and MaxReactionsPerAuthor how many of them one author may add; zero
+	// means unlimited
+	MaxReactionEmoji      int
+	MaxReactionsPerAuthor int
+
+	// ThreadSubscriptions sends thread replies only to the thread's followers;
+	// when false, replies are broadcast to the whole channel
+	ThreadSubscriptions bool
+
+	// TrustedProxies are the networks whose X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []net.IPNet
+
+	// WSReadBufferSize and WSWriteBufferSize size the WebSocket I/O buffers,
+	// in bytes. Write buffers are pooled between writes, so a larger size
+	// costs memory only for connections that are actively writing.
+	WSReadBufferSize  int
+	WSWriteBufferSize int
+
+	// MaxConnsPerIP caps the open WebSocket connections from one client IP;
+	// zero means unlimited
+	MaxConnsPerIP int
+
+	// BotTokens maps each bot author to the token it sends as
+	// "Authorization: Bot <token>". Bots skip slow mode and may post in
+	// read-only channels, and their names can't be used without the token.
+	BotTokens map[string]string
+
+	// BatchWindow coalesces frames queued for a client within this window
+	// into a single batch frame, for clients that opt in with ?batch=true.
+	// Zero disables batching.
+	BatchWindow time.Duration
+
+	// SessionTTL is how long a WebSocket session outlives its last
+	// connection, so a client that reconnects within it can resume with
+	// ?session=. Zero disables sessions.
+	SessionTTL time.Duration
+
+	// Maintenance puts the whole server in read-only mode, for migrations
+	// and incidents: reads are served, writes over REST get a 503 and
+	// writes over WebSocket an error frame
+	Maintenance bool
+
+	// WSPath is where the WebSocket endpoint is mounted, such as "/api/ws"
+	// behind a gateway that routes by path prefix
+	WSPath string
+
+	// ReconnectSpread is the window over which clients disconnected by a
+	// shutdown are told to reconnect, each at a random point within it
+	// after a one second minimum, so they don't all return at once
+	ReconnectSpread time.Duration
+
+	// WSDrain is how long a shutdown waits for frames already queued for
+	// WebSocket clients to be written before disconnecting them. New
+	// connections are refused meanwhile. Zero disconnects at once.
+	WSDrain time.Duration
+
+	// CacheTTL is how long encoded responses for the channel list and the
+	// first page of each channel's messages are reused. Writes to a
+	// channel invalidate its entries at once. Zero disables the cache.
+	CacheTTL time.Duration
+
+	// PingInterval is how often the server pings each WebSocket client.
+	// Clients that haven't answered with a pong for staleAfterPings
+	// intervals are reaped. Zero disables pings and reaping.
+	PingInterval time.Duration
+
+	// DebugHub serves GET /debug/hub, a snapshot of the hub's channels and
+	// client counts, to loopback clients only unless DebugHubRemote is set
+	DebugHub       bool
+	DebugHubRemote bool
+
+	// AccessLogSampleRate is the fraction of requests, from 0 to 1, that
+	// AccessLog logs; server errors are logged regardless. Zero turns the
+	// access log off.
+	AccessLogSampleRate float64
+
+	// AccessLogExclude lists paths left out of the access log, such as
+	// health checks; entries ending in a slash cover everything under them
+	AccessLogExclude []string
+
+	// AutoCreateChannels lets a message posted to a channel by name with
+	// ?create_channel=true create the channel if it doesn't exist. When
+	// false such posts get a 404 like any other missing channel.
+	AutoCreateChannels bool
+
+	// Unfurl fetches link previews for the first URL in each message posted
+	// over REST. It makes outbound requests, so it is off by default.
+	Unfurl bool
+}
+
+// DefaultConfig returns the default handler configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxMessageLength:      4000,
+		Sanitize:              SanitizeStrip,
+		DefaultPageSize:       20,
+		MaxPageSize:           100,
+		Compression:           true,
+		MaxPinsPerChannel:     50,
+		MaxReactionEmoji:      20,
+		MaxReactionsPerAuthor: 10,
+		ThreadSubscriptions:   true,
+		WSReadBufferSize:      4096,
+		WSWriteBufferSize:     4096,
+		MaxConnsPerIP:         100,
+		SessionTTL:            5 * time.Minute,
+		PingInterval:          30 * time.Second,
+		WSPath:                "/ws",
+		ReconnectSpread:       10 * time.Second,
+		WSDrain:               5 * time.Second,
+		CacheTTL:              2 * time.Second,
+		AccessLogSampleRate:   1,
+		AccessLogExclude:      []string{"/healthz", "/metrics"},
+	}
+}
+
+// features returns the names of optional features enabled by this configuration
+func (c *Config) features() []string {
+	features := []string{"threads", "batch_lines", "reactions", "slow_mode"}
+	if c.Compression {
+		features = append(features, "compression")
+	}
+	if c.BatchWindow > 0 {
+		features = append(features, "batch")
+	}
+	if c.Unfurl {
+		features = append(features, "unfurl")
+	}
+	if c.SessionTTL > 0 {
+		features = append(features, "sessions")
+	}
+	if len(c.BotTokens) > 0 {
+		features = append(features, "bots")
+	}
+	if c.AutoCreateChannels {
+		features = append(features, "auto_create_channels")
+	}
+	return features
+}
+
+// contentTooLong reports whether content exceeds the configured maximum length.
+// Runes are counted rather than bytes so multibyte text isn't penalized.
+func (c *Config) contentTooLong(content string) bool {
+	return c.MaxMessageLength > 0 && utf8.RuneCountInString(content) > c.MaxMessageLength
+}
+
+// FitMessageLengthToDB fits MaxMessageLength to the content length the
+// database schema accepts. The schema's limit can't be turned off, so zero
+// becomes that limit, and a larger limit is an error.
+func (c *Config) FitMessageLengthToDB() error {
+	if c.MaxMessageLength > db.MaxContentLength {
+		return fmt.Errorf("may be at most %d when using a database", db.MaxContentLength)
+	}
+	if c.MaxMessageLength <= 0 {
+		c.MaxMessageLength = db.MaxContentLength
+	}
+	return nil
+}
+
+// editableFor returns how much longer a message created at createdAt may be
+// edited, and false if editing is not time limited
+func (c *Config) editableFor(createdAt time.Time) (time.Duration, bool) {
+	if c.EditWindow <= 0 {
+		return 0, false
+	}
+	remaining := c.EditWindow - time.Since(createdAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// PublicConfig is the response for GET /api/config. It only carries
+// non-secret values and is built from the same Config the handlers enforce.
+// Limits of zero mean unlimited. Slow mode is set per channel, so its
+// cooldown is each channel's slow_mode_seconds.
+type PublicConfig struct {
+	MaxMessageLength      int      `json:"max_message_length"`
+	DefaultPageSize       int      `json:"default_page_size"`
+	MaxPageSize           int      `json:"max_page_size"`
+	EditWindowSecs        int      `json:"edit_window_seconds"`
+	MaxPins               int      `json:"max_pins_per_channel"`
+	MaxReactionEmoji      int      `json:"max_reaction_emoji"`
+	MaxReactionsPerAuthor int      `json:"max_reactions_per_author"`
+	MaxConnsPerIP         int      `json:"max_ws_connections_per_ip"`
+	WSPath                string   `json:"ws_path"`
+	ReadOnly              bool     `json:"read_only"`
+	Features              []string `json:"features"`
+}
+
+// handleConfig returns the limits clients need to configure themselves
+func (a *API) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Config is fixed for the life of the process, so clients may cache it
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, PublicConfig{
+		MaxMessageLength:      a.cfg.MaxMessageLength,
+		DefaultPageSize:       a.cfg.DefaultPageSize,
+		MaxPageSize:           a.cfg.MaxPageSize,
+		EditWindowSecs:        int(a.cfg.EditWindow.Seconds()),
+		MaxPins:               a.cfg.MaxPinsPerChannel,
+		MaxReactionEmoji:      a.cfg.MaxReactionEmoji,
+		MaxReactionsPerAuthor: a.cfg.MaxReactionsPerAuthor,
+		MaxConnsPerIP:         a.cfg.MaxConnsPerIP,
+		WSPath:                a.cfg.WSPath,
+		ReadOnly:              a.cfg.Maintenance,
+		Features:              a.cfg.features(),
+	})
+}
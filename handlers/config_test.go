@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"gastowndemo/db"
+)
+
+// getTestConfig calls handleConfig and decodes the response
+func getTestConfig(t *testing.T, cfg Config) PublicConfig {
+	t.Helper()
+	a := NewAPI(cfg, nil)
+	w := httptest.NewRecorder()
+	a.handleConfig(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/config = %d %s", w.Code, w.Body)
+	}
+	var got PublicConfig
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding config: %v", err)
+	}
+	return got
+}
+
+func TestHandleConfigPublishesLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxMessageLength = 1000
+	cfg.MaxPinsPerChannel = 7
+	cfg.MaxConnsPerIP = 3
+	cfg.MaxReactionEmoji = 5
+	cfg.MaxReactionsPerAuthor = 2
+
+	got := getTestConfig(t, cfg)
+	if got.MaxMessageLength != 1000 || got.MaxPins != 7 || got.MaxConnsPerIP != 3 ||
+		got.MaxReactionEmoji != 5 || got.MaxReactionsPerAuthor != 2 {
+		t.Errorf("config = %+v, want the configured limits", got)
+	}
+	for _, feature := range []string{"threads", "reactions", "slow_mode"} {
+		if !slices.Contains(got.Features, feature) {
+			t.Errorf("features = %v, want %s", got.Features, feature)
+		}
+	}
+}
+
+func TestFitMessageLengthToDB(t *testing.T) {
+	tests := []struct {
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{0, db.MaxContentLength, false},
+		{1000, 1000, false},
+		{db.MaxContentLength, db.MaxContentLength, false},
+		{db.MaxContentLength + 1, 0, true},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.MaxMessageLength = tt.limit
+		err := cfg.FitMessageLengthToDB()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FitMessageLengthToDB() with %d = %v, want error %t", tt.limit, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cfg.MaxMessageLength != tt.want {
+			t.Errorf("FitMessageLengthToDB() with %d set %d, want %d", tt.limit, cfg.MaxMessageLength, tt.want)
+		}
+	}
+
+	// The fitted limit is what /api/config advertises
+	cfg := DefaultConfig()
+	cfg.MaxMessageLength = 0
+	cfg.FitMessageLengthToDB()
+	if got := getTestConfig(t, cfg); got.MaxMessageLength != db.MaxContentLength {
+		t.Errorf("max_message_length = %d, want %d", got.MaxMessageLength, db.MaxContentLength)
+	}
+}
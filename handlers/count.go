@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// setTotalCount sets the X-Total-Count header, which counts everything a
+// listing covers across all its pages rather than what one response holds
+func setTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// countMessages handles HEAD /api/channels/:id/messages and GET with
+// ?count_only=true, reporting in an X-Total-Count header how many messages
+// a listing with the same filter params would have, with an empty body. It
+// lets polling clients check for new messages without fetching a page.
+func (a *API) countMessages(w http.ResponseWriter, r *http.Request, channelID string) {
+	filter, err := parseMessageFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	total, err := a.countMessagesLocked(channelID, filter)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	setTotalCount(w, total)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// messageCursor is a position in a channel's timeline. Messages are ordered
+// by creation time and then ID, so a cursor is unambiguous even when two
+// messages share a timestamp, and stays valid if its message is deleted.
+type messageCursor db.Cursor
+
+// errInvalidCursor is returned for cursor tokens this server didn't issue
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorOf returns the cursor for a message's position
+func cursorOf(m Message) messageCursor {
+	return messageCursor{CreatedAt: m.CreatedAt, ID: m.ID}
+}
+
+// before reports whether c sorts before other. Without a database message
+// IDs are unpadded counters, so IDs compare by length first; the database's
+// IDs all have the same width, so for them that is the same as comparing
+// the text as SQLite does.
+func (c messageCursor) before(other messageCursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	if len(c.ID) != len(other.ID) {
+		return len(c.ID) < len(other.ID)
+	}
+	return c.ID < other.ID
+}
+
+// pastCursor reports whether m comes after c in timeline order, or before it
+// when reverse is set
+func pastCursor(m Message, c db.Cursor, reverse bool) bool {
+	if reverse {
+		return cursorOf(m).before(messageCursor(c))
+	}
+	return messageCursor(c).before(cursorOf(m))
+}
+
+// encodeCursor returns the opaque token clients pass back as ?cursor=
+func encodeCursor(c messageCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a token from encodeCursor, returning errInvalidCursor
+// if it is malformed
+func decodeCursor(token string) (messageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return messageCursor{}, errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return messageCursor{}, errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return messageCursor{}, errInvalidCursor
+	}
+	return messageCursor{CreatedAt: time.Unix(0, n), ID: id}, nil
+}
+
+// messagesAfterCursor returns the messages after c in timeline order, or
+// those before it when desc is set. messages must be in timeline order.
+func messagesAfterCursor(messages []Message, c messageCursor, desc bool) []Message {
+	if desc {
+		i := sort.Search(len(messages), func(i int) bool {
+			return !cursorOf(messages[i]).before(c)
+		})
+		return messages[:i]
+	}
+	i := sort.Search(len(messages), func(i int) bool {
+		return c.before(cursorOf(messages[i]))
+	})
+	return messages[i:]
+}
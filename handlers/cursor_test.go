@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// newTestAPI returns an API with default config, persisting to a fresh
+// database in a temporary directory if persist is set
+func newTestAPI(t *testing.T, persist bool) *API {
+	t.Helper()
+	a := NewAPI(DefaultConfig(), nil)
+	if persist {
+		database, err := db.InitDB(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("InitDB: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		if err := a.Persist(database); err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+	}
+	return a
+}
+
+// newTestChannel creates a channel as alice
+func newTestChannel(t *testing.T, a *API, name string) *Channel {
+	t.Helper()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	channel, err := a.createChannelLocked(name, "alice")
+	if err != nil {
+		t.Fatalf("createChannelLocked(%q): %v", name, err)
+	}
+	return channel
+}
+
+// postTestMessages stores messages by alice in one batch, so they share a
+// timestamp
+func postTestMessages(t *testing.T, a *API, channelID string, contents ...string) []Message {
+	t.Helper()
+	messages := make([]Message, len(contents))
+	for i, content := range contents {
+		messages[i] = Message{ChannelID: channelID, Author: "alice", Content: content}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stored, err := a.appendMessagesLocked(messages, false)
+	if err != nil {
+		t.Fatalf("appendMessagesLocked: %v", err)
+	}
+	return stored
+}
+
+// getTestMessages calls getMessages with query and decodes the page
+func getTestMessages(t *testing.T, a *API, channelID, query string) PaginatedMessages {
+	t.Helper()
+	w := httptest.NewRecorder()
+	a.getMessages(w, httptest.NewRequest(http.MethodGet, "/api/channels/"+channelID+"/messages?"+query, nil), channelID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET messages?%s = %d %s", query, w.Code, w.Body)
+	}
+	var page PaginatedMessages
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding page: %v", err)
+	}
+	return page
+}
+
+// testMessageIDs returns the IDs of messages, in order
+func testMessageIDs(messages []Message) []string {
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestGetMessagesCursorPagesThroughTies(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			channel := newTestChannel(t, a, "general")
+
+			// Twelve messages sharing a timestamp after the creation
+			// notice, so without a database their IDs run from 2 to 13
+			// and "10" must sort after "9"
+			contents := make([]string, 12)
+			for i := range contents {
+				contents[i] = "message " + strconv.Itoa(i)
+			}
+			postTestMessages(t, a, channel.ID, contents...)
+			stored := a.messages[channel.ID]
+
+			for _, order := range []string{"asc", "desc"} {
+				want := testMessageIDs(stored)
+				if order == "desc" {
+					slices.Reverse(want)
+				}
+
+				var got []string
+				query := "limit=5&order=" + order
+				for range len(stored) {
+					page := getTestMessages(t, a, channel.ID, query)
+					if page.Total != len(stored)-len(got) {
+						t.Errorf("%s: Total = %d with %d already read, want %d", order, page.Total, len(got), len(stored)-len(got))
+					}
+					got = append(got, testMessageIDs(page.Messages)...)
+					if page.NextCursor == "" {
+						break
+					}
+					query = "limit=5&order=" + order + "&cursor=" + page.NextCursor
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("%s: paged %v, want %v", order, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	c := messageCursor{CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC), ID: "10"}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("decodeCursor(encodeCursor(%v)) = %v", c, got)
+	}
+	if _, err := decodeCursor("not a cursor"); err != errInvalidCursor {
+		t.Errorf("decodeCursor(garbage) error = %v, want errInvalidCursor", err)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits on registering custom emoji
+const (
+	maxCustomEmojiName = 32
+	maxCustomEmojiURL  = 2048
+)
+
+// customEmojiNamePattern matches a custom emoji name, which may use the same
+// characters as a built-in shortcode
+var customEmojiNamePattern = regexp.MustCompile(`^[a-z0-9_+\-]+$`)
+
+// errUnknownEmoji is returned when reacting with a :shortcode: that is
+// neither built in nor registered
+var errUnknownEmoji = errors.New("unknown emoji")
+
+// CustomEmoji is an image registered under a name, used in reactions as
+// :name:
+type CustomEmoji struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegisterCustomEmojiRequest is the request body for registering a custom
+// emoji. The name may be given with or without the surrounding colons.
+type RegisterCustomEmojiRequest struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// handleCustomEmoji handles GET and POST /api/emoji/custom
+func (a *API) handleCustomEmoji(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.listCustomEmoji(w, r)
+	case http.MethodPost:
+		a.registerCustomEmoji(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listCustomEmoji returns every custom emoji, by name
+func (a *API) listCustomEmoji(w http.ResponseWriter, _ *http.Request) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	emoji := make([]CustomEmoji, 0, len(a.customEmoji))
+	for _, e := range a.customEmoji {
+		emoji = append(emoji, e)
+	}
+	sort.Slice(emoji, func(i, j int) bool {
+		return emoji[i].Name < emoji[j].Name
+	})
+
+	respondJSON(w, http.StatusOK, emoji)
+}
+
+// registerCustomEmoji adds a server-wide custom emoji. Names can't shadow a
+// built-in shortcode, and once registered a name keeps its image, so
+// reactions already given with it keep their meaning.
+func (a *API) registerCustomEmoji(w http.ResponseWriter, r *http.Request) {
+	var req RegisterCustomEmojiRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.Trim(strings.TrimSpace(req.Name), ":")
+	if name == "" {
+		http.Error(w, "Emoji name is required", http.StatusBadRequest)
+		return
+	}
+	if len(name) > maxCustomEmojiName {
+		http.Error(w, fmt.Sprintf("Emoji name exceeds maximum length of %d characters", maxCustomEmojiName), http.StatusBadRequest)
+		return
+	}
+	if !customEmojiNamePattern.MatchString(name) {
+		http.Error(w, "Emoji name may only contain lowercase letters, digits, _, + and -", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkEmojiURL(req.URL); err != nil {
+		http.Error(w, "Invalid emoji URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := emojiShortcodes[name]; ok {
+		http.Error(w, "Emoji name is taken by a built-in emoji", http.StatusConflict)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.customEmoji[name]; ok {
+		http.Error(w, "Emoji name already registered", http.StatusConflict)
+		return
+	}
+
+	emoji := CustomEmoji{Name: name, URL: req.URL, CreatedAt: time.Now()}
+	if a.db != nil {
+		stored, err := a.db.AddCustomEmoji(name, req.URL)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		emoji = CustomEmoji(*stored)
+	}
+	a.customEmoji[name] = emoji
+
+	respondJSON(w, http.StatusCreated, emoji)
+}
+
+// checkEmojiURL reports why raw can't be a custom emoji's image URL, which
+// clients load directly and so must be absolute http or https
+func checkEmojiURL(raw string) error {
+	if raw == "" {
+		return errors.New("url is required")
+	}
+	if len(raw) > maxCustomEmojiURL {
+		return fmt.Errorf("url exceeds maximum length of %d characters", maxCustomEmojiURL)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// customEmojiName returns the name in a :name: reaction, and false if
+// emoji isn't in that form
+func customEmojiName(emoji string) (string, bool) {
+	name, ok := strings.CutPrefix(emoji, ":")
+	if !ok {
+		return "", false
+	}
+	name, ok = strings.CutSuffix(name, ":")
+	if !ok || len(name) > maxCustomEmojiName || !customEmojiNamePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// checkCustomEmojiLocked returns errUnknownEmoji if emoji is a :name: that
+// isn't registered. Callers must hold a.mu.
+func (a *API) checkCustomEmojiLocked(emoji string) error {
+	if name, ok := customEmojiName(emoji); ok {
+		if _, ok := a.customEmoji[name]; !ok {
+			return errUnknownEmoji
+		}
+	}
+	return nil
+}
+
+// resolveCustomEmojiLocked fills in the image URL of each custom emoji in
+// reactions, modifying it in place. Callers must hold a.mu.
+func (a *API) resolveCustomEmojiLocked(reactions []Reaction) {
+	for i, r := range reactions {
+		if name, ok := customEmojiName(r.Emoji); ok {
+			reactions[i].URL = a.customEmoji[name].URL
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"sort"
+)
+
+// HubSnapshot is the response for GET /debug/hub. It holds only counts and
+// channel IDs: no message content, authors, addresses or tokens.
+type HubSnapshot struct {
+	Connections int                  `json:"connections"`
+	Reaped      int64                `json:"reaped"`
+	Draining    bool                 `json:"draining"`
+	Channels    []HubChannelSnapshot `json:"channels"`
+}
+
+// HubChannelSnapshot is one channel's connected clients. Queued counts the
+// frames waiting in their send queues; a client whose queue stays full is
+// too slow to keep up.
+type HubChannelSnapshot struct {
+	ChannelID string `json:"channel_id"`
+	Clients   int    `json:"clients"`
+	Batching  int    `json:"batching"`
+	Queued    int    `json:"queued"`
+}
+
+// Snapshot returns the hub's channels and their client counts, ordered by
+// channel ID, read under the hub lock so the counts agree with each other
+func (h *Hub) Snapshot() HubSnapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	snapshot := HubSnapshot{
+		Reaped:   h.reaped.Load(),
+		Draining: h.draining.Load(),
+		Channels: make([]HubChannelSnapshot, 0, len(h.channels)),
+	}
+	for id, ch := range h.channels {
+		channel := HubChannelSnapshot{ChannelID: id, Clients: len(ch.clients)}
+		for client := range ch.clients {
+			if client.batchWindow > 0 || client.lines {
+				channel.Batching++
+			}
+			channel.Queued += len(client.send)
+		}
+		snapshot.Connections += channel.Clients
+		snapshot.Channels = append(snapshot.Channels, channel)
+	}
+
+	sort.Slice(snapshot.Channels, func(i, j int) bool {
+		return snapshot.Channels[i].ChannelID < snapshot.Channels[j].ChannelID
+	})
+	return snapshot
+}
+
+// handleDebugHub handles GET /debug/hub, which is only registered with
+// Config.DebugHub. Unless Config.DebugHubRemote is set too, it answers only
+// requests from a loopback address, after resolving trusted proxies.
+func (a *API) handleDebugHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.cfg.DebugHubRemote {
+		ip := net.ParseIP(clientIP(r, a.cfg.TrustedProxies))
+		if ip == nil || !ip.IsLoopback() {
+			http.Error(w, "Debug endpoints are only served to localhost", http.StatusForbidden)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, a.hub.Snapshot())
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Draft is an unsent message an author is composing in a channel, saved so
+// it follows them across devices
+type Draft struct {
+	ChannelID string    `json:"channel_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveDraftRequest is the request body for saving a draft
+type SaveDraftRequest struct {
+	Author  string `json:"author"`
+	Content string `json:"content"`
+}
+
+// draftKey identifies one author's draft in one channel
+type draftKey struct {
+	channelID string
+	author    string
+}
+
+// handleDraft handles GET, PUT and DELETE /api/channels/:id/draft. GET and
+// DELETE take the author as a query param; PUT takes it in the body.
+func (a *API) handleDraft(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		a.getDraft(w, r, channelID)
+	case http.MethodPut:
+		a.saveDraft(w, r, channelID)
+	case http.MethodDelete:
+		a.deleteDraft(w, r, channelID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getDraft returns an author's draft in a channel
+func (a *API) getDraft(w http.ResponseWriter, r *http.Request, channelID string) {
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	draft, ok := a.drafts[draftKey{channelID, author}]
+	if !ok {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, draft)
+}
+
+// saveDraft creates or replaces an author's draft. Saving empty content
+// discards the draft.
+func (a *API) saveDraft(w http.ResponseWriter, r *http.Request, channelID string) {
+	var req SaveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.cfg.contentTooLong(req.Content) {
+		http.Error(w, fmt.Sprintf("Draft content exceeds maximum length of %d characters", a.cfg.MaxMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Content == "" {
+		if err := a.clearDraftLocked(channelID, req.Author); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	draft := Draft{ChannelID: channelID, Author: req.Author, Content: req.Content, UpdatedAt: time.Now()}
+	if a.db != nil {
+		stored, err := a.db.SaveDraft(channelID, req.Author, req.Content)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		draft.UpdatedAt = stored.UpdatedAt
+	}
+	a.drafts[draftKey{channelID, req.Author}] = draft
+
+	respondJSON(w, http.StatusOK, draft)
+}
+
+// deleteDraft discards an author's draft
+func (a *API) deleteDraft(w http.ResponseWriter, r *http.Request, channelID string) {
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	if _, ok := a.drafts[draftKey{channelID, author}]; !ok {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	}
+
+	if err := a.clearDraftLocked(channelID, author); err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearDraftLocked discards an author's draft if they have one. Callers must
+// hold a.mu.
+func (a *API) clearDraftLocked(channelID, author string) error {
+	key := draftKey{channelID, author}
+	if _, ok := a.drafts[key]; !ok {
+		return nil
+	}
+
+	if a.db != nil {
+		if err := a.db.DeleteDraft(channelID, author); err != nil {
+			return err
+		}
+	}
+	delete(a.drafts, key)
+	return nil
+}
+
+// clearSentDraftLocked discards the draft an author just sent. The message is
+// already stored, so a failure is logged rather than reported. Callers must
+// hold a.mu.
+func (a *API) clearSentDraftLocked(channelID, author string) {
+	if err := a.clearDraftLocked(channelID, author); err != nil {
+		log.Printf("Failed to clear draft for %s in channel %s: %v", author, channelID, err)
+	}
+}
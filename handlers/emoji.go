@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// emojiShortcodes maps supported :shortcode: names to their emoji
+var emojiShortcodes = map[string]string{
+	"+1":               "👍",
+	"-1":               "👎",
+	"100":              "💯",
+	"clap":             "👏",
+	"cry":              "😢",
+	"eyes":             "👀",
+	"fire":             "🔥",
+	"grin":             "😁",
+	"heart":            "❤️",
+	"joy":              "😂",
+	"laughing":         "😆",
+	"ok_hand":          "👌",
+	"party":            "🥳",
+	"pray":             "🙏",
+	"rocket":           "🚀",
+	"sad":              "😞",
+	"smile":            "😄",
+	"sunglasses":       "😎",
+	"tada":             "🎉",
+	"thinking":         "🤔",
+	"thumbsdown":       "👎",
+	"thumbsup":         "👍",
+	"warning":          "⚠️",
+	"wave":             "👋",
+	"wink":             "😉",
+	"white_check_mark": "✅",
+	"x":                "❌",
+}
+
+// shortcodePattern matches :name: style emoji shortcodes
+var shortcodePattern = regexp.MustCompile(`:([a-z0-9_+\-]+):`)
+
+// codePattern matches fenced code blocks (an unclosed fence runs to the end
+// of the content) and inline code spans
+var codePattern = regexp.MustCompile("(?s)```.*?(?:```|$)|`[^`]+`")
+
+// expandEmoji replaces known :shortcode: sequences in content with their
+// emoji, leaving unknown shortcodes untouched. Code blocks and inline code
+// are copied verbatim so snippets such as `a:b:c` keep their meaning.
+func expandEmoji(content string) string {
+	var b strings.Builder
+	last := 0
+	for _, code := range codePattern.FindAllStringIndex(content, -1) {
+		b.WriteString(expandShortcodes(content[last:code[0]]))
+		b.WriteString(content[code[0]:code[1]])
+		last = code[1]
+	}
+	b.WriteString(expandShortcodes(content[last:]))
+	return b.String()
+}
+
+// expandShortcodes expands the shortcodes in text that contains no code
+func expandShortcodes(text string) string {
+	return shortcodePattern.ReplaceAllStringFunc(text, func(match string) string {
+		if emoji, ok := emojiShortcodes[match[1:len(match)-1]]; ok {
+			return emoji
+		}
+		return match
+	})
+}
+
+// EmojiEntry describes one supported shortcode
+type EmojiEntry struct {
+	Shortcode string `json:"shortcode"`
+	Emoji     string `json:"emoji"`
+}
+
+// handleEmoji handles GET /api/emoji, listing supported shortcodes
+func (a *API) handleEmoji(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries := make([]EmojiEntry, 0, len(emojiShortcodes))
+	for code, emoji := range emojiShortcodes {
+		entries = append(entries, EmojiEntry{Shortcode: ":" + code + ":", Emoji: emoji})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Shortcode < entries[j].Shortcode
+	})
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import "testing"
+
+func TestExpandEmoji(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"shortcode", "ship it :rocket:", "ship it 🚀"},
+		{"unknown shortcode", "a :nope: b", "a :nope: b"},
+		{"inline code", "run `a:wave:b` now :wave:", "run `a:wave:b` now 👋"},
+		{"fenced code", "```\nx := m[:rocket:]\n```\n:tada:", "```\nx := m[:rocket:]\n```\n🎉"},
+		{"unclosed fence", ":fire: ```\n:fire:\n:tada:", "🔥 ```\n:fire:\n:tada:"},
+		{"html in fence", "```html\n<script>alert(':x:')</script>\n```", "```html\n<script>alert(':x:')</script>\n```"},
+		{"html in inline code", "`<b>:wave:</b>` <i>", "`<b>:wave:</b>` <i>"},
+		{"between code spans", "`a` :wave: `b`", "`a` 👋 `b`"},
+		{"lone backtick", "it`s :wave:", "it`s 👋"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandEmoji(tt.content); got != tt.want {
+				t.Errorf("expandEmoji(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
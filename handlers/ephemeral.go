@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// EphemeralMessageRequest is the request body for sending an ephemeral message
+type EphemeralMessageRequest struct {
+	Target  string `json:"target"`
+	Author  string `json:"author"`
+	Content string `json:"content"`
+}
+
+// EphemeralEvent is a message shown only to its target's connections. It is
+// never stored, so it disappears when the target reconnects.
+type EphemeralEvent struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+	Target    string `json:"target"`
+	Author    string `json:"author"`
+	Content   string `json:"content"`
+}
+
+// EphemeralMessageResponse reports how many connections an ephemeral message reached
+type EphemeralMessageResponse struct {
+	DeliveredTo int `json:"delivered_to"`
+}
+
+// sendEphemeral handles POST /api/channels/:id/messages/ephemeral, sending a
+// message only to the target's clients in the channel. It responds 202 if
+// the target has no connections there and the message was dropped.
+func (a *API) sendEphemeral(w http.ResponseWriter, r *http.Request, channelID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EphemeralMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	content, err := a.cfg.sanitizeContent(req.Content)
+	if err != nil {
+		http.Error(w, "Message content "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Content = expandEmoji(content)
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.cfg.contentTooLong(req.Content) {
+		http.Error(w, fmt.Sprintf("Message content exceeds maximum length of %d characters", a.cfg.MaxMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Target == "" {
+		http.Error(w, "Target is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.RLock()
+	_, ok := a.channels[channelID]
+	a.mu.RUnlock()
+	if !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(EphemeralEvent{
+		Frame:     newFrame("ephemeral"),
+		ChannelID: channelID,
+		Target:    req.Target,
+		Author:    req.Author,
+		Content:   req.Content,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal ephemeral message: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	delivered := a.hub.sendToChannelAuthor(channelID, req.Target, data)
+	status := http.StatusOK
+	if delivered == 0 {
+		status = http.StatusAccepted
+	}
+	log.Printf("Ephemeral message sent to %s in channel %s by %s (%d connections)", req.Target, channelID, req.Author, delivered)
+
+	respondJSON(w, status, EphemeralMessageResponse{DeliveredTo: delivered})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gastowndemo/db"
+)
+
+// respondStoreError writes the HTTP error for a failed db call, mapping the
+// db package's typed errors to precise status codes
+func respondStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrChannelNotFound):
+		http.Error(w, "Channel not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrChannelNotEmpty):
+		http.Error(w, "Channel is not empty", http.StatusConflict)
+	case errors.Is(err, db.ErrUsernameTaken):
+		http.Error(w, "Username already taken", http.StatusConflict)
+	case errors.Is(err, db.ErrDuplicate):
+		http.Error(w, "Already exists", http.StatusConflict)
+	case errors.Is(err, db.ErrContentEmpty):
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+	case errors.Is(err, db.ErrContentTooLong):
+		http.Error(w, fmt.Sprintf("Message content exceeds maximum length of %d characters", db.MaxContentLength), http.StatusBadRequest)
+	case errors.Is(err, db.ErrAuthorEmpty):
+		http.Error(w, "Author is required", http.StatusBadRequest)
+	case errors.Is(err, db.ErrTooManyEmoji):
+		http.Error(w, "Message already has the maximum number of different reactions", http.StatusConflict)
+	case errors.Is(err, db.ErrTooManyReactions):
+		http.Error(w, "Author already has the maximum number of reactions on this message", http.StatusConflict)
+	case errors.Is(err, db.ErrBusy):
+		http.Error(w, "Database busy, try again", http.StatusServiceUnavailable)
+	default:
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gastowndemo/db"
+)
+
+func TestRespondStoreError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"channel not found", db.ErrChannelNotFound, http.StatusNotFound},
+		{"not found", db.ErrNotFound, http.StatusNotFound},
+		{"wrapped not found", fmt.Errorf("loading message: %w", db.ErrNotFound), http.StatusNotFound},
+		{"channel not empty", db.ErrChannelNotEmpty, http.StatusConflict},
+		{"username taken", db.ErrUsernameTaken, http.StatusConflict},
+		{"duplicate", fmt.Errorf("%w: UNIQUE constraint failed", db.ErrDuplicate), http.StatusConflict},
+		{"content empty", db.ErrContentEmpty, http.StatusBadRequest},
+		{"content too long", db.ErrContentTooLong, http.StatusBadRequest},
+		{"author empty", db.ErrAuthorEmpty, http.StatusBadRequest},
+		{"too many emoji", db.ErrTooManyEmoji, http.StatusConflict},
+		{"too many reactions", db.ErrTooManyReactions, http.StatusConflict},
+		{"busy", db.ErrBusy, http.StatusServiceUnavailable},
+		{"unknown", errors.New("disk I/O error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			respondStoreError(rec, tt.err)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %q)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// messageFields are the names ?fields= accepts: the JSON keys of Message
+var messageFields = map[string]bool{
+	"id":               true,
+	"channel_id":       true,
+	"content":          true,
+	"author":           true,
+	"parent_id":        true,
+	"created_at":       true,
+	"edited_at":        true,
+	"hidden":           true,
+	"is_bot":           true,
+	"unfurl":           true,
+	"reactions":        true,
+	"refs":             true,
+	"metadata":         true,
+	"subtype":          true,
+	"resolved_refs":    true,
+	"created_at_local": true,
+}
+
+// parseFields parses a comma-separated ?fields= list. It returns nil when the
+// list is empty, meaning every field is wanted.
+func parseFields(list string) (map[string]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	fields := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !messageFields[name] {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// ProjectedMessages is the response for getMessages when ?fields= is given.
+// Each message holds only the requested fields.
+type ProjectedMessages struct {
+	Messages   []map[string]json.RawMessage `json:"messages"`
+	Page       int                          `json:"page,omitempty"`
+	Limit      int                          `json:"limit"`
+	Total      int                          `json:"total"`
+	NextCursor string                       `json:"next_cursor,omitempty"`
+}
+
+// projectMessage returns the message as a JSON object holding only the
+// wanted fields. Fields that are omitted when empty stay omitted even if
+// asked for.
+func projectMessage(m Message, fields map[string]bool) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name := range all {
+		if !fields[name] {
+			delete(all, name)
+		}
+	}
+	return all, nil
+}
+
+// projectPage projects each message in a page of getMessages results
+func projectPage(resp PaginatedMessages, fields map[string]bool) (ProjectedMessages, error) {
+	projected := ProjectedMessages{
+		Messages:   make([]map[string]json.RawMessage, len(resp.Messages)),
+		Page:       resp.Page,
+		Limit:      resp.Limit,
+		Total:      resp.Total,
+		NextCursor: resp.NextCursor,
+	}
+	for i, m := range resp.Messages {
+		var err error
+		if projected.Messages[i], err = projectMessage(m, fields); err != nil {
+			return ProjectedMessages{}, err
+		}
+	}
+	return projected, nil
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// parseMessageFilter reads the author, after, before, contains,
+// include_hidden and include_archived params that getMessages and
+// streamMessages share
+func parseMessageFilter(query url.Values) (db.MessageFilter, error) {
+	filter := db.MessageFilter{
+		Author:          query.Get("author"),
+		Contains:        query.Get("contains"),
+		IncludeHidden:   query.Get("include_hidden") == "true",
+		IncludeArchived: query.Get("include_archived") == "true",
+	}
+
+	var err error
+	if filter.After, err = parseTimeParam(query, "after"); err != nil {
+		return filter, err
+	}
+	if filter.Before, err = parseTimeParam(query, "before"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 query param, returning the zero
+// time if it is absent
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time, such as 2024-01-02T15:04:05Z", name)
+	}
+	return t, nil
+}
+
+// narrows reports whether filter does more than drop hidden messages
+func narrows(filter db.MessageFilter) bool {
+	return filter.Author != "" || filter.Contains != "" || !filter.After.IsZero() || !filter.Before.IsZero() || filter.Cursor != nil
+}
+
+// filterMessagesLocked returns a new slice of a channel's messages matching
+// filter, oldest first. When persisting, narrowing filters run as a database
+// query and the matches are taken from memory, so they carry reactions and
+// other state the database rows don't. Archived messages aren't in memory,
+// so with IncludeArchived they come from the rows. Without a database
+// nothing is ever archived. Callers must hold a.mu.
+func (a *API) filterMessagesLocked(channelID string, filter db.MessageFilter) ([]Message, error) {
+	messages := a.messages[channelID]
+	if a.db == nil || !narrows(filter) && !filter.IncludeArchived {
+		matching := make([]Message, 0, len(messages))
+		for _, m := range messages {
+			if matchesFilter(m, filter) {
+				matching = append(matching, m)
+			}
+		}
+		return matching, nil
+	}
+
+	stored, err := a.db.QueryMessages(channelID, filter)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]int, len(messages))
+	for i, m := range messages {
+		byID[m.ID] = i
+	}
+	matching := make([]Message, 0, len(stored))
+	for _, m := range stored {
+		if i, ok := byID[m.ID]; ok {
+			matching = append(matching, messages[i])
+		} else if filter.IncludeArchived {
+			matching = append(matching, messageFromDB(m))
+		}
+	}
+	return matching, nil
+}
+
+// pageMessagesLocked returns up to limit of a channel's messages matching
+// filter, in timeline order from filter.Cursor, newest first with
+// filter.Reverse. When persisting the page is read with
+// db.ListMessagesAfterCursor and matches are taken from memory as in
+// filterMessagesLocked; otherwise memory is searched from the cursor, so
+// neither copies more of the channel than one page. Callers must hold a.mu.
+func (a *API) pageMessagesLocked(channelID string, filter db.MessageFilter, limit int) ([]Message, error) {
+	if a.db == nil {
+		messages := a.messages[channelID]
+		if filter.Cursor != nil {
+			messages = messagesAfterCursor(messages, messageCursor(*filter.Cursor), filter.Reverse)
+		}
+		page := make([]Message, 0, min(limit, len(messages)))
+		for i := 0; i < len(messages) && len(page) < limit; i++ {
+			m := messages[i]
+			if filter.Reverse {
+				m = messages[len(messages)-1-i]
+			}
+			if matchesFilter(m, filter) {
+				page = append(page, m)
+			}
+		}
+		return page, nil
+	}
+
+	stored, err := a.db.ListMessagesAfterCursor(channelID, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	page := make([]Message, 0, len(stored))
+	for _, m := range stored {
+		if message, ok := a.storedMessageLocked(m); ok {
+			page = append(page, message)
+		} else if filter.IncludeArchived {
+			page = append(page, messageFromDB(m))
+		}
+	}
+	return page, nil
+}
+
+// storedMessageLocked returns the in-memory copy of a message read from the
+// database. A channel's messages are held in creation order, so it is found
+// by timestamp rather than by scanning the channel. Callers must hold a.mu.
+func (a *API) storedMessageLocked(m db.Message) (Message, bool) {
+	messages := a.messages[m.ChannelID]
+	i := sort.Search(len(messages), func(i int) bool {
+		return !messages[i].CreatedAt.Before(m.CreatedAt)
+	})
+	for ; i < len(messages) && messages[i].CreatedAt.Equal(m.CreatedAt); i++ {
+		if messages[i].ID == m.ID {
+			return messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// countMessagesLocked returns how many of a channel's messages match filter.
+// Callers must hold a.mu.
+func (a *API) countMessagesLocked(channelID string, filter db.MessageFilter) (int, error) {
+	if a.db != nil {
+		return a.db.CountMessages(channelID, filter)
+	}
+	total := 0
+	for _, m := range a.messages[channelID] {
+		if matchesFilter(m, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// matchesFilter applies filter to an in-memory message the way QueryMessages
+// does in SQL
+func matchesFilter(m Message, filter db.MessageFilter) bool {
+	return (filter.IncludeHidden || !m.Hidden) &&
+		(filter.Author == "" || m.Author == filter.Author) &&
+		(filter.After.IsZero() || m.CreatedAt.After(filter.After)) &&
+		(filter.Before.IsZero() || m.CreatedAt.Before(filter.Before)) &&
+		(filter.Contains == "" || strings.Contains(asciiLower(m.Content), asciiLower(filter.Contains))) &&
+		(filter.Cursor == nil || pastCursor(m, *filter.Cursor, filter.Reverse))
+}
+
+// asciiLower lowercases ASCII letters only, matching SQLite's LIKE
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Flag is a report that a message breaks the rules
+type Flag struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	Reporter  string    `json:"reporter"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FlagReport is an open flag together with the message it refers to
+type FlagReport struct {
+	Flag
+	Message Message `json:"message"`
+}
+
+// FlagMessageRequest is the request body for flagging a message
+type FlagMessageRequest struct {
+	Reporter string `json:"reporter"`
+	Reason   string `json:"reason"`
+}
+
+// flagMessage records a report against a message, hiding the message once
+// it has been flagged by enough distinct reporters
+func (a *API) flagMessage(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	var req FlagMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Reporter == "" {
+		http.Error(w, "Reporter is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	count := 0
+	for _, f := range a.flags {
+		if f.MessageID != messageID {
+			continue
+		}
+		if f.Reporter == req.Reporter {
+			http.Error(w, "Message already flagged by this reporter", http.StatusConflict)
+			return
+		}
+		count++
+	}
+
+	flag, err := a.createFlagLocked(Flag{
+		ChannelID: channelID,
+		MessageID: messageID,
+		Reporter:  req.Reporter,
+		Reason:    req.Reason,
+	})
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	if threshold := a.cfg.FlagHideThreshold; threshold > 0 && count+1 >= threshold && !a.messages[channelID][i].Hidden {
+		audit := newAudit(auditActorSystem, auditMessageHide, messageID, "reached the flag threshold")
+		if a.db != nil {
+			if err := a.db.SetMessageHidden(messageID, true, audit); err != nil {
+				respondStoreError(w, err)
+				return
+			}
+		}
+		a.recordAuditLocked(audit)
+		a.messages[channelID][i].Hidden = true
+		a.cache.invalidate(channelID)
+		a.broadcast(channelID, MessageDeletedEvent{
+			Frame:     newFrame("message_deleted"),
+			ChannelID: channelID,
+			MessageID: messageID,
+		})
+	}
+
+	respondJSON(w, http.StatusCreated, flag)
+}
+
+// handleFlags handles GET /api/flags, listing open reports for moderators
+func (a *API) handleFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	reports := make([]FlagReport, 0, len(a.flags))
+	for _, f := range a.flags {
+		i := a.findMessage(f.ChannelID, f.MessageID)
+		if i < 0 {
+			continue
+		}
+		reports = append(reports, FlagReport{Flag: f, Message: a.messages[f.ChannelID][i]})
+	}
+
+	respondJSON(w, http.StatusOK, reports)
+}
+
+// setMessageHidden hides or unhides a message. Hidden messages stay stored for
+// audit but are excluded from getMessages unless include_hidden=true.
+// Live clients are told to remove newly hidden messages.
+func (a *API) setMessageHidden(w http.ResponseWriter, r *http.Request, channelID, messageID string, hidden bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	action := auditMessageHide
+	if !hidden {
+		action = auditMessageUnhide
+	}
+	audit := newAudit(a.auditActor(r), action, messageID, "")
+	if a.db != nil {
+		if err := a.db.SetMessageHidden(messageID, hidden, audit); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.recordAuditLocked(audit)
+
+	message := &a.messages[channelID][i]
+	if hidden && !message.Hidden {
+		a.broadcast(channelID, MessageDeletedEvent{
+			Frame:     newFrame("message_deleted"),
+			ChannelID: channelID,
+			MessageID: messageID,
+		})
+	}
+	message.Hidden = hidden
+	a.cache.invalidate(channelID)
+
+	respondJSON(w, http.StatusOK, message)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxHighlightLength is the longest keyword, in characters, a user may register
+const maxHighlightLength = 64
+
+// HighlightRequest is the request body for registering a highlight keyword
+type HighlightRequest struct {
+	Keyword string `json:"keyword"`
+}
+
+// HighlightEvent is sent to a user when a message contains one of their keywords
+type HighlightEvent struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	Author    string `json:"author"`
+	Content   string `json:"content"`
+	Keyword   string `json:"keyword"`
+}
+
+// highlighter holds each user's highlight keywords. It lives on the Hub so
+// the REST and WebSocket send paths match against the same keywords.
+type highlighter struct {
+	mu       sync.RWMutex
+	keywords map[string]map[string]*regexp.Regexp
+}
+
+func newHighlighter() *highlighter {
+	return &highlighter{keywords: make(map[string]map[string]*regexp.Regexp)}
+}
+
+// normalizeKeyword trims and lowercases a keyword
+func normalizeKeyword(keyword string) string {
+	return strings.ToLower(strings.TrimSpace(keyword))
+}
+
+// keywordPattern matches keyword case-insensitively as a whole word. Letters,
+// digits and underscores count as word characters, so "go" matches "Go!"
+// but not "gopher".
+func keywordPattern(keyword string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^\pL\pN_])` + regexp.QuoteMeta(keyword) + `(?:$|[^\pL\pN_])`)
+}
+
+// has reports whether username has registered keyword
+func (h *highlighter) has(username, keyword string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.keywords[username][keyword]
+	return ok
+}
+
+// add registers a normalized keyword for username
+func (h *highlighter) add(username, keyword string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.keywords[username] == nil {
+		h.keywords[username] = make(map[string]*regexp.Regexp)
+	}
+	h.keywords[username][keyword] = keywordPattern(keyword)
+}
+
+// remove drops a keyword, reporting whether username had it
+func (h *highlighter) remove(username, keyword string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.keywords[username][keyword]; !ok {
+		return false
+	}
+	delete(h.keywords[username], keyword)
+	if len(h.keywords[username]) == 0 {
+		delete(h.keywords, username)
+	}
+	return true
+}
+
+// list returns username's keywords in alphabetical order
+func (h *highlighter) list(username string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	keywords := make([]string, 0, len(h.keywords[username]))
+	for keyword := range h.keywords[username] {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// match returns, for each user other than author with a keyword in content,
+// the first such keyword alphabetically
+func (h *highlighter) match(author, content string) map[string]string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	matches := make(map[string]string)
+	for username, patterns := range h.keywords {
+		if username == author {
+			continue
+		}
+		for keyword, pattern := range patterns {
+			if pattern.MatchString(content) && (matches[username] == "" || keyword < matches[username]) {
+				matches[username] = keyword
+			}
+		}
+	}
+	return matches
+}
+
+// notifyHighlights sends a highlight frame to every connected user whose
+// keywords appear in a new message
+func (h *Hub) notifyHighlights(channelID, messageID, author, content string) {
+	for username, keyword := range h.highlights.match(author, content) {
+		data, err := json.Marshal(HighlightEvent{
+			Frame:     newFrame("highlight"),
+			ChannelID: channelID,
+			MessageID: messageID,
+			Author:    author,
+			Content:   content,
+			Keyword:   keyword,
+		})
+		if err != nil {
+			log.Printf("Failed to marshal highlight: %v", err)
+			continue
+		}
+		h.sendToAuthors(map[string]bool{username: true}, data)
+	}
+}
+
+// handleHighlights handles GET and POST /api/users/:name/highlights and
+// DELETE /api/users/:name/highlights/:keyword
+func (a *API) handleHighlights(w http.ResponseWriter, r *http.Request, username, keyword string) {
+	switch {
+	case keyword == "" && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, a.hub.highlights.list(username))
+	case keyword == "" && r.Method == http.MethodPost:
+		a.addHighlight(w, r, username)
+	case keyword != "" && r.Method == http.MethodDelete:
+		a.removeHighlight(w, username, normalizeKeyword(keyword))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addHighlight registers a keyword for a user
+func (a *API) addHighlight(w http.ResponseWriter, r *http.Request, username string) {
+	var req HighlightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	keyword := normalizeKeyword(req.Keyword)
+	if keyword == "" {
+		http.Error(w, "Keyword is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(keyword) > maxHighlightLength {
+		http.Error(w, "Keyword is too long", http.StatusBadRequest)
+		return
+	}
+
+	if a.hub.highlights.has(username, keyword) {
+		http.Error(w, "Keyword already registered", http.StatusConflict)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.AddHighlight(username, keyword); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.hub.highlights.add(username, keyword)
+
+	respondJSON(w, http.StatusCreated, HighlightRequest{Keyword: keyword})
+}
+
+// removeHighlight removes a user's keyword
+func (a *API) removeHighlight(w http.ResponseWriter, username, keyword string) {
+	if !a.hub.highlights.has(username, keyword) {
+		http.Error(w, "Keyword not registered", http.StatusNotFound)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.RemoveHighlight(username, keyword); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.hub.highlights.remove(username, keyword)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestClient returns a client of hub in channelID with no connection,
+// whose frames are read straight from send
+func newTestClient(hub *Hub, cfg *Config, channelID string, buffer int) *Client {
+	return &Client{send: make(chan []byte, buffer), channelID: channelID, hub: hub, cfg: cfg, ip: "192.0.2.1"}
+}
+
+// drainTestClient collects a client's frames until Unregister closes send
+func drainTestClient(c *Client) <-chan []string {
+	done := make(chan []string, 1)
+	go func() {
+		var frames []string
+		for frame := range c.send {
+			frames = append(frames, string(frame))
+		}
+		done <- frames
+	}()
+	return done
+}
+
+// isSubsequence reports whether every element of sub appears in seq in the
+// same relative order
+func isSubsequence(sub, seq []string) bool {
+	i := 0
+	for _, s := range seq {
+		if i < len(sub) && sub[i] == s {
+			i++
+		}
+	}
+	return i == len(sub)
+}
+
+func TestHubConcurrentRegisterBroadcastUnregister(t *testing.T) {
+	const (
+		channels     = 2
+		broadcasters = 4
+		perSender    = 200
+		churners     = 16
+	)
+	cfg := DefaultConfig()
+	hub := NewHub()
+
+	// An observer per channel is registered throughout, with room for every
+	// frame, so it sees the channel's full order
+	observers := make([]*Client, channels)
+	observed := make([]<-chan []string, channels)
+	for i := range observers {
+		observers[i] = newTestClient(hub, &cfg, "c"+strconv.Itoa(i), broadcasters*perSender)
+		observed[i] = drainTestClient(observers[i])
+		hub.Register(observers[i])
+	}
+
+	var wg sync.WaitGroup
+	for b := range broadcasters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range perSender {
+				hub.Broadcast("c"+strconv.Itoa(n%channels), []byte(fmt.Sprintf("%d-%d", b, n)))
+			}
+		}()
+	}
+
+	// Other clients join and leave while the broadcasts run, some leaving
+	// twice as a failed write and the read pump both may
+	type churned struct {
+		client *Client
+		frames <-chan []string
+	}
+	results := make(chan churned, churners*4)
+	for i := range churners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 4 {
+				c := newTestClient(hub, &cfg, "c"+strconv.Itoa(i%channels), 16)
+				frames := drainTestClient(c)
+				hub.Register(c)
+				hub.Broadcast(c.channelID, []byte("hello from "+strconv.Itoa(i)))
+				hub.Unregister(c)
+				if i%2 == 0 {
+					hub.Unregister(c)
+				}
+				results <- churned{c, frames}
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	for _, o := range observers {
+		hub.Unregister(o)
+	}
+	full := make([][]string, channels)
+	for i := range observed {
+		full[i] = <-observed[i]
+		hellos := 0
+		for _, frame := range full[i] {
+			if strings.HasPrefix(frame, "hello") {
+				hellos++
+			}
+		}
+		if got, want := len(full[i])-hellos, broadcasters*perSender/channels; got != want {
+			t.Errorf("observer of c%d saw %d broadcast frames, want %d", i, got, want)
+		}
+		if want := churners * 4 / channels; hellos != want {
+			t.Errorf("observer of c%d saw %d hello frames, want %d", i, hellos, want)
+		}
+	}
+
+	for r := range results {
+		frames := <-r.frames
+		channel, _ := strconv.Atoi(r.client.channelID[1:])
+		if !isSubsequence(frames, full[channel]) {
+			t.Errorf("client in %s received frames out of the channel's order: %v", r.client.channelID, frames)
+		}
+	}
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if len(hub.channels) != 0 {
+		t.Errorf("%d channels left in the hub after every client left", len(hub.channels))
+	}
+}
+
+func TestHubBroadcastOrderIsSameForEveryClient(t *testing.T) {
+	const (
+		receivers = 64
+		perSender = 500
+	)
+	cfg := DefaultConfig()
+	hub := NewHub()
+
+	clients := make([]*Client, receivers)
+	received := make([]<-chan []string, receivers)
+	for i := range clients {
+		clients[i] = newTestClient(hub, &cfg, "general", 2*perSender+1)
+		received[i] = drainTestClient(clients[i])
+		hub.Register(clients[i])
+	}
+
+	// Two senders race, one to the channel and one to every channel
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for n := range perSender {
+			hub.Broadcast("general", []byte("a-"+strconv.Itoa(n)))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := range perSender {
+			hub.BroadcastAll([]byte("b-" + strconv.Itoa(n)))
+		}
+	}()
+	wg.Wait()
+
+	for _, c := range clients {
+		hub.Unregister(c)
+	}
+	first := <-received[0]
+	if len(first) != 2*perSender {
+		t.Fatalf("client 0 received %d frames, want %d", len(first), 2*perSender)
+	}
+	for i := 1; i < receivers; i++ {
+		frames := <-received[i]
+		if len(frames) != len(first) {
+			t.Errorf("client %d received %d frames, want %d", i, len(frames), len(first))
+			continue
+		}
+		for j := range frames {
+			if frames[j] != first[j] {
+				t.Errorf("client %d frame %d = %s, client 0 got %s", i, j, frames[j], first[j])
+				break
+			}
+		}
+	}
+}
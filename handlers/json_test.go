@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestJSONGolden(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	edited := created.Add(time.Minute)
+	message := Message{ID: "1", ChannelID: "c1", Content: "hello", Author: "alice", CreatedAt: created}
+	full := Message{
+		ID:        "2",
+		ChannelID: "c1",
+		Content:   "see https://example.com :tada:",
+		Author:    "deploybot",
+		ParentID:  "1",
+		CreatedAt: created,
+		EditedAt:  &edited,
+		Hidden:    true,
+		IsBot:     true,
+		Unfurl:    &Unfurl{URL: "https://example.com", Title: "Example"},
+		Reactions: []Reaction{{Emoji: "🎉", Count: 2, Authors: []string{"alice", "bob"}}},
+		Refs:      []Ref{{Kind: "message", Target: "1"}},
+		Metadata:  map[string]string{"build": "42"},
+		Subtype:   "system",
+	}
+
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"channel", Channel{ID: "c1", Name: "general", CreatedAt: created}},
+		{"channel_topic", Channel{ID: "c1", Name: "general", CreatedAt: created, SlowModeSeconds: 5, ReadOnly: true, Topic: "weekly sync"}},
+		{"message", message},
+		{"message_full", full},
+		{"page_empty", PaginatedMessages{Messages: []Message{}, Page: 1, Limit: 20}},
+		{"page_cursor", PaginatedMessages{Messages: []Message{message}, Limit: 20, Total: 1, NextCursor: "abc"}},
+		{"flag", Flag{ID: "f1", ChannelID: "c1", MessageID: "1", Reporter: "bob", CreatedAt: created}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.MarshalIndent(tt.value, "", "  ")
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", tt.name+".golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatalf("writing golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file: %v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s serializes as\n%s\nwant\n%s", tt.name, got, want)
+			}
+		})
+	}
+}
+
+func TestEmptyPageKeepsTotalAndMessages(t *testing.T) {
+	a := newTestAPI(t, false)
+	channel := newTestChannel(t, a, "general")
+
+	for _, query := range []string{"author=nobody", "author=nobody&cursor=" + encodeCursor(messageCursor{CreatedAt: time.Now(), ID: "1"})} {
+		w := httptest.NewRecorder()
+		a.getMessages(w, httptest.NewRequest(http.MethodGet, "/api/channels/"+channel.ID+"/messages?"+query, nil), channel.ID)
+		body := w.Body.String()
+		if !strings.Contains(body, `"total":0`) || !strings.Contains(body, `"messages":[]`) {
+			t.Errorf("GET messages?%s = %s, want an empty messages array and total 0", query, body)
+		}
+	}
+}
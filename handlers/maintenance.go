@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// errMaintenance is the WebSocket error frame sent for writes in maintenance mode
+const errMaintenance = "server is read-only for maintenance"
+
+// RejectWrites wraps the server in maintenance mode: API requests other than
+// GET, HEAD and OPTIONS get a 503, while reads and WebSocket upgrades pass
+// through. WebSocket clients are refused writes separately, since their
+// frames don't go through HTTP.
+func RejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Error(w, "Server is read-only for maintenance", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HealthResponse is the response for GET /healthz
+type HealthResponse struct {
+	Status   string `json:"status"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// handleHealth reports whether the server can serve requests, for load
+// balancers. It answers 503 when the database is unreachable. Maintenance
+// mode still counts as healthy, since reads are served, and is reported in
+// read_only.
+func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := HealthResponse{Status: "ok", ReadOnly: a.cfg.Maintenance}
+	status := http.StatusOK
+	if a.db != nil {
+		if err := a.db.PingContext(r.Context()); err != nil {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, status, resp)
+}
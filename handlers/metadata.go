@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// maxMetadataSize caps a message's metadata, in bytes of JSON
+const maxMetadataSize = 4096
+
+// parseMetadata decodes the metadata sent with a new message, which must be
+// a flat object of strings. It returns nil when raw is empty or null.
+func parseMetadata(raw json.RawMessage) (map[string]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, errors.New("must be an object")
+	}
+	metadata := make(map[string]string, len(values))
+	for key, value := range values {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return nil, fmt.Errorf("value for %q must be a string", key)
+		}
+		metadata[key] = s
+	}
+	return metadata, checkMetadata(metadata)
+}
+
+// checkMetadata enforces the limits on a message's metadata
+func checkMetadata(metadata map[string]string) error {
+	for key := range metadata {
+		if key == "" {
+			return errors.New("keys must not be empty")
+		}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMetadataSize {
+		return fmt.Errorf("exceeds %d bytes", maxMetadataSize)
+	}
+	return nil
+}
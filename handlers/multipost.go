@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxBroadcastChannels caps how many channels one broadcast may post to
+const maxBroadcastChannels = 20
+
+// BroadcastRequest is the body of POST /api/messages/broadcast
+type BroadcastRequest struct {
+	Channels []string `json:"channels"`
+	Author   string   `json:"author"`
+	Content  string   `json:"content"`
+}
+
+// BroadcastResponse holds the messages a broadcast created, keyed by channel ID
+type BroadcastResponse struct {
+	Messages map[string]Message `json:"messages"`
+}
+
+// handleBroadcast routes /api/messages/broadcast
+func (a *API) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.broadcastMessage(w, r)
+}
+
+// broadcastMessage posts the same message to several channels at once, for
+// announcements. Every channel is checked before anything is written, and
+// the messages are stored together, so either all channels get the message
+// or none do. When bot tokens are configured only bots may broadcast.
+func (a *API) broadcastMessage(w http.ResponseWriter, r *http.Request) {
+	var req BroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	content, err := a.cfg.sanitizeContent(req.Content)
+	if err != nil {
+		http.Error(w, "Message content "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Content = expandEmoji(content)
+	if req.Content == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+
+	if a.cfg.contentTooLong(req.Content) {
+		http.Error(w, fmt.Sprintf("Message content exceeds maximum length of %d characters", a.cfg.MaxMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Channels) == 0 {
+		http.Error(w, "At least one channel is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Channels) > maxBroadcastChannels {
+		http.Error(w, fmt.Sprintf("Cannot broadcast to more than %d channels", maxBroadcastChannels), http.StatusBadRequest)
+		return
+	}
+	seen := make(map[string]bool, len(req.Channels))
+	for _, channelID := range req.Channels {
+		if seen[channelID] {
+			http.Error(w, fmt.Sprintf("Channel %s is listed more than once", channelID), http.StatusBadRequest)
+			return
+		}
+		seen[channelID] = true
+	}
+
+	isBot, err := a.cfg.botAuthor(a.cfg.botFromRequest(r), req.Author)
+	if err != nil {
+		http.Error(w, "Invalid bot token", http.StatusUnauthorized)
+		return
+	}
+	if len(a.cfg.BotTokens) > 0 && !isBot {
+		http.Error(w, "Only bots can broadcast", http.StatusForbidden)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, channelID := range req.Channels {
+		if _, ok := a.channels[channelID]; !ok {
+			http.Error(w, fmt.Sprintf("Channel %s not found", channelID), http.StatusNotFound)
+			return
+		}
+		if !a.hub.readOnly.allows(channelID, isBot) {
+			http.Error(w, fmt.Sprintf("Channel %s is read-only", channelID), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Slow mode is checked everywhere before it is charged anywhere, so a
+	// rejected broadcast doesn't hold back the author's next message
+	if !isBot {
+		for _, channelID := range req.Channels {
+			if wait, ok := a.hub.slowMode.check(channelID, req.Author); !ok {
+				respondRateLimited(w, limitSlowMode, wait)
+				return
+			}
+		}
+		for _, channelID := range req.Channels {
+			a.hub.slowMode.allow(channelID, req.Author)
+		}
+	}
+
+	pending := make([]Message, len(req.Channels))
+	for i, channelID := range req.Channels {
+		pending[i] = Message{
+			ChannelID: channelID,
+			Content:   req.Content,
+			Author:    req.Author,
+			IsBot:     isBot,
+		}
+	}
+	messages, err := a.appendMessagesLocked(pending, false)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	resp := BroadcastResponse{Messages: make(map[string]Message, len(messages))}
+	for _, message := range messages {
+		a.publishMessageLocked(message)
+		a.hub.notifyHighlights(message.ChannelID, message.ID, message.Author, message.Content)
+		a.unfurlLocked(message)
+		resp.Messages[message.ChannelID] = message
+	}
+	a.hub.activity.touch(req.Author)
+	log.Printf("Message broadcast to channels %s by %s (%s)", strings.Join(req.Channels, ", "), req.Author, clientIP(r, a.cfg.TrustedProxies))
+
+	respondJSON(w, http.StatusCreated, resp)
+}
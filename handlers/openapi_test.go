@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unspecifiedRoutes are registered but deliberately left out of the spec
+var unspecifiedRoutes = map[string]bool{
+	"/openapi.json": true,
+	"/debug/hub":    true,
+}
+
+// specPaths returns the operations in the embedded spec, keyed by path
+func specPaths(t *testing.T) map[string]map[string]json.RawMessage {
+	t.Helper()
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("decoding openapi.json: %v", err)
+	}
+	return spec.Paths
+}
+
+// TestOpenAPIPathsAreRouted checks that every operation in the spec reaches
+// a handler rather than the mux's or handleChannelByID's not-found and
+// method-not-allowed fallbacks
+func TestOpenAPIPathsAreRouted(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DebugHub = true
+	for path, operations := range specPaths(t) {
+		for method := range operations {
+			method = strings.ToUpper(method)
+			if method == "PARAMETERS" {
+				continue
+			}
+			t.Run(method+" "+path, func(t *testing.T) {
+				a := NewAPI(cfg, nil)
+				channel := newTestChannel(t, a, "general")
+				message := postTestMessages(t, a, channel.ID, "hello")[0]
+				url := strings.NewReplacer(
+					"{id}", channel.ID,
+					"{messageID}", message.ID,
+					"{name}", "alice",
+					"{keyword}", "deploy",
+				).Replace(path)
+
+				mux := http.NewServeMux()
+				a.RegisterRoutes(mux)
+				w := httptest.NewRecorder()
+				// Long polls give up when the request is done
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				mux.ServeHTTP(w, httptest.NewRequestWithContext(ctx, method, url, strings.NewReader("{}")))
+
+				body := strings.TrimSpace(w.Body.String())
+				if w.Code == http.StatusMethodNotAllowed || body == "404 page not found" || body == "Not found" {
+					t.Errorf("%s %s = %d %q, want it routed", method, url, w.Code, body)
+				}
+			})
+		}
+	}
+}
+
+// TestRegisteredRoutesAreSpecified checks that every route RegisterRoutes
+// adds has at least one path in the spec
+func TestRegisteredRoutesAreSpecified(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "api.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing api.go: %v", err)
+	}
+	var routes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "RegisterRoutes" {
+			return true
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "HandleFunc" {
+				return true
+			}
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				route, _ := strconv.Unquote(lit.Value)
+				routes = append(routes, route)
+			}
+			return true
+		})
+		return false
+	})
+	if len(routes) == 0 {
+		t.Fatal("found no routes in RegisterRoutes")
+	}
+
+	paths := specPaths(t)
+	for _, route := range routes {
+		if unspecifiedRoutes[route] {
+			continue
+		}
+		found := false
+		for path := range paths {
+			if path == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(path, route)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("route %s is registered but not in openapi.json", route)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import "encoding/json"
+
+// patchField is one field of a JSON merge patch (RFC 7396). A plain pointer
+// can't tell an omitted field from an explicit null; patchField can, so an
+// omitted field leaves the value unchanged while null clears it.
+type patchField[T any] struct {
+	// Set is true when the field was present in the body, null or not
+	Set bool
+	// Null is true when the field was present as null
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for fields present in the body, so it marks
+// the field as set
+func (f *patchField[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		var zero T
+		f.Value = zero
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// update returns the value to store, which is the zero value for null, or
+// nil if the field was omitted and should be left unchanged
+func (f *patchField[T]) update() *T {
+	if !f.Set {
+		return nil
+	}
+	return &f.Value
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// Persist loads existing state from database and writes every later change
+// through to it. The in-memory maps stay the source for reads; the database
+// makes channels, messages, flags, pins, link previews, reactions, custom
+// emoji and refs survive a restart. Thread subscriptions are not persisted. Highlight keywords are
+// loaded into the hub.
+func (a *API) Persist(database *db.DB) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	channels, err := database.ListChannels()
+	if err != nil {
+		return err
+	}
+
+	storedUnfurls, err := database.ListUnfurls()
+	if err != nil {
+		return err
+	}
+	unfurls := make(map[string]*Unfurl, len(storedUnfurls))
+	for _, u := range storedUnfurls {
+		unfurls[u.MessageID] = &Unfurl{URL: u.URL, Title: u.Title, Description: u.Description}
+	}
+
+	customEmoji, err := database.ListCustomEmoji()
+	if err != nil {
+		return err
+	}
+	for _, e := range customEmoji {
+		a.customEmoji[e.Name] = CustomEmoji(e)
+	}
+
+	storedReactions, err := database.ListReactions()
+	if err != nil {
+		return err
+	}
+	reactions := make(map[string][]Reaction)
+	for _, r := range storedReactions {
+		reactions[r.MessageID], _ = toggledReactions(reactions[r.MessageID], r.Emoji, r.Author)
+	}
+	for _, r := range reactions {
+		a.resolveCustomEmojiLocked(r)
+	}
+
+	storedRefs, err := database.ListRefs()
+	if err != nil {
+		return err
+	}
+	refs := make(map[string][]Ref)
+	for _, r := range storedRefs {
+		refs[r.MessageID] = append(refs[r.MessageID], Ref{Kind: r.Kind, Target: r.Target})
+	}
+
+	for _, c := range channels {
+		channel := &Channel{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt, SlowModeSeconds: c.SlowModeSeconds, ReadOnly: c.ReadOnly, Topic: c.Topic}
+		a.channels[c.ID] = channel
+		a.indexChannelNameLocked(channel)
+		a.hub.slowMode.setCooldown(c.ID, time.Duration(c.SlowModeSeconds)*time.Second)
+		a.hub.readOnly.set(c.ID, c.ReadOnly)
+
+		stored, err := database.ListAllMessages(c.ID)
+		if err != nil {
+			return err
+		}
+		messages := make([]Message, 0, len(stored))
+		for _, m := range stored {
+			message := messageFromDB(m)
+			message.Unfurl = unfurls[m.ID]
+			message.Reactions = reactions[m.ID]
+			message.Refs = refs[m.ID]
+			messages = append(messages, message)
+		}
+		a.messages[c.ID] = messages
+
+		pinned, err := database.ListPinned(c.ID)
+		if err != nil {
+			return err
+		}
+		for _, m := range pinned {
+			a.pins[c.ID] = append(a.pins[c.ID], m.ID)
+		}
+	}
+
+	flags, err := database.ListFlags()
+	if err != nil {
+		return err
+	}
+	for _, f := range flags {
+		a.flags = append(a.flags, Flag{
+			ID:        f.ID,
+			ChannelID: f.Message.ChannelID,
+			MessageID: f.MessageID,
+			Reporter:  f.Reporter,
+			Reason:    f.Reason,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+
+	drafts, err := database.ListDrafts()
+	if err != nil {
+		return err
+	}
+	for _, d := range drafts {
+		a.drafts[draftKey{d.ChannelID, d.Author}] = Draft(d)
+	}
+
+	highlights, err := database.ListHighlights()
+	if err != nil {
+		return err
+	}
+	for _, h := range highlights {
+		a.hub.highlights.add(h.Username, h.Keyword)
+	}
+
+	users, err := database.ListActiveUsers()
+	if err != nil {
+		return err
+	}
+	if a.cfg.Maintenance {
+		// Activity is still tracked in memory, just not written
+		a.hub.activity.load(nil, users)
+	} else {
+		a.hub.activity.load(database, users)
+	}
+
+	a.db = database
+	return nil
+}
+
+// EnsureDefaultChannel creates the named channel when there are no channels
+// yet, so a fresh deployment is usable straight away. It goes through the
+// same path as any other new channel, posting the creation notice and
+// recording it in the audit log as the system. Restarts leave existing data
+// alone. Call it after Persist.
+func (a *API) EnsureDefaultChannel(name string) error {
+	name = normalizeChannelName(name)
+	if name == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.channels) > 0 {
+		return nil
+	}
+	channel, err := a.createChannelLocked(name, auditActorSystem)
+	if err != nil {
+		return err
+	}
+	log.Printf("Created default channel #%s", channel.Name)
+	return nil
+}
+
+// messageFromDB converts a stored message to its API representation
+func messageFromDB(m db.Message) Message {
+	return Message{
+		ID:        m.ID,
+		ChannelID: m.ChannelID,
+		Content:   m.Content,
+		Author:    m.Author,
+		ParentID:  m.ParentID,
+		CreatedAt: m.CreatedAt,
+		EditedAt:  m.EditedAt,
+		Hidden:    m.Hidden,
+		IsBot:     m.IsBot,
+		Metadata:  m.Metadata,
+		Subtype:   m.Subtype,
+	}
+}
+
+// unfurlToDB converts a link preview to its stored representation
+func unfurlToDB(messageID string, u Unfurl) db.Unfurl {
+	return db.Unfurl{
+		MessageID:   messageID,
+		URL:         u.URL,
+		Title:       u.Title,
+		Description: u.Description,
+		FetchedAt:   time.Now(),
+	}
+}
+
+// createChannelLocked stores a new channel, taking its ID from the database
+// when persisting, records its creation by actor and posts a notice of it
+// in the channel. Callers must hold a.mu.
+func (a *API) createChannelLocked(name, actor string) (*Channel, error) {
+	channel, _, err := a.createChannelWithMessagesLocked(name, actor, nil)
+	return channel, err
+}
+
+// createChannelWithMessagesLocked creates a channel as createChannelLocked
+// does and stores messages in it after the creation notice, in the same
+// transaction when persisting, so the channel never exists without them.
+// The messages' ChannelID is ignored. It returns the stored messages, which
+// callers publish. Callers must hold a.mu.
+func (a *API) createChannelWithMessagesLocked(name, actor string, messages []Message) (*Channel, []Message, error) {
+	channel := &Channel{Name: name, CreatedAt: time.Now()}
+	audit := newAudit(actor, auditChannelCreate, "", "#"+name)
+	notice := Message{
+		Content: fmt.Sprintf("%s created #%s", actor, name),
+		Author:  actor,
+		Subtype: db.SubtypeSystem,
+	}
+	messages = append([]Message{notice}, messages...)
+
+	if a.db != nil {
+		inserts := make([]db.NewMessage, len(messages))
+		for i, message := range messages {
+			inserts[i] = newMessageToDB(message, false)
+		}
+		stored, storedMessages, err := a.db.CreateChannelWithMessages(name, inserts, audit)
+		if err != nil {
+			return nil, nil, err
+		}
+		channel.ID = stored.ID
+		channel.CreatedAt = stored.CreatedAt
+		for i := range messages {
+			messages[i].ID = storedMessages[i].ID
+			messages[i].CreatedAt = storedMessages[i].CreatedAt
+		}
+	} else {
+		a.channelSeq++
+		channel.ID = strconv.Itoa(a.channelSeq)
+		a.assignMessageIDsLocked(messages)
+	}
+	for i := range messages {
+		messages[i].ChannelID = channel.ID
+	}
+
+	audit.Target = channel.ID
+	a.recordAuditLocked(audit)
+	a.channels[channel.ID] = channel
+	a.indexChannelNameLocked(channel)
+	a.messages[channel.ID] = []Message{}
+	a.cache.invalidate(channelListScope)
+	a.addMessagesLocked(messages)
+	a.publishMessageLocked(messages[0])
+	return channel, messages[1:], nil
+}
+
+// appendMessageLocked stores a new message, filling in its ID and creation
+// time, and wakes long-poll waiters. ifEmpty has the database recheck that
+// the channel is empty in the insert's transaction; callers must already
+// have checked the in-memory messages. Callers must hold a.mu.
+func (a *API) appendMessageLocked(message Message, ifEmpty bool) (Message, error) {
+	messages, err := a.appendMessagesLocked([]Message{message}, ifEmpty)
+	if err != nil {
+		return Message{}, err
+	}
+	return messages[0], nil
+}
+
+// appendMessagesLocked stores several new messages as appendMessageLocked
+// does, in one transaction when persisting so that either all are stored or
+// none are. It returns them with their IDs and creation times filled in.
+// Callers must hold a.mu.
+func (a *API) appendMessagesLocked(messages []Message, ifEmpty bool) ([]Message, error) {
+	messages = slices.Clone(messages)
+	if a.db != nil {
+		inserts := make([]db.NewMessage, len(messages))
+		for i, message := range messages {
+			inserts[i] = newMessageToDB(message, ifEmpty)
+		}
+		stored, err := a.db.InsertMessages(inserts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range messages {
+			messages[i].ID = stored[i].ID
+			messages[i].CreatedAt = stored[i].CreatedAt
+		}
+	} else {
+		a.assignMessageIDsLocked(messages)
+	}
+
+	a.addMessagesLocked(messages)
+	return messages, nil
+}
+
+// newMessageToDB converts a message being posted to the fields the database
+// stores for it
+func newMessageToDB(message Message, ifEmpty bool) db.NewMessage {
+	return db.NewMessage{
+		ChannelID: message.ChannelID,
+		Author:    message.Author,
+		Content:   message.Content,
+		ParentID:  message.ParentID,
+		IsBot:     message.IsBot,
+		Refs:      refsToDB(message.Refs),
+		Metadata:  message.Metadata,
+		Subtype:   message.Subtype,
+		IfEmpty:   ifEmpty,
+	}
+}
+
+// assignMessageIDsLocked gives new messages sequential IDs and the current
+// time, for when nothing is persisted. Callers must hold a.mu.
+func (a *API) assignMessageIDsLocked(messages []Message) {
+	now := time.Now()
+	for i := range messages {
+		a.messageSeq++
+		messages[i].ID = strconv.Itoa(a.messageSeq)
+		messages[i].CreatedAt = now
+	}
+}
+
+// addMessagesLocked adds stored messages to their channels in memory and
+// wakes long-poll waiters. Callers must hold a.mu.
+func (a *API) addMessagesLocked(messages []Message) {
+	for _, message := range messages {
+		a.messages[message.ChannelID] = append(a.messages[message.ChannelID], message)
+		a.cache.invalidate(message.ChannelID)
+		a.notifyLocked(message.ChannelID)
+	}
+}
+
+// createFlagLocked stores a new flag. Callers must hold a.mu.
+func (a *API) createFlagLocked(flag Flag) (Flag, error) {
+	if a.db != nil {
+		stored, err := a.db.FlagMessage(flag.MessageID, flag.Reporter, flag.Reason)
+		if err != nil {
+			return Flag{}, err
+		}
+		flag.ID = stored.ID
+		flag.CreatedAt = stored.CreatedAt
+	} else {
+		a.flagSeq++
+		flag.ID = strconv.Itoa(a.flagSeq)
+		flag.CreatedAt = time.Now()
+	}
+
+	a.flags = append(a.flags, flag)
+	return flag, nil
+}
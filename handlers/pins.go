@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ReorderPinsRequest is the request body for reordering a channel's pins
+type ReorderPinsRequest struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// PinEvent is broadcast to a channel when a message is pinned or unpinned:
+//
+//	{"type":"pin","channel_id":"...","message_id":"...","message":{...}}
+//	{"type":"unpin","channel_id":"...","message_id":"..."}
+//
+// Pin frames carry the full message so clients can render the pinned bar
+// without fetching it; unpin frames only need the ID.
+type PinEvent struct {
+	Frame
+	ChannelID string   `json:"channel_id"`
+	MessageID string   `json:"message_id"`
+	Message   *Message `json:"message,omitempty"`
+}
+
+// handlePins handles GET and PUT /api/channels/:id/pins
+func (a *API) handlePins(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		a.listPins(w, r, channelID)
+	case http.MethodPut:
+		a.reorderPins(w, r, channelID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pinnedMessages returns a channel's pinned messages in pin order.
+// Callers must hold a.mu.
+func (a *API) pinnedMessages(channelID string) []Message {
+	pinned := make([]Message, 0, len(a.pins[channelID]))
+	for _, id := range a.pins[channelID] {
+		if i := a.findMessage(channelID, id); i >= 0 {
+			pinned = append(pinned, a.messages[channelID][i])
+		}
+	}
+	return pinned
+}
+
+// listPins returns a channel's pinned messages in their curated order.
+// Messages hidden by moderation stay pinned but are left out unless
+// ?include_hidden=true, as in getMessages.
+func (a *API) listPins(w http.ResponseWriter, r *http.Request, channelID string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	pinned := a.pinnedMessages(channelID)
+	if r.URL.Query().Get("include_hidden") != "true" {
+		pinned = visibleMessages(pinned)
+	}
+	respondJSON(w, http.StatusOK, pinned)
+}
+
+// reorderPins replaces the pin order with the given list, which must contain
+// exactly the channel's currently pinned message IDs
+func (a *API) reorderPins(w http.ResponseWriter, r *http.Request, channelID string) {
+	var req ReorderPinsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	current := make(map[string]bool, len(a.pins[channelID]))
+	for _, id := range a.pins[channelID] {
+		current[id] = true
+	}
+
+	seen := make(map[string]bool, len(req.MessageIDs))
+	for _, id := range req.MessageIDs {
+		if !current[id] {
+			http.Error(w, "Message "+id+" is not pinned in this channel", http.StatusBadRequest)
+			return
+		}
+		if seen[id] {
+			http.Error(w, "Message "+id+" is listed more than once", http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != len(current) {
+		http.Error(w, "All pinned messages must be included", http.StatusBadRequest)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.ReorderPins(channelID, req.MessageIDs); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+
+	a.pins[channelID] = append([]string(nil), req.MessageIDs...)
+
+	respondJSON(w, http.StatusOK, a.pinnedMessages(channelID))
+}
+
+// pinMessage pins a message to the end of its channel's pin list
+func (a *API) pinMessage(w http.ResponseWriter, _ *http.Request, channelID, messageID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if a.isPinnedLocked(channelID, messageID) {
+		http.Error(w, "Message already pinned", http.StatusConflict)
+		return
+	}
+
+	if limit := a.cfg.MaxPinsPerChannel; limit > 0 && len(a.pins[channelID]) >= limit {
+		http.Error(w, "Channel has reached its pin limit", http.StatusConflict)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.PinMessage(channelID, messageID); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+
+	a.pins[channelID] = append(a.pins[channelID], messageID)
+	message := a.messages[channelID][i]
+	a.broadcast(channelID, PinEvent{
+		Frame:     newFrame("pin"),
+		ChannelID: channelID,
+		MessageID: messageID,
+		Message:   &message,
+	})
+
+	respondJSON(w, http.StatusOK, message)
+}
+
+// unpinMessage removes a message from its channel's pin list
+func (a *API) unpinMessage(w http.ResponseWriter, _ *http.Request, channelID, messageID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	if !a.isPinnedLocked(channelID, messageID) {
+		http.Error(w, "Message not pinned", http.StatusNotFound)
+		return
+	}
+
+	if a.db != nil {
+		if err := a.db.UnpinMessage(channelID, messageID); err != nil {
+			respondStoreError(w, err)
+			return
+		}
+	}
+	a.removePin(channelID, messageID)
+
+	a.broadcast(channelID, PinEvent{
+		Frame:     newFrame("unpin"),
+		ChannelID: channelID,
+		MessageID: messageID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isPinnedLocked reports whether a message is pinned in its channel.
+// Callers must hold a.mu.
+func (a *API) isPinnedLocked(channelID, messageID string) bool {
+	for _, id := range a.pins[channelID] {
+		if id == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// removePin drops a message from its channel's pin list, reporting whether it
+// was pinned. Callers must hold a.mu.
+func (a *API) removePin(channelID, messageID string) bool {
+	pins := a.pins[channelID]
+	for i, id := range pins {
+		if id == messageID {
+			a.pins[channelID] = append(pins[:i:i], pins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
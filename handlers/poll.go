@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+// pollTimeout is the longest a long-poll request waits for a new message
+const pollTimeout = 30 * time.Second
+
+// notifyLocked wakes every long-poll waiter on a channel. Waiters share one
+// channel that is closed and replaced on each new message. Callers must hold a.mu.
+func (a *API) notifyLocked(channelID string) {
+	if ch, ok := a.waiters[channelID]; ok {
+		close(ch)
+		delete(a.waiters, channelID)
+	}
+}
+
+// waitChanLocked returns a channel that is closed when the next message is
+// posted to channelID. Callers must hold a.mu.
+func (a *API) waitChanLocked(channelID string) chan struct{} {
+	ch, ok := a.waiters[channelID]
+	if !ok {
+		ch = make(chan struct{})
+		a.waiters[channelID] = ch
+	}
+	return ch
+}
+
+// messagesAfterLocked returns up to limit visible messages posted after the
+// message with ID after, or all new messages if after is empty. The boolean
+// is false if after does not exist. Callers must hold a.mu.
+func (a *API) messagesAfterLocked(channelID, after string, limit int) ([]Message, bool) {
+	messages := a.messages[channelID]
+	start := len(messages)
+	if after != "" {
+		i := a.findMessage(channelID, after)
+		if i < 0 {
+			return nil, false
+		}
+		start = i + 1
+	}
+
+	newer := visibleMessages(messages[start:])
+	if len(newer) > limit {
+		newer = newer[:limit]
+	}
+	return newer, true
+}
+
+// pollMessages handles GET /api/channels/:id/messages/poll?after=<messageID>.
+// It returns immediately if messages newer than after exist, otherwise waits
+// up to pollTimeout for one and returns an empty array if none arrives.
+func (a *API) pollMessages(w http.ResponseWriter, r *http.Request, channelID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	after := r.URL.Query().Get("after")
+
+	a.mu.Lock()
+	if _, ok := a.channels[channelID]; !ok {
+		a.mu.Unlock()
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	messages, ok := a.messagesAfterLocked(channelID, after, a.cfg.MaxPageSize)
+	if !ok {
+		a.mu.Unlock()
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if len(messages) > 0 {
+		a.mu.Unlock()
+		respondJSON(w, http.StatusOK, messages)
+		return
+	}
+
+	// Without an after ID, anchor on the current newest message so the wait
+	// only reports messages posted from now on
+	if after == "" {
+		if existing := a.messages[channelID]; len(existing) > 0 {
+			after = existing[len(existing)-1].ID
+		}
+	}
+	wait := a.waitChanLocked(channelID)
+	a.mu.Unlock()
+
+	timer := time.NewTimer(pollTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-wait:
+	case <-timer.C:
+		respondJSON(w, http.StatusOK, []Message{})
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	a.mu.RLock()
+	messages, _ = a.messagesAfterLocked(channelID, after, a.cfg.MaxPageSize)
+	a.mu.RUnlock()
+
+	if messages == nil {
+		messages = []Message{}
+	}
+	respondJSON(w, http.StatusOK, messages)
+}
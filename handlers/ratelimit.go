@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit names used in rate limit responses
+const (
+	// limitSlowMode is the per-channel slow mode cooldown
+	limitSlowMode = "slow_mode"
+	// limitConnections is the cap on WebSocket connections per client IP
+	limitConnections = "ws_connections_per_ip"
+)
+
+// RateLimitedResponse is the body of every 429, so clients can back off the
+// same way whichever limit they hit
+type RateLimitedResponse struct {
+	Error             string `json:"error"`
+	Limit             string `json:"limit"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	RetryAt           string `json:"retry_at"`
+}
+
+// newRateLimited describes a rejection by limit, retryable after retryAfter
+func newRateLimited(limit string, retryAfter time.Duration) RateLimitedResponse {
+	seconds := waitSeconds(retryAfter)
+	return RateLimitedResponse{
+		Error:             fmt.Sprintf("Rate limited by %s: retry in %ds", limit, seconds),
+		Limit:             limit,
+		RetryAfterSeconds: seconds,
+		RetryAt:           time.Now().Add(time.Duration(seconds) * time.Second).UTC().Format(time.RFC3339),
+	}
+}
+
+// respondRateLimited writes a 429 with a Retry-After header, in whole
+// seconds, and a RateLimitedResponse body
+func respondRateLimited(w http.ResponseWriter, limit string, retryAfter time.Duration) {
+	body := newRateLimited(limit, retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(body.RetryAfterSeconds))
+	respondJSON(w, http.StatusTooManyRequests, body)
+}
+
+// RateLimitedFrame is the WebSocket counterpart of a 429. It is an error
+// frame, so clients that only read the text still show it, with the retry
+// fields alongside.
+type RateLimitedFrame struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+	RateLimitedResponse
+}
+
+// sendRateLimited queues a rate limit error frame for this client only
+func (c *Client) sendRateLimited(limit string, retryAfter time.Duration) {
+	body := newRateLimited(limit, retryAfter)
+	body.Error = fmt.Sprintf("rate limited by %s: retry in %ds", limit, body.RetryAfterSeconds)
+	outMsg, err := json.Marshal(RateLimitedFrame{
+		Frame:               newFrame("error"),
+		ChannelID:           c.channelID,
+		RateLimitedResponse: body,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal rate limit frame: %v", err)
+		return
+	}
+
+	c.hub.sendTo(c, outMsg)
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gastowndemo/db"
+)
+
+// maxReactionLength caps a reaction emoji, in runes, leaving room for
+// multi-codepoint sequences such as skin tones and flags
+const maxReactionLength = 16
+
+// errMessageNotFound is returned when a WebSocket client reacts to a message
+// that isn't in its channel
+var errMessageNotFound = errors.New("message not found")
+
+// Reaction is one emoji on a message and how many authors reacted with it
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+
+	// URL is the image for a custom emoji, and empty for unicode ones
+	URL string `json:"url,omitempty"`
+
+	// Authors lists who reacted, in the order they reacted. It is kept for
+	// toggling but left out of responses, since popular messages can have
+	// thousands; clients page through it with listReactionAuthors.
+	Authors []string `json:"-"`
+
+	// ReactedByViewer reports whether the ?viewer= of a message listing
+	// gave this reaction, and is omitted when no viewer was given
+	ReactedByViewer *bool `json:"reacted_by_viewer,omitempty"`
+}
+
+// PaginatedReactionAuthors is one page of the authors who reacted to a
+// message with one emoji
+type PaginatedReactionAuthors struct {
+	MessageID string   `json:"message_id"`
+	Emoji     string   `json:"emoji"`
+	Authors   []string `json:"authors"`
+	Page      int      `json:"page"`
+	Limit     int      `json:"limit"`
+	Total     int      `json:"total"`
+}
+
+// ToggleReactionRequest is the request body for toggling a reaction
+type ToggleReactionRequest struct {
+	Author string `json:"author"`
+	Emoji  string `json:"emoji"`
+}
+
+// ToggleReactionResponse reports whether the author's reaction is now on the
+// message, along with all of the message's reactions
+type ToggleReactionResponse struct {
+	MessageID string     `json:"message_id"`
+	Emoji     string     `json:"emoji"`
+	Reacted   bool       `json:"reacted"`
+	Reactions []Reaction `json:"reactions"`
+}
+
+// ReactionsUpdatedEvent carries a message's reactions after one changes
+type ReactionsUpdatedEvent struct {
+	Frame
+	ChannelID string     `json:"channel_id"`
+	MessageID string     `json:"message_id"`
+	Reactions []Reaction `json:"reactions"`
+}
+
+// reactionsForViewer returns a copy of messages whose reactions record
+// whether viewer gave each one. Callers must hold a.mu, since the reactions
+// are read from the stored messages. An empty viewer leaves messages as they
+// are.
+func reactionsForViewer(messages []Message, viewer string) []Message {
+	if viewer == "" {
+		return messages
+	}
+
+	marked := make([]Message, len(messages))
+	for i, m := range messages {
+		if len(m.Reactions) > 0 {
+			reactions := make([]Reaction, len(m.Reactions))
+			for j, r := range m.Reactions {
+				reacted := slices.Contains(r.Authors, viewer)
+				r.ReactedByViewer = &reacted
+				reactions[j] = r
+			}
+			m.Reactions = reactions
+		}
+		marked[i] = m
+	}
+	return marked
+}
+
+// toggleReaction handles POST /api/channels/:id/messages/:msgID/reactions/toggle,
+// adding the author's reaction if they haven't reacted with that emoji and
+// removing it otherwise. The check and the change happen under a.mu, and in
+// one transaction when persisting, so rapid repeat clicks alternate cleanly.
+func (a *API) toggleReaction(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ToggleReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	emoji, ok := parseReaction(req.Emoji)
+	if !ok {
+		http.Error(w, "Emoji must be a single emoji or :shortcode:", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	reactions, reacted, err := a.toggleReactionLocked(channelID, i, emoji, req.Author)
+	switch {
+	case errors.Is(err, errUnknownEmoji):
+		http.Error(w, "Unknown emoji "+emoji, http.StatusBadRequest)
+		return
+	case err != nil:
+		respondStoreError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ToggleReactionResponse{
+		MessageID: messageID,
+		Emoji:     emoji,
+		Reacted:   reacted,
+		Reactions: reactions,
+	})
+}
+
+// parseReaction trims and expands a reaction's emoji, reporting whether the
+// result is a single emoji or a :name: that may be a custom emoji. Whether
+// the name is registered is checked when the reaction is added.
+func parseReaction(raw string) (string, bool) {
+	emoji := expandEmoji(strings.TrimSpace(raw))
+	if _, ok := customEmojiName(emoji); ok {
+		return emoji, true
+	}
+	if utf8.RuneCountInString(emoji) > maxReactionLength || !isEmoji(emoji) {
+		return "", false
+	}
+	return emoji, true
+}
+
+// isEmoji reports whether s looks like a single emoji: symbols, joined by
+// zero-width joiners and followed by variation selectors, skin tones or
+// flag tags, or a keycap such as 1️⃣. It errs on the side of accepting,
+// since new emoji are added every year.
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return false
+	}
+	if runes[len(runes)-1] == '\u20e3' {
+		return len(runes) <= 3 && strings.ContainsRune("0123456789#*", runes[0]) &&
+			(len(runes) == 2 || runes[1] == '\ufe0f')
+	}
+
+	symbol := false
+	for _, r := range runes {
+		switch {
+		case unicode.Is(unicode.So, r), r == '\u203c', r == '\u2049':
+			symbol = true
+		case r == '\u200d', unicode.Is(unicode.Mn, r), unicode.Is(unicode.Sk, r), r >= 0xe0020 && r <= 0xe007f:
+		default:
+			return false
+		}
+	}
+	return symbol
+}
+
+// toggleReactionLocked toggles author's emoji on the i'th message in a
+// channel and broadcasts the message's new reactions. It returns them and
+// whether the author's reaction is now on, or errUnknownEmoji for an
+// unregistered :name:, or db.ErrTooManyEmoji or db.ErrTooManyReactions if
+// adding it would break a limit; when persisting the limits are checked by
+// db.ToggleReaction in its transaction, and its answer of whether the
+// reaction is now on wins over the in-memory state. Removing a reaction is
+// always allowed. Callers must hold a.mu.
+func (a *API) toggleReactionLocked(channelID string, i int, emoji, author string) ([]Reaction, bool, error) {
+	message := &a.messages[channelID][i]
+	reactions, reacted := toggledReactions(message.Reactions, emoji, author)
+	if reacted {
+		if err := a.checkCustomEmojiLocked(emoji); err != nil {
+			return nil, false, err
+		}
+	}
+	if a.db != nil {
+		added, err := a.db.ToggleReaction(message.ID, emoji, author, a.cfg.reactionLimits())
+		if err != nil {
+			return nil, false, err
+		}
+		if added != reacted {
+			// Memory had the reaction the other way round from the
+			// database, so after the toggle the database holds what
+			// memory already does
+			log.Printf("Reaction %s by %s on message %s was out of sync with the database", emoji, author, message.ID)
+			reactions, reacted = message.Reactions, added
+		}
+	} else if reacted {
+		if err := checkReactionLimits(a.cfg.reactionLimits(), message.Reactions, emoji, author); err != nil {
+			return nil, false, err
+		}
+	}
+	a.resolveCustomEmojiLocked(reactions)
+	message.Reactions = reactions
+	a.cache.invalidate(channelID)
+
+	a.broadcast(channelID, ReactionsUpdatedEvent{
+		Frame:     newFrame("reactions_updated"),
+		ChannelID: channelID,
+		MessageID: message.ID,
+		Reactions: reactions,
+	})
+	return reactions, reacted, nil
+}
+
+// setReaction adds author's emoji to a message, or removes it if on is
+// false, for WebSocket clients. Unlike toggling it is idempotent: asking
+// for the state the reaction is already in changes nothing. It returns
+// errMessageNotFound if the message isn't in the channel.
+func (a *API) setReaction(channelID, messageID, emoji, author string, on bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		return errMessageNotFound
+	}
+
+	reacted := false
+	for _, r := range a.messages[channelID][i].Reactions {
+		if r.Emoji == emoji {
+			reacted = slices.Contains(r.Authors, author)
+		}
+	}
+	if reacted == on {
+		return nil
+	}
+	_, _, err := a.toggleReactionLocked(channelID, i, emoji, author)
+	return err
+}
+
+// handleReaction processes a react or unreact frame, adding or removing the
+// client's author's reaction on a message in the client's channel. Other
+// clients, and this one, learn of the change from the reactions_updated
+// broadcast.
+func (c *Client) handleReaction(msg WSMessage) {
+	if c.cfg.Maintenance {
+		c.sendError(errMaintenance)
+		return
+	}
+	if c.author == "" {
+		c.sendError("reacting requires connecting with an author")
+		return
+	}
+	if msg.MessageID == "" {
+		c.sendError(msg.Type + " requires message_id")
+		return
+	}
+	emoji, ok := parseReaction(msg.Emoji)
+	if !ok {
+		c.sendError("emoji must be a single emoji or :shortcode:")
+		return
+	}
+	if c.hub.react == nil {
+		c.sendError("reactions are not available")
+		return
+	}
+
+	err := c.hub.react(c.channelID, msg.MessageID, emoji, c.author, msg.Type == "react")
+	switch {
+	case err == nil:
+	case errors.Is(err, errMessageNotFound):
+		c.sendError("message not found")
+	case errors.Is(err, errUnknownEmoji):
+		c.sendError("unknown emoji " + emoji)
+	case errors.Is(err, db.ErrTooManyEmoji):
+		c.sendError(fmt.Sprintf("message already has the maximum of %d different reactions", c.cfg.MaxReactionEmoji))
+	case errors.Is(err, db.ErrTooManyReactions):
+		c.sendError(fmt.Sprintf("you already have the maximum of %d reactions on this message", c.cfg.MaxReactionsPerAuthor))
+	case errors.Is(err, db.ErrBusy):
+		c.sendError("database busy, try again")
+	default:
+		log.Printf("Failed to save reaction from %s: %v", c.ip, err)
+		c.sendError("failed to save reaction")
+	}
+}
+
+// reactionLimits returns the configured limits on a message's reactions
+func (c *Config) reactionLimits() db.ReactionLimits {
+	return db.ReactionLimits{MaxEmoji: c.MaxReactionEmoji, MaxPerAuthor: c.MaxReactionsPerAuthor}
+}
+
+// checkReactionLimits applies limits to in-memory reactions as
+// db.ToggleReaction does, returning db.ErrTooManyEmoji or
+// db.ErrTooManyReactions if adding author's emoji to a message with the
+// given reactions would break them
+func checkReactionLimits(limits db.ReactionLimits, reactions []Reaction, emoji, author string) error {
+	isNew := !slices.ContainsFunc(reactions, func(r Reaction) bool { return r.Emoji == emoji })
+	if limits.MaxEmoji > 0 && isNew && len(reactions) >= limits.MaxEmoji {
+		return db.ErrTooManyEmoji
+	}
+
+	if limits.MaxPerAuthor > 0 {
+		given := 0
+		for _, r := range reactions {
+			if slices.Contains(r.Authors, author) {
+				given++
+			}
+		}
+		if given >= limits.MaxPerAuthor {
+			return db.ErrTooManyReactions
+		}
+	}
+	return nil
+}
+
+// toggledReactions returns a copy of reactions with author's emoji added or
+// removed, and whether it was added. The input is never modified, since
+// snapshots of a message may still be reading it.
+func toggledReactions(reactions []Reaction, emoji, author string) ([]Reaction, bool) {
+	out := slices.Clone(reactions)
+
+	i := slices.IndexFunc(out, func(r Reaction) bool { return r.Emoji == emoji })
+	if i < 0 {
+		return append(out, Reaction{Emoji: emoji, Count: 1, Authors: []string{author}}), true
+	}
+
+	authors := out[i].Authors
+	if j := slices.Index(authors, author); j >= 0 {
+		authors = slices.Delete(slices.Clone(authors), j, j+1)
+	} else {
+		authors = append(slices.Clip(authors), author)
+	}
+	if len(authors) == 0 {
+		return slices.Delete(out, i, i+1), false
+	}
+
+	added := len(authors) > len(out[i].Authors)
+	out[i] = Reaction{Emoji: emoji, Count: len(authors), Authors: authors}
+	return out, added
+}
+
+// listReactionAuthors handles GET /api/channels/:id/messages/:msgID/reactions?emoji=,
+// returning a page of the authors who reacted with that emoji
+func (a *API) listReactionAuthors(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	emoji := expandEmoji(strings.TrimSpace(r.URL.Query().Get("emoji")))
+	if emoji == "" {
+		http.Error(w, "Emoji is required", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := a.parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := (page - 1) * limit
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	resp := PaginatedReactionAuthors{
+		MessageID: messageID,
+		Emoji:     emoji,
+		Authors:   []string{},
+		Page:      page,
+		Limit:     limit,
+	}
+
+	if a.db != nil {
+		authors, total, err := a.db.ListReactionAuthors(messageID, emoji, limit, offset)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		resp.Authors, resp.Total = authors, total
+	} else {
+		reactions := a.messages[channelID][i].Reactions
+		if j := slices.IndexFunc(reactions, func(r Reaction) bool { return r.Emoji == emoji }); j >= 0 {
+			authors := reactions[j].Authors
+			resp.Total = len(authors)
+			resp.Authors = append(resp.Authors, authors[min(offset, len(authors)):min(offset+limit, len(authors))]...)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gastowndemo/db"
+)
+
+func TestToggleReactionLimits(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			a.cfg.MaxReactionEmoji = 2
+			a.cfg.MaxReactionsPerAuthor = 1
+			channel := newTestChannel(t, a, "general")
+			msg := postTestMessages(t, a, channel.ID, "vote")[0]
+
+			toggle := func(emoji, author string) int {
+				body, _ := json.Marshal(ToggleReactionRequest{Author: author, Emoji: emoji})
+				w := httptest.NewRecorder()
+				a.toggleReaction(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))), channel.ID, msg.ID)
+				return w.Code
+			}
+
+			steps := []struct {
+				name          string
+				emoji, author string
+				want          int
+			}{
+				{"first", "👍", "bob", http.StatusOK},
+				{"second emoji", "👎", "carol", http.StatusOK},
+				{"third emoji", "🎉", "dave", http.StatusConflict},
+				{"second from one author", "👎", "bob", http.StatusConflict},
+				{"removing", "👍", "bob", http.StatusOK},
+				{"after removing", "👎", "bob", http.StatusOK},
+			}
+			for _, step := range steps {
+				if got := toggle(step.emoji, step.author); got != step.want {
+					t.Errorf("%s: toggle %s as %s = %d, want %d", step.name, step.emoji, step.author, got, step.want)
+				}
+			}
+
+			reactions := a.messages[channel.ID][a.findMessage(channel.ID, msg.ID)].Reactions
+			if len(reactions) != 1 || reactions[0].Emoji != "👎" || reactions[0].Count != 2 {
+				t.Errorf("reactions = %+v, want 👎 from carol and bob", reactions)
+			}
+		})
+	}
+}
+
+func TestToggleReactionFollowsDatabase(t *testing.T) {
+	a := newTestAPI(t, true)
+	channel := newTestChannel(t, a, "general")
+	msg := postTestMessages(t, a, channel.ID, "vote")[0]
+
+	toggle := func() ToggleReactionResponse {
+		body, _ := json.Marshal(ToggleReactionRequest{Author: "bob", Emoji: "👍"})
+		w := httptest.NewRecorder()
+		a.toggleReaction(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))), channel.ID, msg.ID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("toggle = %d %s", w.Code, w.Body)
+		}
+		var resp ToggleReactionResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		return resp
+	}
+	// toggleBehindAPI changes the database without the API knowing
+	toggleBehindAPI := func() {
+		if _, err := a.db.ToggleReaction(msg.ID, "👍", "bob", db.ReactionLimits{}); err != nil {
+			t.Fatalf("ToggleReaction: %v", err)
+		}
+	}
+	stored := func() []Reaction {
+		return a.messages[channel.ID][a.findMessage(channel.ID, msg.ID)].Reactions
+	}
+
+	// The database has the reaction and memory doesn't, so toggling removes it
+	toggleBehindAPI()
+	if resp := toggle(); resp.Reacted || len(resp.Reactions) != 0 || len(stored()) != 0 {
+		t.Errorf("toggle = %+v with %+v stored, want the reaction off", resp, stored())
+	}
+
+	// Memory has the reaction and the database doesn't, so toggling adds it
+	toggle()
+	toggleBehindAPI()
+	if resp := toggle(); !resp.Reacted || len(resp.Reactions) != 1 || len(stored()) != 1 {
+		t.Errorf("toggle = %+v with %+v stored, want the reaction on", resp, stored())
+	}
+	if reactions, err := a.db.ListReactions(); err != nil || len(reactions) != 1 {
+		t.Errorf("ListReactions = %+v, %v, want bob's 👍", reactions, err)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import "sync"
+
+// readOnlyChannels tracks channels that only accept posts from bot authors.
+// It lives on the Hub so the REST and WebSocket send paths enforce the same
+// state.
+type readOnlyChannels struct {
+	mu       sync.RWMutex
+	channels map[string]bool
+}
+
+func newReadOnlyChannels() *readOnlyChannels {
+	return &readOnlyChannels{channels: make(map[string]bool)}
+}
+
+// set marks a channel read-only or lifts the restriction
+func (r *readOnlyChannels) set(channelID string, readOnly bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if readOnly {
+		r.channels[channelID] = true
+	} else {
+		delete(r.channels, channelID)
+	}
+}
+
+// allows reports whether an author, authenticated as a bot or not, may post
+// in channelID
+func (r *readOnlyChannels) allows(channelID string, isBot bool) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return !r.channels[channelID] || isBot
+}
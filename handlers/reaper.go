@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// staleAfterPings is how many ping intervals a client may go without a pong
+// before the reaper disconnects it
+const staleAfterPings = 3
+
+// handlePong records that the client answered a ping
+func (c *Client) handlePong(string) error {
+	c.lastPong.Store(time.Now().UnixNano())
+	return nil
+}
+
+// RunReaper disconnects clients that have stopped answering pings, every
+// interval until ctx is done. A dead peer normally makes readPump fail, but
+// a connection whose TCP session silently vanished can block a read forever
+// and keep its goroutines and hub entry alive. Zero disables reaping.
+func (h *Hub) RunReaper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := h.reapStale(now.Add(-staleAfterPings * interval)); n > 0 {
+				log.Printf("Reaped %d stale WebSocket connections", n)
+			}
+		}
+	}
+}
+
+// reapStale unregisters and closes every client whose last pong is before
+// cutoff, returning how many there were
+func (h *Hub) reapStale(cutoff time.Time) int {
+	h.mu.RLock()
+	var stale []*Client
+	for _, ch := range h.channels {
+		for client := range ch.clients {
+			if client.lastPong.Load() < cutoff.UnixNano() {
+				stale = append(stale, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range stale {
+		h.Unregister(client)
+		client.conn.Close()
+	}
+	h.reaped.Add(int64(len(stale)))
+	return len(stale)
+}
+
+// HubStats is the response for GET /api/stats
+type HubStats struct {
+	Connections int   `json:"connections"`
+	Reaped      int64 `json:"reaped"`
+}
+
+// Stats returns the number of open WebSocket connections and how many stale
+// ones the reaper has closed since startup
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := HubStats{Reaped: h.reaped.Load()}
+	for _, ch := range h.channels {
+		stats.Connections += len(ch.clients)
+	}
+	return stats
+}
+
+// handleStats handles GET /api/stats
+func (a *API) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	respondJSON(w, http.StatusOK, a.hub.Stats())
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// receiptTTL is how long a broadcast message accepts delivery receipts
+const receiptTTL = time.Minute
+
+// delivery tracks which clients a broadcast message was queued for and how
+// many of them have acknowledged it
+type delivery struct {
+	sender    *Client
+	acked     map[*Client]bool
+	delivered int
+	expires   time.Time
+}
+
+// deliveryReceipts aggregates receipts for recently broadcast messages. Nothing
+// is persisted; entries expire after receiptTTL.
+type deliveryReceipts struct {
+	mu      sync.Mutex
+	pending map[string]*delivery
+}
+
+// newDeliveryReceipts creates an empty receipt tracker
+func newDeliveryReceipts() *deliveryReceipts {
+	return &deliveryReceipts{
+		pending: make(map[string]*delivery),
+	}
+}
+
+// startLocked begins accepting receipts for messageID and returns the entry
+// so the caller can record recipients as the message is queued. Callers must
+// hold d.mu.
+func (d *deliveryReceipts) startLocked(messageID string, sender *Client) *delivery {
+	now := time.Now()
+	for id, p := range d.pending {
+		if now.After(p.expires) {
+			delete(d.pending, id)
+		}
+	}
+
+	p := &delivery{
+		sender:  sender,
+		acked:   make(map[*Client]bool),
+		expires: now.Add(receiptTTL),
+	}
+	d.pending[messageID] = p
+	return p
+}
+
+// ack records a receipt from client and returns the message's sender and new
+// delivered count. It returns a nil sender if the receipt should be ignored:
+// the message is unknown or expired, was never delivered to this client, or
+// this client already acknowledged it.
+func (d *deliveryReceipts) ack(messageID string, client *Client) (*Client, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.pending[messageID]
+	if !ok || time.Now().After(p.expires) {
+		return nil, 0
+	}
+
+	acked, received := p.acked[client]
+	if !received || acked {
+		return nil, 0
+	}
+
+	p.acked[client] = true
+	p.delivered++
+	return p.sender, p.delivered
+}
+
+// handleReceipt processes a receipt frame and tells the sender how many
+// clients have now received their message
+func (c *Client) handleReceipt(msg WSMessage) {
+	if msg.MessageID == "" {
+		c.sendError("receipt requires message_id")
+		return
+	}
+
+	sender, delivered := c.hub.receipts.ack(msg.MessageID, c)
+	if sender == nil {
+		return
+	}
+
+	out, err := json.Marshal(WSMessage{
+		Frame:       newFrame("delivered"),
+		ChannelID:   sender.channelID,
+		MessageID:   msg.MessageID,
+		DeliveredTo: delivered,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal receipt: %v", err)
+		return
+	}
+	c.hub.sendTo(sender, out)
+}
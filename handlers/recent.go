@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// recentChannelsLimit bounds how many channels getRecentChannels returns
+const recentChannelsLimit = 10
+
+// RecentChannel is a channel with when a user last posted in it
+type RecentChannel struct {
+	Channel
+	LastPostedAt time.Time `json:"last_posted_at"`
+}
+
+// getRecentChannels returns the channels author most recently posted
+// visible messages in, latest first, for jumping back into a conversation.
+// It reflects activity, not membership, and notices don't count.
+func (a *API) getRecentChannels(w http.ResponseWriter, _ *http.Request, author string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	recent := []RecentChannel{}
+	if a.db != nil {
+		stored, err := a.db.RecentChannelsByAuthor(author, recentChannelsLimit)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		for _, c := range stored {
+			if channel, ok := a.channels[c.ID]; ok {
+				recent = append(recent, RecentChannel{Channel: *channel, LastPostedAt: c.LastPostedAt})
+			}
+		}
+		respondJSON(w, http.StatusOK, recent)
+		return
+	}
+
+	for id, channel := range a.channels {
+		messages := a.messages[id]
+		// Messages are appended in creation order, so the first match from
+		// the end is the latest
+		for i := len(messages) - 1; i >= 0; i-- {
+			m := messages[i]
+			if m.Author == author && !m.Hidden && !isNotice(m.Subtype) {
+				recent = append(recent, RecentChannel{Channel: *channel, LastPostedAt: m.CreatedAt})
+				break
+			}
+		}
+	}
+
+	sort.Slice(recent, func(i, j int) bool {
+		if !recent[i].LastPostedAt.Equal(recent[j].LastPostedAt) {
+			return recent[i].LastPostedAt.After(recent[j].LastPostedAt)
+		}
+		return recent[i].Name < recent[j].Name
+	})
+	if len(recent) > recentChannelsLimit {
+		recent = recent[:recentChannelsLimit]
+	}
+
+	respondJSON(w, http.StatusOK, recent)
+}
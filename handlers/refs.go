@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"gastowndemo/db"
+)
+
+// Kinds of thing a message may reference
+const (
+	refMessage = "message"
+	refUser    = "user"
+	refChannel = "channel"
+)
+
+// maxRefsPerMessage caps how many refs one message may carry
+const maxRefsPerMessage = 10
+
+// refSnippetLength is how much of a referenced message's content is shown, in runes
+const refSnippetLength = 100
+
+// Ref points from a message at another message, a user or a channel. Target
+// is the message ID, author name or channel name.
+type Ref struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+// ResolvedRef is a Ref with the display data clients need to render it,
+// looked up when messages are read. A broken ref points at something that
+// no longer exists, or never did, and carries no display data.
+type ResolvedRef struct {
+	Ref
+	Broken      bool   `json:"broken,omitempty"`
+	Author      string `json:"author,omitempty"`
+	IsBot       bool   `json:"is_bot,omitempty"`
+	ChannelID   string `json:"channel_id,omitempty"`
+	ChannelName string `json:"channel_name,omitempty"`
+	Snippet     string `json:"snippet,omitempty"`
+}
+
+// validateRefs checks the refs sent with a new message. Targets aren't
+// looked up here: refs that don't resolve are reported as broken on read.
+func validateRefs(refs []Ref) error {
+	if len(refs) > maxRefsPerMessage {
+		return fmt.Errorf("at most %d refs per message", maxRefsPerMessage)
+	}
+	for _, r := range refs {
+		switch r.Kind {
+		case refMessage, refUser, refChannel:
+		default:
+			return fmt.Errorf("unknown kind %q", r.Kind)
+		}
+		if r.Target == "" {
+			return errors.New("target is required")
+		}
+	}
+	return nil
+}
+
+// refsToDB converts a message's refs to their stored representation
+func refsToDB(refs []Ref) []db.Ref {
+	stored := make([]db.Ref, len(refs))
+	for i, r := range refs {
+		stored[i] = db.Ref{Position: i, Kind: r.Kind, Target: r.Target}
+	}
+	return stored
+}
+
+// resolveRefsLocked fills in ResolvedRefs for each message. The targets of
+// all the messages' refs are looked up together, in one pass over the
+// channels and one over the stored messages. Hidden messages resolve as
+// broken so their content isn't leaked. Callers must hold a.mu.
+func (a *API) resolveRefsLocked(messages []Message) {
+	wantMessages := make(map[string]*Message)
+	wantUsers := make(map[string]bool)
+	wantChannels := make(map[string]*Channel)
+	for _, m := range messages {
+		for _, r := range m.Refs {
+			switch r.Kind {
+			case refMessage:
+				wantMessages[r.Target] = nil
+			case refUser:
+				wantUsers[r.Target] = a.cfg.isBot(r.Target)
+			case refChannel:
+				wantChannels[r.Target] = nil
+			}
+		}
+	}
+	if len(wantMessages) == 0 && len(wantUsers) == 0 && len(wantChannels) == 0 {
+		return
+	}
+
+	for _, ch := range a.channels {
+		if found, ok := wantChannels[ch.Name]; ok && (found == nil || ch.CreatedAt.Before(found.CreatedAt)) {
+			wantChannels[ch.Name] = ch
+		}
+	}
+
+	if len(wantMessages) > 0 || len(wantUsers) > 0 {
+		for _, channelMessages := range a.messages {
+			for i := range channelMessages {
+				m := &channelMessages[i]
+				if m.Hidden {
+					continue
+				}
+				if _, ok := wantMessages[m.ID]; ok {
+					wantMessages[m.ID] = m
+				}
+				if _, ok := wantUsers[m.Author]; ok {
+					wantUsers[m.Author] = true
+				}
+			}
+		}
+	}
+
+	for i := range messages {
+		if len(messages[i].Refs) == 0 {
+			continue
+		}
+		resolved := make([]ResolvedRef, len(messages[i].Refs))
+		for j, r := range messages[i].Refs {
+			resolved[j] = a.resolveRefLocked(r, wantMessages, wantUsers, wantChannels)
+		}
+		messages[i].ResolvedRefs = resolved
+	}
+}
+
+// resolveRefLocked builds one ResolvedRef from the targets looked up by
+// resolveRefsLocked. users records whether each name has posted or is a bot.
+// Callers must hold a.mu.
+func (a *API) resolveRefLocked(r Ref, messages map[string]*Message, users map[string]bool, channels map[string]*Channel) ResolvedRef {
+	resolved := ResolvedRef{Ref: r, Broken: true}
+	switch r.Kind {
+	case refMessage:
+		if m := messages[r.Target]; m != nil {
+			resolved.Broken = false
+			resolved.Author = m.Author
+			resolved.IsBot = m.IsBot
+			resolved.ChannelID = m.ChannelID
+			if ch, ok := a.channels[m.ChannelID]; ok {
+				resolved.ChannelName = ch.Name
+			}
+			resolved.Snippet = snippet(m.Content, refSnippetLength)
+		}
+	case refUser:
+		if users[r.Target] {
+			resolved.Broken = false
+			resolved.Author = r.Target
+			resolved.IsBot = a.cfg.isBot(r.Target)
+		}
+	case refChannel:
+		if ch := channels[r.Target]; ch != nil {
+			resolved.Broken = false
+			resolved.ChannelID = ch.ID
+			resolved.ChannelName = ch.Name
+		}
+	}
+	return resolved
+}
+
+// snippet shortens content to at most n runes, marking the cut with an ellipsis
+func snippet(content string, n int) string {
+	runes := []rune(content)
+	if len(runes) <= n {
+		return content
+	}
+	return string(runes[:n-1]) + "…"
+}
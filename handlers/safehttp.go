@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxRedirects caps how many redirects an outbound request may follow
+const maxRedirects = 3
+
+// errBlockedAddress is returned when an outbound request would connect to a
+// non-public address
+var errBlockedAddress = errors.New("refusing to connect to a non-public address")
+
+// safeHTTPClient returns an HTTP client for fetching user-supplied URLs. It
+// refuses to connect to loopback, private, link-local, shared and other non-public
+// addresses, so the server can't be used to probe internal services. Every
+// feature that makes outbound requests must use it.
+func safeHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &safeDialer{dialer: net.Dialer{Timeout: timeout}}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// A proxy would make the connection on our behalf, bypassing the checks
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// safeDialer resolves the host itself and dials the checked IP, rather than
+// the hostname, so a DNS answer that changes between the check and the dial
+// can't point the connection somewhere private
+type safeDialer struct {
+	dialer net.Dialer
+}
+
+// DialContext connects to address if every IP its host resolves to is public
+func (d *safeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return nil, fmt.Errorf("%s: %w", addr.IP, errBlockedAddress)
+		}
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// sharedAddressSpace is 100.64.0.0/10, which carrier-grade NAT and some
+// cloud networks use for internal addresses. net.IP.IsPrivate doesn't cover
+// it.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is a globally routable unicast address
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(ip)
+}
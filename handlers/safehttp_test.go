@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSafeDialerBlocksNonPublicAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{"loopback", "127.0.0.1:80"},
+		{"loopback range", "127.1.2.3:80"},
+		{"localhost by name", "localhost:80"},
+		{"link-local metadata", "169.254.169.254:80"},
+		{"link-local", "169.254.0.1:443"},
+		{"private 10/8", "10.0.0.1:80"},
+		{"private 172.16/12", "172.16.5.4:80"},
+		{"private 192.168/16", "192.168.1.1:80"},
+		{"shared address space", "100.64.0.1:80"},
+		{"shared address space top", "100.127.255.254:80"},
+		{"unspecified", "0.0.0.0:80"},
+		{"IPv6 loopback", "[::1]:80"},
+		{"IPv6 link-local", "[fe80::1]:80"},
+		{"IPv6 unique local", "[fd00::1]:80"},
+		{"IPv4-mapped loopback", "[::ffff:127.0.0.1]:80"},
+	}
+	dialer := &safeDialer{dialer: net.Dialer{Timeout: time.Second}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := dialer.DialContext(context.Background(), "tcp", tt.address)
+			if conn != nil {
+				conn.Close()
+			}
+			if !errors.Is(err, errBlockedAddress) {
+				t.Errorf("DialContext(%s) = %v, want errBlockedAddress", tt.address, err)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"2001:4860:4860::8888", true},
+		{"100.64.0.0", false},
+		{"10.255.255.255", false},
+		{"169.254.169.254", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %t, want %t", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestSafeHTTPClientRefusesLocalServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the local server")
+	}))
+	defer srv.Close()
+
+	resp, err := safeHTTPClient(time.Second).Get(srv.URL)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errBlockedAddress) {
+		t.Errorf("Get(%s) = %v, want errBlockedAddress", srv.URL, err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SanitizeMode is what happens to message content containing control or
+// format characters that can spoof how text displays or inject into logs,
+// such as NUL, ANSI escapes, right-to-left overrides and zero-width spaces.
+// Newlines and tabs are always allowed.
+type SanitizeMode string
+
+const (
+	// SanitizeStrip removes the characters and accepts what remains
+	SanitizeStrip SanitizeMode = "strip"
+
+	// SanitizeReject refuses content containing any of them
+	SanitizeReject SanitizeMode = "reject"
+)
+
+// ParseSanitizeMode validates a sanitize mode name
+func ParseSanitizeMode(name string) (SanitizeMode, error) {
+	switch mode := SanitizeMode(name); mode {
+	case SanitizeStrip, SanitizeReject:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sanitize mode %q (want %s or %s)", name, SanitizeStrip, SanitizeReject)
+	}
+}
+
+// disallowedCharError is the first disallowed character in content refused
+// under SanitizeReject
+type disallowedCharError rune
+
+func (e disallowedCharError) Error() string {
+	return fmt.Sprintf("contains disallowed character U+%04X", rune(e))
+}
+
+// disallowedChar reports whether r is a control or format character that
+// message content may not carry. The joiners and tag characters are format
+// characters too, but emoji sequences such as family and flag emoji need
+// them, and some scripts need the non-joiner.
+func disallowedChar(r rune) bool {
+	switch {
+	case r == '\n' || r == '\t':
+		return false
+	case r == '\u200c' || r == '\u200d' || (r >= 0xe0020 && r <= 0xe007f):
+		return false
+	}
+	return unicode.Is(unicode.Cc, r) || unicode.Is(unicode.Cf, r)
+}
+
+// sanitizeContent strips disallowed characters from content, or under
+// SanitizeReject returns a disallowedCharError for the first one. The zero
+// mode strips.
+func (c *Config) sanitizeContent(content string) (string, error) {
+	i := strings.IndexFunc(content, disallowedChar)
+	if i < 0 {
+		return content, nil
+	}
+	if c.Sanitize == SanitizeReject {
+		r := []rune(content[i:])[0]
+		return "", disallowedCharError(r)
+	}
+	return strings.Map(func(r rune) rune {
+		if disallowedChar(r) {
+			return -1
+		}
+		return r
+	}, content), nil
+}
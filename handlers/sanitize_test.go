@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// stripped is the result under SanitizeStrip. Content it changes is
+		// refused under SanitizeReject, naming first.
+		stripped string
+		first    rune
+	}{
+		{"plain", "hello, world", "hello, world", 0},
+		{"newlines and tabs", "line one\n\tline two\n", "line one\n\tline two\n", 0},
+		{"RTL override", "invoice_\u202egpj.exe", "invoice_gpj.exe", '\u202e'},
+		{"RTL isolate", "a\u2067b\u2069c", "abc", '\u2067'},
+		{"NUL", "ad\x00min", "admin", '\x00'},
+		{"NUL only", "\x00\x00", "", '\x00'},
+		{"NUL before RTL override", "a\x00b\u202ec\nd", "abc\nd", '\x00'},
+		{"ANSI escape", "\x1b[31mred\x1b[0m", "[31mred[0m", '\x1b'},
+		{"carriage return", "fake\rlog line", "fakelog line", '\r'},
+		{"zero-width space", "pay\u200bpal", "paypal", '\u200b'},
+		{"zero-width joiner in emoji", "👩\u200d💻", "👩\u200d💻", 0},
+		{"flag tag sequence", "🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f", "🏴\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strip := Config{Sanitize: SanitizeStrip}
+			if got, err := strip.sanitizeContent(tt.content); err != nil || got != tt.stripped {
+				t.Errorf("strip sanitizeContent(%q) = %q, %v, want %q", tt.content, got, err, tt.stripped)
+			}
+
+			reject := Config{Sanitize: SanitizeReject}
+			got, err := reject.sanitizeContent(tt.content)
+			if tt.stripped == tt.content {
+				if err != nil || got != tt.content {
+					t.Errorf("reject sanitizeContent(%q) = %q, %v, want it accepted", tt.content, got, err)
+				}
+			} else if err != disallowedCharError(tt.first) {
+				t.Errorf("reject sanitizeContent(%q) = %q, %v, want disallowed U+%04X", tt.content, got, err, tt.first)
+			}
+		})
+	}
+}
+
+func TestSendMessageSanitizes(t *testing.T) {
+	tests := []struct {
+		mode     SanitizeMode
+		content  string
+		wantCode int
+		want     string
+	}{
+		{SanitizeStrip, "invoice_\u202egpj.exe\nline\ttwo", http.StatusCreated, "invoice_gpj.exe\nline\ttwo"},
+		{SanitizeStrip, "ad\x00min", http.StatusCreated, "admin"},
+		{SanitizeStrip, "\x00\u202e", http.StatusBadRequest, ""},
+		{SanitizeReject, "invoice_\u202egpj.exe", http.StatusBadRequest, ""},
+		{SanitizeReject, "ad\x00min", http.StatusBadRequest, ""},
+		{SanitizeReject, "line\n\ttwo", http.StatusCreated, "line\n\ttwo"},
+	}
+	for i, tt := range tests {
+		t.Run(string(tt.mode)+"/"+strconv.Itoa(i), func(t *testing.T) {
+			a := newTestAPI(t, false)
+			a.cfg.Sanitize = tt.mode
+			channel := newTestChannel(t, a, "general")
+
+			body, _ := json.Marshal(CreateMessageRequest{Author: "bob", Content: tt.content})
+			w := httptest.NewRecorder()
+			a.sendMessage(w, httptest.NewRequest(http.MethodPost, "/api/channels/"+channel.ID+"/messages", strings.NewReader(string(body))), channel.ID)
+			if w.Code != tt.wantCode {
+				t.Fatalf("send %q = %d %s, want %d", tt.content, w.Code, w.Body, tt.wantCode)
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+			var message Message
+			if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil {
+				t.Fatalf("decoding message: %v", err)
+			}
+			if message.Content != tt.want {
+				t.Errorf("stored content = %q, want %q", message.Content, tt.want)
+			}
+		})
+	}
+}
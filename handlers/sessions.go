@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionPruneSize is the session count at which expired sessions are pruned
+const sessionPruneSize = 1024
+
+// wsSession is what a WebSocket client chose when it connected, kept so it
+// can reconnect with ?session= instead of sending it all again
+type wsSession struct {
+	channelID string
+	author    string
+
+	// batch is the batch query param: "true", "lines" or off
+	batch string
+
+	// lastRead is the ID of the last message in channelID the client
+	// reported reading with a read frame, or "" if it hasn't
+	lastRead string
+}
+
+// sessionEntry is a stored session. A session never expires while a client
+// is connected with it; its TTL starts when the last such client leaves.
+type sessionEntry struct {
+	wsSession
+	clients int
+	expires time.Time
+}
+
+// sessionStore keeps WebSocket sessions in memory for Config.SessionTTL
+// after their last client disconnects
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionEntry
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*sessionEntry)}
+}
+
+// get returns the session with the given ID, and false if there is none or
+// it has expired
+func (s *sessionStore) get(id string) (wsSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.sessions[id]
+	if !ok {
+		return wsSession{}, false
+	}
+	if e.clients == 0 && time.Now().After(e.expires) {
+		delete(s.sessions, id)
+		return wsSession{}, false
+	}
+	return e.wsSession, true
+}
+
+// attach stores a session for a newly connected client, replacing what it
+// held before
+func (s *sessionStore) attach(id string, session wsSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sessions) >= sessionPruneSize {
+		now := time.Now()
+		for key, e := range s.sessions {
+			if e.clients == 0 && now.After(e.expires) {
+				delete(s.sessions, key)
+			}
+		}
+	}
+
+	e, ok := s.sessions[id]
+	if !ok {
+		e = &sessionEntry{}
+		s.sessions[id] = e
+	}
+	e.wsSession = session
+	e.clients++
+}
+
+// markRead records messageID as the last message a session's client has
+// read. It is ignored if the session is gone or has moved to another
+// channel since the client connected.
+func (s *sessionStore) markRead(id, channelID, messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.sessions[id]; ok && e.channelID == channelID {
+		e.lastRead = messageID
+	}
+}
+
+// detach records that a client using the session has disconnected, starting
+// the session's TTL once no clients remain
+func (s *sessionStore) detach(id string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	e.clients--
+	if e.clients == 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+}
+
+// handleRead processes a read frame, recording message_id as the last
+// message the client has read so a resumed session replays what came after
+func (c *Client) handleRead(msg WSMessage) {
+	if c.session == "" {
+		c.sendError("read positions require sessions, which are disabled")
+		return
+	}
+	if msg.MessageID == "" {
+		c.sendError("read requires message_id")
+		return
+	}
+	c.hub.sessions.markRead(c.session, c.channelID, msg.MessageID)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestWS connects to srv's WebSocket endpoint with query and returns the
+// connection and its ready frame
+func dialTestWS(t *testing.T, srv *httptest.Server, query url.Values) (*websocket.Conn, ReadyFrame) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var ready ReadyFrame
+	readTestFrame(t, conn, &ready)
+	if ready.Type != "ready" {
+		t.Fatalf("first frame is %q, want ready", ready.Type)
+	}
+	return conn, ready
+}
+
+// readTestFrame reads the next frame from conn into v
+func readTestFrame(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(v); err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+}
+
+// markTestRead sends a read frame and waits until the server has handled
+// it, by following it with an unknown frame and waiting for that error
+func markTestRead(t *testing.T, conn *websocket.Conn, messageID string) {
+	t.Helper()
+	for _, frame := range []WSMessage{{Frame: Frame{Type: "read"}, MessageID: messageID}, {Frame: Frame{Type: "sync"}}} {
+		if err := conn.WriteJSON(frame); err != nil {
+			t.Fatalf("WriteJSON: %v", err)
+		}
+	}
+	for {
+		var msg WSMessage
+		readTestFrame(t, conn, &msg)
+		if msg.Type == "error" {
+			if !strings.Contains(msg.Error, `"sync"`) {
+				t.Fatalf("read frame failed: %s", msg.Error)
+			}
+			return
+		}
+	}
+}
+
+func TestResumedSessionReplaysFromLastRead(t *testing.T) {
+	cfg := DefaultConfig()
+	hub := NewHub()
+	a := NewAPI(cfg, hub)
+	mux := http.NewServeMux()
+	a.RegisterRoutes(mux)
+	NewWSHandler(cfg, hub).RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	channel := newTestChannel(t, a, "general")
+	other := newTestChannel(t, a, "random")
+	read := postTestMessages(t, a, channel.ID, "seen")[0]
+
+	conn, ready := dialTestWS(t, srv, url.Values{"channel": {channel.ID}, "author": {"bob"}})
+	markTestRead(t, conn, read.ID)
+	conn.Close()
+
+	missed := postTestMessages(t, a, channel.ID, "missed one", "missed two")
+
+	conn, resumed := dialTestWS(t, srv, url.Values{"session": {ready.Session}})
+	if !resumed.Resumed || resumed.Replayed != len(missed) {
+		t.Fatalf("ready = %+v, want resumed with %d replayed", resumed, len(missed))
+	}
+	for _, want := range missed {
+		var msg WSMessage
+		readTestFrame(t, conn, &msg)
+		if msg.Type != "message" || msg.ID != want.ID || msg.Content != want.Content {
+			t.Errorf("replayed %s %s %q, want message %s %q", msg.Type, msg.ID, msg.Content, want.ID, want.Content)
+		}
+		if msg.CreatedAt != want.CreatedAt.UTC().Format(time.RFC3339Nano) {
+			t.Errorf("replayed frame created_at = %s, want the message's %s", msg.CreatedAt, want.CreatedAt.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	conn.Close()
+
+	// The position belongs to the channel it was read in
+	_, moved := dialTestWS(t, srv, url.Values{"session": {ready.Session}, "channel": {other.ID}})
+	if !moved.Resumed || moved.Replayed != 0 {
+		t.Errorf("ready after switching channel = %+v, want resumed with nothing replayed", moved)
+	}
+}
+
+func TestSessionStoreMarkRead(t *testing.T) {
+	s := newSessionStore()
+	s.attach("s1", wsSession{channelID: "c1", author: "bob"})
+
+	s.markRead("s1", "c1", "m1")
+	s.markRead("s1", "c2", "m9")
+	s.markRead("missing", "c1", "m2")
+
+	got, ok := s.get("s1")
+	if !ok || got.lastRead != "m1" {
+		t.Errorf("session = %+v, %t, want lastRead m1", got, ok)
+	}
+}
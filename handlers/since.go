@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gastowndemo/db"
+)
+
+// messagesSince handles GET /api/channels/:id/messages/since?ts=<rfc3339>,
+// for simple polling clients that remember the newest timestamp they have
+// seen rather than a cursor. It returns up to MaxPageSize visible messages
+// created after ts, oldest first, or an empty array if none are newer.
+// Messages posted together share a timestamp, so a page can end partway
+// through them; when more remain, the X-Next-Cursor header holds a cursor
+// that breaks ties by ID, and the client asks again with ?cursor= instead
+// of the last message's created_at.
+func (a *API) messagesSince(w http.ResponseWriter, r *http.Request, channelID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	ts, err := parseTimeParam(query, "ts")
+	if err != nil {
+		http.Error(w, "Invalid timestamp: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := db.MessageFilter{After: ts}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Cursor = (*db.Cursor)(&c)
+	} else if ts.IsZero() {
+		http.Error(w, "Timestamp is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	// One extra message says whether the page is the last
+	messages, err := a.pageMessagesLocked(channelID, filter, a.cfg.MaxPageSize+1)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	if len(messages) > a.cfg.MaxPageSize {
+		messages = messages[:a.cfg.MaxPageSize]
+		w.Header().Set("X-Next-Cursor", encodeCursor(cursorOf(messages[len(messages)-1])))
+	}
+
+	respondJSON(w, http.StatusOK, messages)
+}
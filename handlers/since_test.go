@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// getTestSince calls messagesSince with query, returning the messages and
+// the X-Next-Cursor header
+func getTestSince(t *testing.T, a *API, channelID string, query url.Values) ([]Message, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	a.messagesSince(w, httptest.NewRequest(http.MethodGet, "/api/channels/"+channelID+"/messages/since?"+query.Encode(), nil), channelID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET since?%s = %d %s", query.Encode(), w.Code, w.Body)
+	}
+	var messages []Message
+	if err := json.Unmarshal(w.Body.Bytes(), &messages); err != nil {
+		t.Fatalf("decoding messages: %v", err)
+	}
+	return messages, w.Header().Get("X-Next-Cursor")
+}
+
+func TestMessagesSinceResumesThroughTies(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			a.cfg.MaxPageSize = 5
+			channel := newTestChannel(t, a, "general")
+			notice := a.messages[channel.ID][0]
+
+			// One batch, so every message shares a timestamp and a page
+			// boundary falls inside it
+			contents := make([]string, 12)
+			for i := range contents {
+				contents[i] = "message " + strconv.Itoa(i)
+			}
+			want := testMessageIDs(postTestMessages(t, a, channel.ID, contents...))
+
+			var got []string
+			query := url.Values{"ts": {notice.CreatedAt.Format(time.RFC3339Nano)}}
+			for range len(want) {
+				messages, next := getTestSince(t, a, channel.ID, query)
+				got = append(got, testMessageIDs(messages)...)
+				if next == "" {
+					break
+				}
+				query = url.Values{"cursor": {next}}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("paged %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMessagesSinceKeepsFullPrecision(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			channel := newTestChannel(t, a, "general")
+			posted := postTestMessages(t, a, channel.ID, "hello")[0]
+
+			// Closer than a millisecond, which rounding would lose
+			ts := posted.CreatedAt.Add(-time.Microsecond).Format(time.RFC3339Nano)
+			messages, next := getTestSince(t, a, channel.ID, url.Values{"ts": {ts}})
+			if !slices.Equal(testMessageIDs(messages), []string{posted.ID}) {
+				t.Errorf("since %s = %v, want [%s]", ts, testMessageIDs(messages), posted.ID)
+			}
+			if next != "" {
+				t.Errorf("X-Next-Cursor = %q on the last page", next)
+			}
+
+			ts = posted.CreatedAt.Format(time.RFC3339Nano)
+			if messages, _ := getTestSince(t, a, channel.ID, url.Values{"ts": {ts}}); len(messages) != 0 {
+				t.Errorf("since the message's own time = %v, want none", testMessageIDs(messages))
+			}
+		})
+	}
+}
+
+func TestMessagesSinceRequiresTimestampOrCursor(t *testing.T) {
+	a := newTestAPI(t, false)
+	channel := newTestChannel(t, a, "general")
+	for _, query := range []string{"", "cursor=not-a-cursor", "ts=yesterday"} {
+		w := httptest.NewRecorder()
+		a.messagesSince(w, httptest.NewRequest(http.MethodGet, "/api/channels/"+channel.ID+"/messages/since?"+query, nil), channel.ID)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("since?%s = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
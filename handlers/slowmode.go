@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// slowModeKey identifies one author's posts in one channel
+type slowModeKey struct {
+	channelID string
+	author    string
+}
+
+// slowMode enforces per-channel cooldowns between an author's posts. It lives
+// on the Hub so the REST and WebSocket send paths share the same state.
+type slowMode struct {
+	mu        sync.Mutex
+	cooldowns map[string]time.Duration
+	lastPost  map[slowModeKey]time.Time
+}
+
+func newSlowMode() *slowMode {
+	return &slowMode{
+		cooldowns: make(map[string]time.Duration),
+		lastPost:  make(map[slowModeKey]time.Time),
+	}
+}
+
+// setCooldown sets a channel's cooldown, with 0 turning slow mode off
+func (s *slowMode) setCooldown(channelID string, cooldown time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cooldown > 0 {
+		s.cooldowns[channelID] = cooldown
+		return
+	}
+
+	delete(s.cooldowns, channelID)
+	for key := range s.lastPost {
+		if key.channelID == channelID {
+			delete(s.lastPost, key)
+		}
+	}
+}
+
+// allow records a post by author in channelID if the channel's cooldown has
+// passed since their last one. Otherwise it returns false and how long they
+// still have to wait.
+func (s *slowMode) allow(channelID, author string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if wait, ok := s.waitLocked(channelID, author, now); !ok {
+		return wait, false
+	}
+	if _, ok := s.cooldowns[channelID]; ok {
+		s.lastPost[slowModeKey{channelID, author}] = now
+	}
+	return 0, true
+}
+
+// check is like allow but doesn't record a post, so the author's cooldown
+// isn't restarted
+func (s *slowMode) check(channelID, author string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waitLocked(channelID, author, time.Now())
+}
+
+// waitLocked returns how long author must still wait at now before posting
+// in channelID, and false if that is longer than zero. Callers must hold s.mu.
+func (s *slowMode) waitLocked(channelID, author string, now time.Time) (time.Duration, bool) {
+	cooldown, ok := s.cooldowns[channelID]
+	if !ok {
+		return 0, true
+	}
+	if last, ok := s.lastPost[slowModeKey{channelID, author}]; ok {
+		if wait := cooldown - now.Sub(last); wait > 0 {
+			return wait, false
+		}
+	}
+	return 0, true
+}
+
+// waitSeconds rounds a remaining cooldown up to whole seconds
+func waitSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// ndjsonType is the media type for newline-delimited JSON
+const ndjsonType = "application/x-ndjson"
+
+// streamChunkSize is how many messages are read under the lock at a time
+// and written between flushes
+const streamChunkSize = 100
+
+// wantsStream reports whether a getMessages request asked for every message
+// as NDJSON rather than a single page
+func wantsStream(r *http.Request) bool {
+	if r.URL.Query().Get("stream") == "true" {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == ndjsonType {
+			return true
+		}
+	}
+	return false
+}
+
+// streamMessages writes every message in a channel as one JSON object per
+// line, oldest first unless desc is set, for clients doing a full sync.
+// Pagination params are ignored; filters, viewer, tz and fields apply as
+// for getMessages. The channel is read a chunk at a time from a cursor
+// under the read lock, and each chunk is encoded after releasing it, so a
+// large channel is never copied whole and slow clients don't hold up
+// writers. Messages posted during the stream are included if they come
+// later in its order than the current position, and the stream ends early
+// if the channel is deleted.
+func (a *API) streamMessages(w http.ResponseWriter, r *http.Request, channelID string, loc *time.Location, desc bool, fields map[string]bool, filter db.MessageFilter) {
+	viewer := r.URL.Query().Get("viewer")
+	filter.Reverse = desc
+
+	// nextChunk reads the chunk after the last one, reporting false if the
+	// channel no longer exists
+	nextChunk := func() ([]Message, bool, error) {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		if _, ok := a.channels[channelID]; !ok {
+			return nil, false, nil
+		}
+		messages, err := a.pageMessagesLocked(channelID, filter, streamChunkSize)
+		if err != nil {
+			return nil, true, err
+		}
+		return reactionsForViewer(messages, viewer), true, nil
+	}
+
+	messages, ok, err := nextChunk()
+	if !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ndjsonType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for len(messages) > 0 {
+		for _, m := range localizeMessages(messages, loc) {
+			var line any = m
+			if fields != nil {
+				projected, err := projectMessage(m, fields)
+				if err != nil {
+					log.Printf("Stream to %s aborted: %v", clientIP(r, a.cfg.TrustedProxies), err)
+					return
+				}
+				line = projected
+			}
+			if err := enc.Encode(line); err != nil {
+				log.Printf("Stream to %s aborted: %v", clientIP(r, a.cfg.TrustedProxies), err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(messages) < streamChunkSize {
+			return
+		}
+
+		c := db.Cursor(cursorOf(messages[len(messages)-1]))
+		filter.Cursor = &c
+		if messages, ok, err = nextChunk(); err != nil {
+			log.Printf("Stream to %s aborted: %v", clientIP(r, a.cfg.TrustedProxies), err)
+			return
+		}
+	}
+}
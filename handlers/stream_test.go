@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestStreamMessagesWritesEveryChunk(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			channel := newTestChannel(t, a, "general")
+
+			// Enough for several chunks, with the last one partial
+			contents := make([]string, 2*streamChunkSize+5)
+			for i := range contents {
+				contents[i] = "message " + strconv.Itoa(i)
+			}
+			postTestMessages(t, a, channel.ID, contents...)
+			all := testMessageIDs(a.messages[channel.ID])
+
+			for _, order := range []string{"asc", "desc"} {
+				want := slices.Clone(all)
+				if order == "desc" {
+					slices.Reverse(want)
+				}
+
+				w := httptest.NewRecorder()
+				a.getMessages(w, httptest.NewRequest(http.MethodGet, "/api/channels/"+channel.ID+"/messages?stream=true&order="+order, nil), channel.ID)
+				if w.Code != http.StatusOK {
+					t.Fatalf("%s: stream = %d %s", order, w.Code, w.Body)
+				}
+				if got := w.Header().Get("Content-Type"); got != ndjsonType {
+					t.Errorf("%s: Content-Type = %q, want %q", order, got, ndjsonType)
+				}
+
+				var got []string
+				scanner := bufio.NewScanner(w.Body)
+				for scanner.Scan() {
+					var m Message
+					if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+						t.Fatalf("%s: decoding line %q: %v", order, scanner.Text(), err)
+					}
+					got = append(got, m.ID)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("%s: streamed %d messages, want %d in timeline order", order, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestStreamMessagesUnknownChannel(t *testing.T) {
+	a := newTestAPI(t, false)
+	w := httptest.NewRecorder()
+	a.getMessages(w, httptest.NewRequest(http.MethodGet, "/api/channels/nope/messages?stream=true", nil), "nope")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("stream of unknown channel = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
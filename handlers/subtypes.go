@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+
+	"gastowndemo/db"
+)
+
+// checkSubtype reports whether a client may post a message with subtype.
+// Notices are reserved for the server, and only bots may post as "bot".
+func checkSubtype(subtype string, isBot bool) error {
+	switch subtype {
+	case "", db.SubtypeAction:
+		return nil
+	case db.SubtypeBot:
+		if !isBot {
+			return fmt.Errorf("subtype %q is only for bot authors", subtype)
+		}
+		return nil
+	case db.SubtypeSystem, db.SubtypeJoin:
+		return fmt.Errorf("subtype %q is reserved for the server", subtype)
+	default:
+		return fmt.Errorf("unknown subtype %q", subtype)
+	}
+}
+
+// isNotice reports whether subtype marks a notice posted by the server
+func isNotice(subtype string) bool {
+	return subtype == db.SubtypeSystem || subtype == db.SubtypeJoin
+}
+
+// hasUserMessagesLocked reports whether a channel has any messages other
+// than notices, hidden ones included. Callers must hold a.mu.
+func (a *API) hasUserMessagesLocked(channelID string) bool {
+	for _, m := range a.messages[channelID] {
+		if !isNotice(m.Subtype) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ThreadSubscriptionRequest is the request body for following or unfollowing a thread
+type ThreadSubscriptionRequest struct {
+	Author string `json:"author"`
+}
+
+// ThreadResponse is a thread's parent message and its visible replies,
+// oldest first
+type ThreadResponse struct {
+	Parent  Message   `json:"parent"`
+	Replies []Message `json:"replies"`
+}
+
+// subscribeLocked adds author to the followers of a thread. Callers must hold a.mu.
+func (a *API) subscribeLocked(parentID, author string) {
+	if a.threadSubs[parentID] == nil {
+		a.threadSubs[parentID] = make(map[string]bool)
+	}
+	a.threadSubs[parentID][author] = true
+}
+
+// setThreadSubscription follows or unfollows a thread on behalf of an author
+func (a *API) setThreadSubscription(w http.ResponseWriter, r *http.Request, channelID, messageID string, subscribe bool) {
+	var req ThreadSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Author == "" {
+		http.Error(w, "Author is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if a.messages[channelID][i].ParentID != "" {
+		http.Error(w, "Replies cannot be followed; follow the thread's parent message", http.StatusBadRequest)
+		return
+	}
+
+	if subscribe {
+		a.subscribeLocked(messageID, req.Author)
+	} else {
+		delete(a.threadSubs[messageID], req.Author)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getThread returns a thread in one request. Reactions are left out unless
+// ?with_reactions=true, and a viewer param marks the viewer's own reactions,
+// as in getMessages. A reply's ID returns its whole thread. Messages hidden
+// by moderation are left out unless ?include_hidden=true, and a thread whose
+// parent is hidden is not found.
+func (a *API) getThread(w http.ResponseWriter, r *http.Request, channelID, messageID string) {
+	query := r.URL.Query()
+	withReactions := query.Get("with_reactions") == "true"
+	includeHidden := query.Get("include_hidden") == "true"
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if _, ok := a.channels[channelID]; !ok {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	messages := a.messages[channelID]
+	i := a.findMessage(channelID, messageID)
+	if i < 0 || messages[i].Hidden && !includeHidden {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	parent := messages[i]
+	if parent.ParentID != "" {
+		if i = a.findMessage(channelID, parent.ParentID); i < 0 || messages[i].Hidden && !includeHidden {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		parent = messages[i]
+	}
+
+	// Reactions are kept on the stored messages, so the whole thread's
+	// summaries come from this one pass rather than a lookup per reply
+	thread := []Message{parent}
+	for _, m := range messages {
+		if m.ParentID == parent.ID && (includeHidden || !m.Hidden) {
+			thread = append(thread, m)
+		}
+	}
+	if withReactions {
+		thread = reactionsForViewer(thread, query.Get("viewer"))
+	} else {
+		for j := range thread {
+			thread[j].Reactions = nil
+		}
+	}
+	a.resolveRefsLocked(thread)
+
+	respondJSON(w, http.StatusOK, ThreadResponse{Parent: thread[0], Replies: thread[1:]})
+}
+
+// messageFrame marshals the frame that announces a new message, a message
+// frame or a thread_reply frame for replies, stamped with the message's
+// creation time so a replayed frame carries when it was posted
+func messageFrame(message Message) ([]byte, error) {
+	frameType := "message"
+	if message.ParentID != "" {
+		frameType = "thread_reply"
+	}
+	frame := newFrame(frameType)
+	if !message.CreatedAt.IsZero() {
+		frame.CreatedAt = message.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(WSMessage{
+		Frame:     frame,
+		ID:        message.ID,
+		ChannelID: message.ChannelID,
+		Author:    message.Author,
+		Content:   message.Content,
+		ParentID:  message.ParentID,
+		IsBot:     message.IsBot,
+		Metadata:  message.Metadata,
+		Subtype:   message.Subtype,
+	})
+}
+
+// catchUp calls deliver with the message frames for up to limit visible
+// messages in a channel after lastRead, oldest first, for a resumed
+// WebSocket session. Replies are left out when thread subscriptions route
+// them to subscribers only. Nothing is replayed if lastRead isn't in the
+// channel. deliver runs under the read lock, which keeps new messages from
+// being broadcast until the client it registers can receive them.
+func (a *API) catchUp(channelID, lastRead string, limit int, deliver func(missed [][]byte)) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	messages := a.messages[channelID]
+	i := a.findMessage(channelID, lastRead)
+	if i < 0 {
+		deliver(nil)
+		return
+	}
+
+	var missed [][]byte
+	for _, m := range messages[i+1:] {
+		if len(missed) == limit {
+			break
+		}
+		if m.Hidden || m.ParentID != "" && a.cfg.ThreadSubscriptions {
+			continue
+		}
+		data, err := messageFrame(m)
+		if err != nil {
+			log.Printf("Failed to marshal message: %v", err)
+			continue
+		}
+		missed = append(missed, data)
+	}
+	deliver(missed)
+}
+
+// publishMessageLocked broadcasts a newly created message. Top-level messages
+// go to everyone in the channel. Thread replies subscribe their author and go
+// only to the thread's followers as a thread_reply frame, unless subscription
+// tracking is disabled, in which case the whole channel gets it. Callers must
+// hold a.mu.
+func (a *API) publishMessageLocked(message Message) {
+	if a.hub == nil {
+		return
+	}
+
+	data, err := messageFrame(message)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+
+	if message.ParentID == "" || !a.cfg.ThreadSubscriptions {
+		a.hub.Broadcast(message.ChannelID, data)
+		return
+	}
+
+	a.subscribeLocked(message.ParentID, message.Author)
+	a.hub.sendToAuthors(a.threadSubs[message.ParentID], data)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// ServerTiming adds a Server-Timing header reporting how long database
+// statements ran while each request was in flight. Writes are serialized on
+// one connection, so this includes statements from concurrent requests that
+// this one had to wait behind. WebSocket upgrades are never wrapped.
+func ServerTiming(next http.Handler, database *db.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&timingResponseWriter{
+			ResponseWriter: w,
+			database:       database,
+			start:          database.QueryTime(),
+		}, r)
+	})
+}
+
+// timingResponseWriter sets the Server-Timing header just before the
+// response headers are sent
+type timingResponseWriter struct {
+	http.ResponseWriter
+	database    *db.DB
+	start       time.Duration
+	wroteHeader bool
+}
+
+// setTiming sets the header once, before the first write or flush
+func (w *timingResponseWriter) setTiming() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	elapsed := w.database.QueryTime() - w.start
+	w.Header().Set("Server-Timing", fmt.Sprintf("db;desc=\"SQLite\";dur=%.3f", float64(elapsed)/float64(time.Millisecond)))
+}
+
+// WriteHeader sets the timing header and sends the status
+func (w *timingResponseWriter) WriteHeader(status int) {
+	w.setTiming()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sets the timing header if no status was sent and writes the body
+func (w *timingResponseWriter) Write(p []byte) (int, error) {
+	w.setTiming()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends the headers, if not already sent, and flushes the response
+func (w *timingResponseWriter) Flush() {
+	w.setTiming()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// trendingWindow is how far back message volume is counted
+	trendingWindow = 24 * time.Hour
+
+	// trendingLimit bounds the number of channels returned
+	trendingLimit = 20
+)
+
+// TrendingChannel is a channel with its recent message count
+type TrendingChannel struct {
+	Channel
+	RecentMessages int `json:"recent_messages"`
+}
+
+// getTrendingChannels returns the channels with the most visible messages in
+// the last 24 hours, busiest first. Notices don't count.
+func (a *API) getTrendingChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	since := time.Now().Add(-trendingWindow)
+	trending := []TrendingChannel{}
+	if a.db != nil {
+		stored, err := a.db.TrendingChannels(since, trendingLimit)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		for _, c := range stored {
+			if channel, ok := a.channels[c.ID]; ok {
+				trending = append(trending, TrendingChannel{Channel: *channel, RecentMessages: c.MessageCount})
+			}
+		}
+		respondJSON(w, http.StatusOK, trending)
+		return
+	}
+
+	for id, channel := range a.channels {
+		count := 0
+		messages := a.messages[id]
+		// Messages are appended in creation order, so scan back from the newest
+		for i := len(messages) - 1; i >= 0 && messages[i].CreatedAt.After(since); i-- {
+			if !messages[i].Hidden && !isNotice(messages[i].Subtype) {
+				count++
+			}
+		}
+		if count > 0 {
+			trending = append(trending, TrendingChannel{Channel: *channel, RecentMessages: count})
+		}
+	}
+
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].RecentMessages != trending[j].RecentMessages {
+			return trending[i].RecentMessages > trending[j].RecentMessages
+		}
+		return trending[i].Name < trending[j].Name
+	})
+
+	if len(trending) > trendingLimit {
+		trending = trending[:trendingLimit]
+	}
+
+	respondJSON(w, http.StatusOK, trending)
+}
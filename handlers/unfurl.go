@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// unfurlTimeout bounds a whole preview fetch, redirects included
+	unfurlTimeout = 5 * time.Second
+
+	// unfurlMaxBytes is how much of a page is read looking for metadata
+	unfurlMaxBytes = 256 << 10
+
+	// unfurlHostInterval is the minimum time between fetches from one host
+	unfurlHostInterval = 10 * time.Second
+
+	// unfurlMaxConcurrent caps in-flight fetches; extra links go unpreviewed
+	unfurlMaxConcurrent = 4
+
+	// unfurlMaxField caps the stored title and description, in runes
+	unfurlMaxField = 300
+)
+
+// Unfurl is link preview metadata for the first URL in a message
+type Unfurl struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// MessageUnfurledEvent tells clients in a channel that a message's link
+// preview is ready
+type MessageUnfurledEvent struct {
+	Frame
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	Unfurl    Unfurl `json:"unfurl"`
+}
+
+var (
+	// urlPattern finds http and https links in message content
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrPattern  = regexp.MustCompile(`(?is)([a-z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// unfurler fetches link previews off the request path, through
+// safeHTTPClient, and rate limits fetches per host
+type unfurler struct {
+	client *http.Client
+	slots  chan struct{}
+
+	mu        sync.Mutex
+	lastFetch map[string]time.Time
+}
+
+func newUnfurler() *unfurler {
+	return &unfurler{
+		client:    safeHTTPClient(unfurlTimeout),
+		slots:     make(chan struct{}, unfurlMaxConcurrent),
+		lastFetch: make(map[string]time.Time),
+	}
+}
+
+// firstURL returns the first http or https link in content outside code, or
+// "" if there is none
+func firstURL(content string) string {
+	text := codePattern.ReplaceAllString(content, " ")
+	raw := strings.TrimRight(urlPattern.FindString(text), ".,;:!?)]")
+	if raw == "" {
+		return ""
+	}
+	if u, err := url.Parse(raw); err != nil || u.Host == "" {
+		return ""
+	}
+	return raw
+}
+
+// acquire reserves a fetch slot for the URL's host, returning false if too
+// many fetches are in flight or the host was fetched too recently
+func (u *unfurler) acquire(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := u.lastFetch[host]; ok && now.Sub(last) < unfurlHostInterval {
+		return false
+	}
+
+	select {
+	case u.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	u.lastFetch[host] = now
+	for h, last := range u.lastFetch {
+		if now.Sub(last) >= unfurlHostInterval {
+			delete(u.lastFetch, h)
+		}
+	}
+	return true
+}
+
+// fetch downloads the start of an HTML page and extracts its preview metadata
+func (u *unfurler) fetch(rawURL string) (Unfurl, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), unfurlTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Unfurl{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "SlackLite-Unfurl/1.0")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return Unfurl{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Unfurl{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return Unfurl{}, fmt.Errorf("not an HTML page: %q", mediaType)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, unfurlMaxBytes))
+	if err != nil {
+		return Unfurl{}, err
+	}
+
+	preview := parseUnfurl(string(page))
+	preview.URL = rawURL
+	if preview.Title == "" {
+		return Unfurl{}, errors.New("page has no title")
+	}
+	return preview, nil
+}
+
+// parseUnfurl extracts a title and description from HTML, preferring Open
+// Graph tags over <title> and the plain description meta tag
+func parseUnfurl(page string) Unfurl {
+	meta := make(map[string]string)
+	for _, tag := range metaPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		if key = strings.ToLower(key); key != "" && meta[key] == "" {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	var preview Unfurl
+	preview.Title = meta["og:title"]
+	if preview.Title == "" {
+		if m := titlePattern.FindStringSubmatch(page); m != nil {
+			preview.Title = m[1]
+		}
+	}
+	preview.Description = meta["og:description"]
+	if preview.Description == "" {
+		preview.Description = meta["description"]
+	}
+
+	preview.Title = cleanUnfurlField(preview.Title)
+	preview.Description = cleanUnfurlField(preview.Description)
+	return preview
+}
+
+// cleanUnfurlField unescapes HTML entities, collapses whitespace and
+// truncates to unfurlMaxField runes
+func cleanUnfurlField(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if runes := []rune(s); len(runes) > unfurlMaxField {
+		s = string(runes[:unfurlMaxField])
+	}
+	return s
+}
+
+// unfurlLocked starts fetching a preview for the first link in message, if
+// unfurling is enabled and the host isn't rate limited. The result is stored
+// and broadcast as a message_unfurled frame. Callers must hold a.mu.
+func (a *API) unfurlLocked(message Message) {
+	if a.unfurler == nil {
+		return
+	}
+	link := firstURL(message.Content)
+	if link == "" || !a.unfurler.acquire(link) {
+		return
+	}
+
+	go func() {
+		defer func() { <-a.unfurler.slots }()
+
+		preview, err := a.unfurler.fetch(link)
+		if err != nil {
+			log.Printf("Unfurl of %s failed: %v", link, err)
+			return
+		}
+		a.storeUnfurl(message.ChannelID, message.ID, preview)
+	}()
+}
+
+// storeUnfurl attaches a fetched preview to its message and tells the
+// channel, unless the message was deleted while the fetch was running
+func (a *API) storeUnfurl(channelID, messageID string, preview Unfurl) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.findMessage(channelID, messageID)
+	if i < 0 {
+		return
+	}
+
+	if a.db != nil {
+		err := a.db.SaveUnfurl(unfurlToDB(messageID, preview))
+		if err != nil {
+			log.Printf("Failed to save unfurl for message %s: %v", messageID, err)
+			return
+		}
+	}
+
+	a.messages[channelID][i].Unfurl = &preview
+	a.cache.invalidate(channelID)
+	a.broadcast(channelID, MessageUnfurledEvent{
+		Frame:     newFrame("message_unfurled"),
+		ChannelID: channelID,
+		MessageID: messageID,
+		Unfurl:    preview,
+	})
+}
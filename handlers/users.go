@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gastowndemo/db"
+)
+
+// RegisterUserRequest is the request body for registering a username
+type RegisterUserRequest struct {
+	Username string `json:"username"`
+}
+
+// handleUsers routes requests for /api/users
+func (a *API) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.registerUser(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// registerUser reserves a username. Usernames are unique ignoring case and
+// keep the case they were registered with. Authors don't have to register
+// before posting, and when persisting an author who has posted already
+// holds their name, so registering it conflicts like any taken name. Bot
+// names are reserved for their bots.
+func (a *API) registerUser(w http.ResponseWriter, r *http.Request) {
+	var req RegisterUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Username)
+	if name == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(name, "/") {
+		http.Error(w, "Username must not contain /", http.StatusBadRequest)
+		return
+	}
+	if a.cfg.isBot(name) {
+		http.Error(w, "Username already taken", http.StatusConflict)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var user UserResponse
+	if a.db != nil {
+		stored, err := a.db.CreateUser(name)
+		if err != nil {
+			respondStoreError(w, err)
+			return
+		}
+		user = userFromDB(stored)
+	} else {
+		key := strings.ToLower(name)
+		if _, ok := a.users[key]; ok {
+			http.Error(w, "Username already taken", http.StatusConflict)
+			return
+		}
+		a.userSeq++
+		now := time.Now()
+		user = UserResponse{Name: name, ID: strconv.Itoa(a.userSeq), CreatedAt: &now}
+		a.users[key] = user
+	}
+
+	respondJSON(w, http.StatusCreated, user)
+}
+
+// registeredUserLocked returns the registered user whose name matches name
+// ignoring case, or db.ErrNotFound. Callers must hold a.mu.
+func (a *API) registeredUserLocked(name string) (UserResponse, error) {
+	if a.db != nil {
+		stored, err := a.db.GetUserByUsername(name)
+		if err != nil {
+			return UserResponse{}, err
+		}
+		return userFromDB(stored), nil
+	}
+	user, ok := a.users[strings.ToLower(name)]
+	if !ok {
+		return UserResponse{}, db.ErrNotFound
+	}
+	return user, nil
+}
+
+// userFromDB converts a stored user to its response
+func userFromDB(u *db.User) UserResponse {
+	createdAt := u.CreatedAt
+	return UserResponse{Name: u.Username, ID: u.ID, CreatedAt: &createdAt}
+}
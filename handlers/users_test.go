@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRegisterUser(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		t.Run("persist="+strconv.FormatBool(persist), func(t *testing.T) {
+			a := newTestAPI(t, persist)
+			a.cfg.BotTokens = map[string]string{"deploybot": "secret"}
+			mux := http.NewServeMux()
+			a.RegisterRoutes(mux)
+
+			register := func(name string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(RegisterUserRequest{Username: name})
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(string(body))))
+				return w
+			}
+
+			w := register(" Alice ")
+			if w.Code != http.StatusCreated {
+				t.Fatalf("register Alice = %d %s", w.Code, w.Body)
+			}
+			var created UserResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+				t.Fatalf("decoding user: %v", err)
+			}
+			if created.Name != "Alice" || created.ID == "" || created.CreatedAt == nil {
+				t.Errorf("registered user = %+v, want Alice with an ID and creation time", created)
+			}
+
+			for _, tt := range []struct {
+				name string
+				want int
+			}{
+				{"alice", http.StatusConflict},
+				{"ALICE", http.StatusConflict},
+				{"deploybot", http.StatusConflict},
+				{"  ", http.StatusBadRequest},
+				{"a/b", http.StatusBadRequest},
+				{"bob", http.StatusCreated},
+			} {
+				if got := register(tt.name).Code; got != tt.want {
+					t.Errorf("register %q = %d, want %d", tt.name, got, tt.want)
+				}
+			}
+
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/aLiCe", nil))
+			var got UserResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding user: %v", err)
+			}
+			if got.Name != "Alice" || got.ID != created.ID {
+				t.Errorf("GET /api/users/aLiCe = %+v, want the registration of Alice", got)
+			}
+
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/carol", nil))
+			got = UserResponse{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding user: %v", err)
+			}
+			if got.Name != "carol" || got.ID != "" {
+				t.Errorf("GET /api/users/carol = %+v, want an unregistered author", got)
+			}
+		})
+	}
+}
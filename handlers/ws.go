@@ -2,49 +2,210 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gastowndemo/db"
+
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// newUpgrader returns an upgrader using the configured buffer sizes. Write
+// buffers come from a shared pool instead of being held by every connection.
+func newUpgrader(cfg *Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  cfg.WSReadBufferSize,
+		WriteBufferSize: cfg.WSWriteBufferSize,
+		WriteBufferPool: &sync.Pool{},
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
 }
 
-// WSMessage represents the WebSocket message format
-type WSMessage struct {
+// Frame holds the fields shared by every outbound WebSocket frame. CreatedAt
+// is always stamped by the server and never taken from the client, so it can
+// be used to order all event types on one timeline.
+type Frame struct {
 	Type      string `json:"type"`
-	ChannelID string `json:"channel_id"`
-	Author    string `json:"author"`
-	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
 }
 
+// newFrame returns a Frame of the given type stamped with the current time
+func newFrame(frameType string) Frame {
+	return Frame{
+		Type:      frameType,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// WSMessage represents the WebSocket message format
+type WSMessage struct {
+	Frame
+	ID          string `json:"id,omitempty"`
+	ChannelID   string `json:"channel_id"`
+	Author      string `json:"author,omitempty"`
+	Content     string `json:"content,omitempty"`
+	ParentID    string `json:"parent_id,omitempty"`
+	MessageID   string `json:"message_id,omitempty"`
+	DeliveredTo int    `json:"delivered_to,omitempty"`
+	IsBot       bool   `json:"is_bot,omitempty"`
+	Emoji       string `json:"emoji,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Subtype  string            `json:"subtype,omitempty"`
+}
+
+// ReadyFrame is the first frame sent on every connection, confirming the
+// channel and author the server resolved for the client. Chat messages sent
+// on the connection are attributed to YourAuthor when it is set. It is queued
+// before the client is registered, so it always precedes any other frame.
+type ReadyFrame struct {
+	Frame
+	ChannelID  string `json:"channel_id"`
+	YourAuthor string `json:"your_author"`
+	ServerTime string `json:"server_time"`
+
+	// Batch reports whether later frames may arrive wrapped in batch frames,
+	// and Lines whether a message may hold several frames, one per line
+	Batch bool `json:"batch,omitempty"`
+	Lines bool `json:"lines,omitempty"`
+
+	// Session identifies the connection's settings so a reconnect can pass
+	// ?session= instead of repeating them. Resumed reports whether this
+	// connection picked up an existing session.
+	Session string `json:"session,omitempty"`
+	Resumed bool   `json:"resumed,omitempty"`
+
+	// Replayed is how many messages posted since the session's last-read
+	// position follow this frame, oldest first, before any live frame. At
+	// most maxReplay are replayed; a client that gets that many fetches
+	// the rest over REST.
+	Replayed int `json:"replayed,omitempty"`
+}
+
+// BatchFrame carries several frames that were queued for a client within the
+// batch window, in the order they were queued
+type BatchFrame struct {
+	Frame
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// maxReplay caps how many missed messages are replayed to a resumed
+// session. It must stay below the send buffer, which nothing drains until
+// the client is registered.
+const maxReplay = 100
+
+// maxBatchSize caps how many frames are coalesced into one batch frame or
+// one message of lines
+const maxBatchSize = 100
+
+// lineSeparator separates the frames in a message for batch=lines clients.
+// Frames are compact JSON, which never contains a literal newline.
+var lineSeparator = []byte{'\n'}
+
 // Client represents a WebSocket client connection
 type Client struct {
 	conn      *websocket.Conn
 	send      chan []byte
 	channelID string
+	author    string
 	hub       *Hub
+	cfg       *Config
+	ip        string
+
+	// bot is the bot authenticated by the upgrade request's Authorization
+	// header, or "" for ordinary clients
+	bot string
+
+	// batchWindow is how long writePump waits to coalesce frames; zero
+	// writes each frame as it is queued
+	batchWindow time.Duration
+
+	// lines has writePump write every frame already queued in one message,
+	// separated by newlines, instead of one message per frame
+	lines bool
+
+	// session is the client's session ID, or "" when sessions are disabled
+	session string
+
+	// writeMu serializes data frame writes, which writePump makes, with the
+	// reconnect frame closeWithReconnect writes from another goroutine
+	writeMu sync.Mutex
+
+	// lastPong is when the client last answered a ping, as Unix nanoseconds,
+	// or when it connected if it hasn't yet. The reaper reads it while
+	// readPump writes it.
+	lastPong atomic.Int64
+
+	// closed is set by Unregister when it closes send. It is guarded by
+	// hub.mu, like the hub's client maps.
+	closed bool
 }
 
-// Hub maintains channel-specific client connections
+// Hub maintains channel-specific client connections.
+//
+// Every client in a channel receives that channel's frames in the same order:
+// each fan-out holds the channel's order lock while it queues the frame for
+// every recipient, so two concurrent broadcasts cannot interleave differently
+// for different clients. Frames sent to a single client, such as errors and
+// receipts, are not part of this ordering.
 type Hub struct {
-	mu       sync.RWMutex
-	channels map[string]map[*Client]bool
+	mu         sync.RWMutex
+	channels   map[string]*hubChannel
+	receipts   *deliveryReceipts
+	slowMode   *slowMode
+	readOnly   *readOnlyChannels
+	highlights *highlighter
+	conns      *ipConnections
+	activity   *activityTracker
+	sessions   *sessionStore
+
+	// react applies reactions sent over WebSocket. NewAPI sets it, since
+	// the API owns the messages; without it reactions are rejected.
+	react func(channelID, messageID, emoji, author string, on bool) error
+
+	// catchUp calls deliver with the frames for up to limit messages in a
+	// channel after the message lastRead, holding the API's lock so no new
+	// message can be broadcast until deliver returns. NewAPI sets it;
+	// without it resumed sessions aren't replayed.
+	catchUp func(channelID, lastRead string, limit int, deliver func(missed [][]byte))
+
+	// reaped counts the stale connections RunReaper has closed
+	reaped atomic.Int64
+
+	// draining is set once the server starts shutting down, after which new
+	// connections are refused
+	draining atomic.Bool
+}
+
+// hubChannel is the set of clients connected to one channel. order is held
+// while fanning a frame out to them; clients is guarded by Hub.mu.
+type hubChannel struct {
+	order   sync.Mutex
+	clients map[*Client]bool
 }
 
 // NewHub creates a new Hub instance
 func NewHub() *Hub {
 	return &Hub{
-		channels: make(map[string]map[*Client]bool),
+		channels:   make(map[string]*hubChannel),
+		receipts:   newDeliveryReceipts(),
+		slowMode:   newSlowMode(),
+		readOnly:   newReadOnlyChannels(),
+		highlights: newHighlighter(),
+		conns:      newIPConnections(),
+		activity:   newActivityTracker(),
+		sessions:   newSessionStore(),
 	}
 }
 
@@ -54,10 +215,10 @@ func (h *Hub) Register(client *Client) {
 	defer h.mu.Unlock()
 
 	if h.channels[client.channelID] == nil {
-		h.channels[client.channelID] = make(map[*Client]bool)
+		h.channels[client.channelID] = &hubChannel{clients: make(map[*Client]bool)}
 	}
-	h.channels[client.channelID][client] = true
-	log.Printf("Client connected to channel %s", client.channelID)
+	h.channels[client.channelID].clients[client] = true
+	log.Printf("Client connected to channel %s (%s)", client.channelID, client.ip)
 }
 
 // Unregister removes a client from a channel
@@ -65,14 +226,19 @@ func (h *Hub) Unregister(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if clients, ok := h.channels[client.channelID]; ok {
-		if _, exists := clients[client]; exists {
-			delete(clients, client)
+	if ch, ok := h.channels[client.channelID]; ok {
+		if _, exists := ch.clients[client]; exists {
+			delete(ch.clients, client)
+			client.closed = true
 			close(client.send)
-			log.Printf("Client disconnected from channel %s", client.channelID)
+			h.conns.release(client.ip)
+			if client.session != "" {
+				h.sessions.detach(client.session, client.cfg.SessionTTL)
+			}
+			log.Printf("Client disconnected from channel %s (%s)", client.channelID, client.ip)
 		}
 		// Clean up empty channels
-		if len(clients) == 0 {
+		if len(ch.clients) == 0 {
 			delete(h.channels, client.channelID)
 		}
 	}
@@ -83,32 +249,142 @@ func (h *Hub) Broadcast(channelID string, message []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if clients, ok := h.channels[channelID]; ok {
-		for client := range clients {
-			select {
-			case client.send <- message:
-			default:
-				// Client buffer full, skip
-			}
+	if ch, ok := h.channels[channelID]; ok {
+		ch.fanOut(message, nil)
+	}
+}
+
+// fanOut queues a message for the clients in the channel that pass keep, or
+// all of them if keep is nil, holding the channel's order lock throughout.
+// It returns the clients the message was queued for. Callers must hold
+// hub.mu for reading.
+func (ch *hubChannel) fanOut(message []byte, keep func(*Client) bool) []*Client {
+	ch.order.Lock()
+	defer ch.order.Unlock()
+
+	var queued []*Client
+	for client := range ch.clients {
+		if keep != nil && !keep(client) {
+			continue
+		}
+		if client.queueLocked(message) {
+			queued = append(queued, client)
+		}
+	}
+	return queued
+}
+
+// broadcastTracked sends a message to all clients in the sender's channel,
+// including the sender, and accepts delivery receipts from the others. The
+// receipt entry is recorded before any recipient can see the message.
+func (h *Hub) broadcastTracked(sender *Client, messageID string, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.receipts.mu.Lock()
+	defer h.receipts.mu.Unlock()
+
+	ch, ok := h.channels[sender.channelID]
+	if !ok {
+		return
+	}
+
+	p := h.receipts.startLocked(messageID, sender)
+	for _, client := range ch.fanOut(message, nil) {
+		if client != sender {
+			p.acked[client] = false
 		}
 	}
 }
 
+// queueLocked queues a message for the client, reporting whether it was
+// queued. Messages are dropped if the client's buffer is full or it has been
+// unregistered. Callers must hold hub.mu, for reading or writing: Unregister
+// closes send only while holding the write lock, so checking closed and
+// sending cannot race with the close.
+func (c *Client) queueLocked(message []byte) bool {
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		// Client buffer full, skip
+		return false
+	}
+}
+
+// sendTo queues a message for a single client if it is still connected
+func (h *Hub) sendTo(client *Client, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	client.queueLocked(message)
+}
+
+// sendToAuthors sends a message to every connected client whose author is in
+// authors, whichever channel they are connected to
+func (h *Hub) sendToAuthors(authors map[string]bool, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, ch := range h.channels {
+		ch.fanOut(message, func(client *Client) bool {
+			return authors[client.author]
+		})
+	}
+}
+
+// sendToChannelAuthor sends a message to the clients in a channel connected
+// as author, returning how many it was queued for
+func (h *Hub) sendToChannelAuthor(channelID, author string, message []byte) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ch, ok := h.channels[channelID]
+	if !ok {
+		return 0
+	}
+	queued := ch.fanOut(message, func(client *Client) bool {
+		return client.author == author
+	})
+	return len(queued)
+}
+
+// BroadcastAll sends a message to every connected client, regardless of channel
+func (h *Hub) BroadcastAll(message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, ch := range h.channels {
+		ch.fanOut(message, nil)
+	}
+}
+
 // readPump pumps messages from the WebSocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
+	c.conn.SetPingHandler(c.handlePing)
+	c.conn.SetPongHandler(c.handlePong)
 
 	for {
-		_, rawMessage, err := c.conn.ReadMessage()
+		messageType, rawMessage, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+		c.hub.activity.touch(c.author)
+
+		if messageType != websocket.TextMessage {
+			c.sendError("only text frames supported")
+			continue
+		}
 
 		// Parse the incoming message
 		var msg WSMessage
@@ -117,57 +393,378 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		// Ensure channel_id matches the client's channel
-		msg.ChannelID = c.channelID
-		msg.Type = "message"
-		if msg.CreatedAt == "" {
-			msg.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+		switch msg.Type {
+		case "", "message":
+			c.handleChatMessage(msg)
+		case "receipt":
+			c.handleReceipt(msg)
+		case "react", "unreact":
+			c.handleReaction(msg)
+		case "read":
+			c.handleRead(msg)
+		default:
+			c.sendError(fmt.Sprintf("unknown frame type %q", msg.Type))
 		}
+	}
+}
 
-		// Marshal and broadcast
-		outMsg, err := json.Marshal(msg)
-		if err != nil {
-			log.Printf("Failed to marshal message: %v", err)
-			continue
+// handlePing counts a ping as activity by the client's author, then answers
+// it with a pong as the default ping handler does
+func (c *Client) handlePing(appData string) error {
+	c.hub.activity.touch(c.author)
+	err := c.conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(controlWriteWait))
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
+// handleChatMessage validates a chat message and broadcasts it to the
+// client's channel. A message naming a different channel is rejected rather
+// than redirected, so client bugs surface; one naming no channel goes to the
+// client's. A connection with an author posts as that author, the one its
+// ready frame reports, whatever the frame says.
+func (c *Client) handleChatMessage(msg WSMessage) {
+	if c.cfg.Maintenance {
+		c.sendError(errMaintenance)
+		return
+	}
+	if msg.ChannelID != "" && msg.ChannelID != c.channelID {
+		c.sendError(fmt.Sprintf("not connected to channel %q", msg.ChannelID))
+		return
+	}
+
+	content, err := c.cfg.sanitizeContent(msg.Content)
+	if err != nil {
+		c.sendError("message content " + err.Error())
+		return
+	}
+
+	if c.author != "" {
+		msg.Author = c.author
+	}
+
+	msg.Content = expandEmoji(content)
+	if c.cfg.contentTooLong(msg.Content) {
+		c.sendError(fmt.Sprintf("message content exceeds maximum length of %d characters", c.cfg.MaxMessageLength))
+		return
+	}
+
+	if err := checkMetadata(msg.Metadata); err != nil {
+		c.sendError("invalid metadata: " + err.Error())
+		return
+	}
+
+	isBot, err := c.cfg.botAuthor(c.bot, msg.Author)
+	if err != nil {
+		c.sendError("invalid bot token")
+		return
+	}
+
+	if err := checkSubtype(msg.Subtype, isBot); err != nil {
+		c.sendError("invalid subtype: " + err.Error())
+		return
+	}
+
+	if !c.hub.readOnly.allows(c.channelID, isBot) {
+		c.sendError("channel is read-only")
+		return
+	}
+
+	if !isBot {
+		if wait, ok := c.hub.slowMode.allow(c.channelID, c.slowModeKey()); !ok {
+			c.sendRateLimited(limitSlowMode, wait)
+			return
 		}
+	}
 
-		c.hub.Broadcast(c.channelID, outMsg)
+	msg.ChannelID = c.channelID
+	msg.Frame = newFrame("message")
+	msg.ID = uuid.New().String()
+	msg.ParentID = ""
+	msg.MessageID = ""
+	msg.DeliveredTo = 0
+	msg.IsBot = isBot
+
+	// Marshal and broadcast
+	outMsg, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
 	}
+
+	log.Printf("Message sent to channel %s by %s (%s)", c.channelID, msg.Author, c.ip)
+
+	c.hub.broadcastTracked(c, msg.ID, outMsg)
+	c.hub.notifyHighlights(c.channelID, msg.ID, msg.Author, msg.Content)
+	c.hub.activity.touch(c.author)
+}
+
+// slowModeKey returns whom a chat message's cooldown is charged to: the
+// connection's author, or for a connection without one its IP, since the
+// frame's author can change on every frame
+func (c *Client) slowModeKey() string {
+	if c.author != "" {
+		return c.author
+	}
+	return "ip:" + c.ip
+}
+
+// sendError queues an error frame for this client only
+func (c *Client) sendError(text string) {
+	outMsg, err := json.Marshal(WSMessage{
+		Frame:     newFrame("error"),
+		ChannelID: c.channelID,
+		Error:     text,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal error: %v", err)
+		return
+	}
+
+	c.hub.sendTo(c, outMsg)
+}
+
+// sendReady queues the ready frame, reporting whether the client resumed its
+// session and how many missed messages will be replayed after it. It must
+// be called before the client is registered with the hub.
+func (c *Client) sendReady(resumed bool, replayed int) {
+	frame := newFrame("ready")
+	outMsg, err := json.Marshal(ReadyFrame{
+		Frame:      frame,
+		ChannelID:  c.channelID,
+		YourAuthor: c.author,
+		ServerTime: frame.CreatedAt,
+		Batch:      c.batchWindow > 0,
+		Lines:      c.lines,
+		Session:    c.session,
+		Resumed:    resumed,
+		Replayed:   replayed,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal ready frame: %v", err)
+		return
+	}
+	c.send <- outMsg
 }
 
 // writePump pumps messages from the hub to the WebSocket connection
 func (c *Client) writePump() {
 	defer c.conn.Close()
 
-	for message := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			return
+	var ping <-chan time.Time
+	if c.cfg.PingInterval > 0 {
+		ticker := time.NewTicker(c.cfg.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	// The ready frame is always written on its own, so clients can read its
+	// batch flag before any batch frame arrives
+	ready := true
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if c.batchWindow > 0 && !ready {
+				message = c.coalesce(message)
+			}
+			c.writeMu.Lock()
+			var err error
+			if c.lines && !ready {
+				err = c.writeLines(message)
+			} else {
+				err = c.conn.WriteMessage(websocket.TextMessage, message)
+			}
+			c.writeMu.Unlock()
+			ready = false
+			if err != nil {
+				return
+			}
+		case <-ping:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeLines writes first and the frames already queued behind it, up to
+// maxBatchSize, as one message with a frame per line. Unlike coalesce it
+// never waits for more, so it only saves writes when a burst is queued.
+func (c *Client) writeLines(first []byte) error {
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(first); err != nil {
+		return err
+	}
+
+drain:
+	for n := 1; n < maxBatchSize; n++ {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				break drain
+			}
+			if _, err := w.Write(lineSeparator); err != nil {
+				return err
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+		default:
+			break drain
+		}
+	}
+	return w.Close()
+}
+
+// coalesce collects the frames queued within the batch window after first
+// and wraps them all in a batch frame. A frame with nothing queued behind it
+// is returned unchanged.
+func (c *Client) coalesce(first []byte) []byte {
+	frames := []json.RawMessage{first}
+	timer := time.NewTimer(c.batchWindow)
+	defer timer.Stop()
+
+collect:
+	for len(frames) < maxBatchSize {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				break collect
+			}
+			frames = append(frames, message)
+		case <-timer.C:
+			break collect
 		}
 	}
+
+	if len(frames) == 1 {
+		return first
+	}
+	outMsg, err := json.Marshal(BatchFrame{Frame: newFrame("batch"), Messages: frames})
+	if err != nil {
+		log.Printf("Failed to marshal batch: %v", err)
+		return first
+	}
+	return outMsg
 }
 
 // WSHandler holds the WebSocket hub
 type WSHandler struct {
-	hub *Hub
+	hub      *Hub
+	cfg      *Config
+	upgrader *websocket.Upgrader
+
+	// channels is set by ValidateChannels; without it any channel is accepted
+	channels *channelResolver
 }
 
-// NewWSHandler creates a new WebSocket handler
-func NewWSHandler() *WSHandler {
+// NewWSHandler creates a new WebSocket handler serving clients through hub.
+// An empty cfg.WSPath mounts it at /ws.
+func NewWSHandler(cfg Config, hub *Hub) *WSHandler {
+	if cfg.WSPath == "" {
+		cfg.WSPath = "/ws"
+	}
 	return &WSHandler{
-		hub: NewHub(),
+		hub:      hub,
+		cfg:      &cfg,
+		upgrader: newUpgrader(&cfg),
 	}
 }
 
-// HandleWebSocket handles WebSocket connections at /ws?channel=<id>
+// ValidateChannels makes connections to channels missing from database fail
+// with 404 instead of upgrading. The channel parameter may then also be
+// name:<name>, which is resolved to the channel's ID.
+func (ws *WSHandler) ValidateChannels(database *db.DB) {
+	ws.channels = newChannelResolver(database)
+}
+
+// HandleWebSocket handles WebSocket connections at Config.WSPath, /ws by
+// default, with ?channel=<id>&author=<name>.
+// The author identifies the client for targeted notifications such as thread replies.
+// Clients that can unpack batch frames opt in with batch=true. Clients that
+// can split a message into lines opt in with batch=lines instead, and are
+// sent every frame already queued when one is written in a single message,
+// a frame per line, which saves writes for busy channels without waiting.
+//
+// The ready frame carries a session ID. Reconnecting with session=<id>
+// within Config.SessionTTL of disconnecting restores the channel, author and
+// batch settings, so the client need only send those it wants to change. An
+// unknown or expired session is ignored and a new one issued. A client that
+// reports what it has read with read frames is also sent the stored
+// messages posted after that on resume; messages sent only over WebSocket
+// aren't stored, so they can't be replayed.
 func (ws *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	channelID := r.URL.Query().Get("channel")
+	query := r.URL.Query()
+
+	var session wsSession
+	var sessionID string
+	resumed := false
+	if ws.cfg.SessionTTL > 0 {
+		sessionID = query.Get("session")
+		if session, resumed = ws.hub.sessions.get(sessionID); !resumed {
+			sessionID = uuid.New().String()
+		}
+	}
+	resumedChannel := session.channelID
+	if query.Has("channel") {
+		session.channelID = query.Get("channel")
+	}
+	if query.Has("author") {
+		session.author = query.Get("author")
+	}
+	if query.Has("batch") {
+		session.batch = query.Get("batch")
+	}
+
+	channelID := session.channelID
 	if channelID == "" {
 		http.Error(w, "channel parameter required", http.StatusBadRequest)
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if ws.hub.draining.Load() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(minReconnectDelay/time.Second)))
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if ws.channels != nil {
+		id, ok, err := ws.channels.resolve(channelID)
+		if err != nil {
+			log.Printf("Failed to look up channel %s: %v", channelID, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+		channelID = id
+	}
+	session.channelID = channelID
+	if channelID != resumedChannel {
+		// The last-read position belongs to the session's old channel
+		session.lastRead = ""
+	}
+
+	// The connection is counted from here until Unregister
+	ip := clientIP(r, ws.cfg.TrustedProxies)
+	if !ws.hub.conns.acquire(ip, ws.cfg.MaxConnsPerIP) {
+		log.Printf("Rejected WebSocket connection from %s: too many connections", ip)
+		respondRateLimited(w, limitConnections, connLimitRetry)
+		return
+	}
+
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		ws.hub.conns.release(ip)
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
@@ -176,10 +773,44 @@ func (ws *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		conn:      conn,
 		send:      make(chan []byte, 256),
 		channelID: channelID,
+		author:    session.author,
 		hub:       ws.hub,
+		cfg:       ws.cfg,
+		ip:        ip,
+		bot:       ws.cfg.botFromRequest(r),
+		session:   sessionID,
+	}
+	switch session.batch {
+	case "true":
+		client.batchWindow = ws.cfg.BatchWindow
+	case "lines":
+		client.lines = true
+	}
+	client.lastPong.Store(time.Now().UnixNano())
+
+	// Browsers can't see the status of a failed upgrade, so a bad token is
+	// reported in a close frame instead
+	if client.bot == "" && strings.HasPrefix(r.Header.Get("Authorization"), botAuthScheme) {
+		ws.hub.conns.release(ip)
+		client.CloseWithReason(websocket.ClosePolicyViolation, "invalid bot token")
+		return
 	}
 
-	ws.hub.Register(client)
+	if sessionID != "" {
+		ws.hub.sessions.attach(sessionID, session)
+	}
+	register := func(missed [][]byte) {
+		client.sendReady(resumed, len(missed))
+		for _, frame := range missed {
+			client.send <- frame
+		}
+		ws.hub.Register(client)
+	}
+	if resumed && session.lastRead != "" && ws.hub.catchUp != nil {
+		ws.hub.catchUp(channelID, session.lastRead, maxReplay, register)
+	} else {
+		register(nil)
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -187,5 +818,5 @@ func (ws *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 // RegisterRoutes registers the WebSocket route on the given mux
 func (ws *WSHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/ws", ws.HandleWebSocket)
+	mux.HandleFunc(ws.cfg.WSPath, ws.HandleWebSocket)
 }
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestWSServer serves a's routes and a WebSocket handler sharing its hub
+func newTestWSServer(t *testing.T, a *API) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	a.RegisterRoutes(mux)
+	NewWSHandler(*a.cfg, a.hub).RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// sendTestFrame writes frame to conn and returns the next frame back
+func sendTestFrame(t *testing.T, conn *websocket.Conn, frame WSMessage) WSMessage {
+	t.Helper()
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var reply WSMessage
+	readTestFrame(t, conn, &reply)
+	return reply
+}
+
+func TestChatMessagePostsAsConnectionAuthor(t *testing.T) {
+	a := NewAPI(DefaultConfig(), NewHub())
+	srv := newTestWSServer(t, a)
+	channel := newTestChannel(t, a, "general")
+
+	conn, ready := dialTestWS(t, srv, url.Values{"channel": {channel.ID}, "author": {"bob"}})
+	if ready.YourAuthor != "bob" {
+		t.Fatalf("your_author = %q, want bob", ready.YourAuthor)
+	}
+	for _, author := range []string{"", "bob", "mallory"} {
+		reply := sendTestFrame(t, conn, WSMessage{Frame: Frame{Type: "message"}, Author: author, Content: "hi"})
+		if reply.Type != "message" || reply.Author != "bob" {
+			t.Errorf("frame with author %q came back as %s by %q, want a message by bob", author, reply.Type, reply.Author)
+		}
+	}
+
+	// A connection without an author still names one per frame
+	anon, _ := dialTestWS(t, srv, url.Values{"channel": {channel.ID}})
+	if reply := sendTestFrame(t, anon, WSMessage{Frame: Frame{Type: "message"}, Author: "carol", Content: "hi"}); reply.Author != "carol" {
+		t.Errorf("anonymous connection's message by %q, want carol", reply.Author)
+	}
+}
+
+// BenchmarkUpgraderWriteBufferPool upgrades a connection and writes it one
+// frame per op, with write buffers taken from the pool and without
+func BenchmarkUpgraderWriteBufferPool(b *testing.B) {
+	cfg := DefaultConfig()
+	frame := []byte(`{"type":"message","content":"hello"}`)
+	for _, pooled := range []bool{true, false} {
+		name := "pooled"
+		if !pooled {
+			name = "unpooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			upgrader := newUpgrader(&cfg)
+			if !pooled {
+				upgrader.WriteBufferPool = nil
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.WriteMessage(websocket.TextMessage, frame)
+				conn.ReadMessage()
+			}))
+			defer server.Close()
+			url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+			b.ReportAllocs()
+			for b.Loop() {
+				conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+				if err != nil {
+					b.Fatalf("Dial: %v", err)
+				}
+				if _, _, err := conn.ReadMessage(); err != nil {
+					b.Fatalf("ReadMessage: %v", err)
+				}
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestChatMessageSlowModeFollowsConnection(t *testing.T) {
+	for _, query := range []url.Values{{"author": {"bob"}}, {}} {
+		t.Run("author="+query.Get("author"), func(t *testing.T) {
+			a := NewAPI(DefaultConfig(), NewHub())
+			srv := newTestWSServer(t, a)
+			channel := newTestChannel(t, a, "general")
+			a.hub.slowMode.setCooldown(channel.ID, time.Minute)
+
+			query.Set("channel", channel.ID)
+			conn, _ := dialTestWS(t, srv, query)
+			if reply := sendTestFrame(t, conn, WSMessage{Frame: Frame{Type: "message"}, Author: "bob", Content: "one"}); reply.Type != "message" {
+				t.Fatalf("first message came back as %s: %s", reply.Type, reply.Error)
+			}
+			reply := sendTestFrame(t, conn, WSMessage{Frame: Frame{Type: "message"}, Author: "mallory", Content: "two"})
+			if reply.Type != "error" || !strings.Contains(reply.Error, limitSlowMode) {
+				t.Errorf("second message under another author came back as %s %q, want rate limited", reply.Type, reply.Error)
+			}
+		})
+	}
+}
+
+func TestChatMessageTouchesOnlyConnectionAuthor(t *testing.T) {
+	a := NewAPI(DefaultConfig(), NewHub())
+	srv := newTestWSServer(t, a)
+	channel := newTestChannel(t, a, "general")
+
+	anon, _ := dialTestWS(t, srv, url.Values{"channel": {channel.ID}})
+	sendTestFrame(t, anon, WSMessage{Frame: Frame{Type: "message"}, Author: "carol", Content: "hi"})
+	if got := a.hub.activity.get("carol"); got != nil {
+		t.Errorf("carol last active at %v after an anonymous connection posted as carol, want never", got)
+	}
+
+	conn, _ := dialTestWS(t, srv, url.Values{"channel": {channel.ID}, "author": {"bob"}})
+	sendTestFrame(t, conn, WSMessage{Frame: Frame{Type: "message"}, Content: "hi"})
+	if a.hub.activity.get("bob") == nil {
+		t.Error("bob not marked active after posting")
+	}
+}
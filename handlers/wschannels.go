@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gastowndemo/db"
+)
+
+const (
+	// channelCacheTTL is how long a WebSocket channel lookup is reused, so a
+	// burst of reconnects doesn't query the database for each one
+	channelCacheTTL = 10 * time.Second
+
+	// channelCacheMax is the cache size at which expired entries are pruned
+	channelCacheMax = 1024
+)
+
+// channelResolver checks that WebSocket clients connect to channels that
+// exist, accepting an ID or name:<name> like the REST routes
+type channelResolver struct {
+	db *db.DB
+
+	mu    sync.Mutex
+	cache map[string]resolvedChannel
+}
+
+// resolvedChannel is a cached lookup; id is empty if the channel wasn't found
+type resolvedChannel struct {
+	id      string
+	expires time.Time
+}
+
+func newChannelResolver(database *db.DB) *channelResolver {
+	return &channelResolver{db: database, cache: make(map[string]resolvedChannel)}
+}
+
+// resolve returns the ID of the channel ref refers to, and false if there
+// is no such channel
+func (r *channelResolver) resolve(ref string) (string, bool, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	cached, ok := r.cache[ref]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.id, cached.id != "", nil
+	}
+
+	var channel *db.Channel
+	var err error
+	if name, ok := strings.CutPrefix(ref, channelNamePrefix); ok {
+		channel, err = r.db.GetChannelByName(name)
+	} else {
+		channel, err = r.db.GetChannel(ref)
+	}
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return "", false, err
+	}
+
+	var id string
+	if channel != nil {
+		id = channel.ID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= channelCacheMax {
+		for key, entry := range r.cache {
+			if !now.Before(entry.expires) {
+				delete(r.cache, key)
+			}
+		}
+	}
+	r.cache[ref] = resolvedChannel{id: id, expires: now.Add(channelCacheTTL)}
+	return id, id != "", nil
+}
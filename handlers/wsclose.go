@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// controlWriteWait bounds how long writing a control frame, such as a close
+// frame or a pong, may block
+const controlWriteWait = time.Second
+
+// minReconnectDelay is the least a reconnect frame asks a client to wait
+const minReconnectDelay = time.Second
+
+// drainPollInterval is how often Drain checks whether queued frames have
+// been written
+const drainPollInterval = 50 * time.Millisecond
+
+// ReconnectFrame asks a client to wait AfterMS milliseconds before
+// reconnecting. It is sent just before the server closes the connection.
+type ReconnectFrame struct {
+	Frame
+	AfterMS int64 `json:"after_ms"`
+}
+
+// reconnectDelay picks a client's reconnect delay: minReconnectDelay plus a
+// random share of spread, so clients disconnected together come back
+// staggered rather than all at once
+func reconnectDelay(spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return minReconnectDelay
+	}
+	return minReconnectDelay + rand.N(spread)
+}
+
+// CloseWithReason tells the client why the server is disconnecting it, with
+// a close frame carrying code and a human-readable reason, then closes the
+// connection. readPump then fails and unregisters the client. The protocol
+// caps reason at 123 bytes.
+func (c *Client) CloseWithReason(code int, reason string) {
+	frame := websocket.FormatCloseMessage(code, reason)
+	err := c.conn.WriteControl(websocket.CloseMessage, frame, time.Now().Add(controlWriteWait))
+	if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Printf("Failed to send close frame to %s: %v", c.ip, err)
+	}
+	c.conn.Close()
+}
+
+// closeWithReconnect sends a reconnect frame asking the client to wait
+// after before reconnecting, then closes the connection as CloseWithReason
+// does. The frame bypasses the send queue so it is written before the close
+// frame even if the queue is full.
+func (c *Client) closeWithReconnect(after time.Duration, code int, reason string) {
+	data, err := json.Marshal(ReconnectFrame{Frame: newFrame("reconnect"), AfterMS: after.Milliseconds()})
+	if err == nil {
+		c.writeMu.Lock()
+		c.conn.SetWriteDeadline(time.Now().Add(controlWriteWait))
+		err = c.conn.WriteMessage(websocket.TextMessage, data)
+		c.writeMu.Unlock()
+	}
+	if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Printf("Failed to send reconnect frame to %s: %v", c.ip, err)
+	}
+	c.CloseWithReason(code, reason)
+}
+
+// closeChannel disconnects every client in a channel with the given close
+// code and reason. Close frames are written after releasing hub.mu, so a slow
+// client can't hold up the hub.
+func (h *Hub) closeChannel(channelID string, code int, reason string) {
+	h.mu.RLock()
+	var clients []*Client
+	if ch, ok := h.channels[channelID]; ok {
+		for client := range ch.clients {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.CloseWithReason(code, reason)
+	}
+}
+
+// BeginDrain starts a shutdown: new connections are refused with a 503 from
+// here on, while open ones keep receiving frames
+func (h *Hub) BeginDrain() {
+	h.draining.Store(true)
+}
+
+// Drain waits up to timeout for the frames queued for every client to be
+// written, then disconnects them all as Shutdown does
+func (h *Hub) Drain(timeout time.Duration) {
+	h.BeginDrain()
+	deadline := time.Now().Add(timeout)
+	for {
+		queued, window := h.queuedFrames()
+		if queued == 0 {
+			// A frame being coalesced has left the queue, but is only
+			// written once its batch window closes
+			time.Sleep(min(window, time.Until(deadline)))
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Disconnecting WebSocket clients with %d frames still queued", queued)
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+	h.Shutdown()
+}
+
+// queuedFrames returns how many frames are waiting in clients' send queues,
+// and the longest batch window among them
+func (h *Hub) queuedFrames() (int, time.Duration) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	queued := 0
+	var window time.Duration
+	for _, ch := range h.channels {
+		for client := range ch.clients {
+			queued += len(client.send)
+			window = max(window, client.batchWindow)
+		}
+	}
+	return queued, window
+}
+
+// Shutdown disconnects every client with a reconnect frame and a going-away
+// close frame, for use when the server stops. Clients are closed in
+// parallel, so a few slow ones can't stall the others.
+func (h *Hub) Shutdown() {
+	h.BeginDrain()
+	h.mu.RLock()
+	var clients []*Client
+	for _, ch := range h.channels {
+		for client := range ch.clients {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.closeWithReconnect(reconnectDelay(client.cfg.ReconnectSpread), websocket.CloseGoingAway, "server shutting down")
+		}()
+	}
+	wg.Wait()
+}
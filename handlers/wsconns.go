@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// connLimitRetry is the Retry-After sent when an IP is at its connection
+// limit. There's no telling when one of its sockets will close, so it is
+// only a hint to back off.
+const connLimitRetry = 10 * time.Second
+
+// ipConnections counts open WebSocket connections per client IP, so one
+// client can't exhaust the server by opening thousands of sockets
+type ipConnections struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newIPConnections() *ipConnections {
+	return &ipConnections{counts: make(map[string]int)}
+}
+
+// acquire reserves a connection for ip, reporting false if it already has
+// limit open. A limit of zero or less means unlimited.
+func (c *ipConnections) acquire(ip string, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if limit > 0 && c.counts[ip] >= limit {
+		return false
+	}
+	c.counts[ip]++
+	return true
+}
+
+// release gives back a connection reserved by acquire
+func (c *ipConnections) release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts[ip] <= 1 {
+		delete(c.counts, ip)
+	} else {
+		c.counts[ip]--
+	}
+}
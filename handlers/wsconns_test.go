@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestWSStatus connects to srv's WebSocket endpoint with query and
+// header, returning the connection, if any, and the handshake status
+func dialTestWSStatus(t *testing.T, srv *httptest.Server, query url.Values, header http.Header) (*websocket.Conn, int) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?"+query.Encode(), header)
+	if resp == nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp.StatusCode
+}
+
+func TestWebSocketConnectionLimitPerIP(t *testing.T) {
+	const limit = 3
+	cfg := DefaultConfig()
+	cfg.MaxConnsPerIP = limit
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	cfg.TrustedProxies = []net.IPNet{*loopback}
+	hub := NewHub()
+	a := NewAPI(cfg, hub)
+	mux := http.NewServeMux()
+	a.RegisterRoutes(mux)
+	NewWSHandler(cfg, hub).RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	channel := newTestChannel(t, a, "general")
+	query := url.Values{"channel": {channel.ID}, "author": {"bob"}}
+	from := func(ip string) http.Header {
+		return http.Header{"X-Forwarded-For": {ip}}
+	}
+
+	var conns []*websocket.Conn
+	for i := range limit {
+		conn, code := dialTestWSStatus(t, srv, query, from("203.0.113.7"))
+		if code != http.StatusSwitchingProtocols {
+			t.Fatalf("connection %d = %d, want %d", i+1, code, http.StatusSwitchingProtocols)
+		}
+		conns = append(conns, conn)
+	}
+	for range 5 {
+		if _, code := dialTestWSStatus(t, srv, query, from("203.0.113.7")); code != http.StatusTooManyRequests {
+			t.Fatalf("connection past the limit = %d, want %d", code, http.StatusTooManyRequests)
+		}
+	}
+
+	// Another client behind the same proxy has its own count
+	if _, code := dialTestWSStatus(t, srv, query, from("198.51.100.2")); code != http.StatusSwitchingProtocols {
+		t.Errorf("connection from another client = %d, want %d", code, http.StatusSwitchingProtocols)
+	}
+
+	// Closing a connection frees its slot once the server unregisters it
+	conns[0].Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, code := dialTestWSStatus(t, srv, query, from("203.0.113.7"))
+		if code == http.StatusSwitchingProtocols {
+			break
+		}
+		if code != http.StatusTooManyRequests || time.Now().After(deadline) {
+			t.Fatalf("connection after one closed = %d, want %d", code, http.StatusSwitchingProtocols)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
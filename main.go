@@ -1,22 +1,176 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"gastowndemo/db"
 	"gastowndemo/handlers"
 )
 
+// shutdownTimeout bounds how long in-flight requests, such as long polls and
+// streams, may delay shutdown
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	api := handlers.NewAPI()
-	ws := handlers.NewWSHandler()
+	cfg := handlers.DefaultConfig()
+	flag.IntVar(&cfg.MaxMessageLength, "max-message-length", cfg.MaxMessageLength, "maximum message content length in characters; 0 means unlimited, or the database's limit with -db")
+	flag.IntVar(&cfg.DefaultPageSize, "page-size", cfg.DefaultPageSize, "default number of messages per page")
+	flag.IntVar(&cfg.MaxPageSize, "max-page-size", cfg.MaxPageSize, "maximum number of messages per page")
+	flag.DurationVar(&cfg.EditWindow, "edit-window", cfg.EditWindow, "how long after posting messages may be edited (0 for unlimited)")
+	flag.BoolVar(&cfg.Compression, "gzip", cfg.Compression, "gzip REST responses for clients that accept it")
+	flag.IntVar(&cfg.FlagHideThreshold, "flag-threshold", cfg.FlagHideThreshold, "hide messages after this many flags (0 to disable)")
+	flag.IntVar(&cfg.MaxPinsPerChannel, "max-pins", cfg.MaxPinsPerChannel, "maximum pinned messages per channel (0 for unlimited)")
+	flag.IntVar(&cfg.MaxReactionEmoji, "max-reaction-emoji", cfg.MaxReactionEmoji, "maximum different emoji reactions per message (0 for unlimited)")
+	flag.IntVar(&cfg.MaxReactionsPerAuthor, "max-reactions-per-author", cfg.MaxReactionsPerAuthor, "maximum reactions one author may add to a message (0 for unlimited)")
+	flag.BoolVar(&cfg.ThreadSubscriptions, "thread-subscriptions", cfg.ThreadSubscriptions, "send thread replies only to thread followers")
+	flag.IntVar(&cfg.WSReadBufferSize, "ws-read-buffer", cfg.WSReadBufferSize, "WebSocket read buffer size in bytes")
+	flag.IntVar(&cfg.WSWriteBufferSize, "ws-write-buffer", cfg.WSWriteBufferSize, "WebSocket write buffer size in bytes")
+	flag.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", cfg.MaxConnsPerIP, "maximum WebSocket connections from one client IP (0 for unlimited)")
+	flag.DurationVar(&cfg.BatchWindow, "batch-window", cfg.BatchWindow, "coalesce WebSocket frames sent within this window for clients that opt in (0 to disable)")
+	flag.BoolVar(&cfg.Maintenance, "read-only", cfg.Maintenance, "maintenance mode: serve reads but reject every write with 503")
+	flag.StringVar(&cfg.WSPath, "ws-path", cfg.WSPath, "path to serve WebSocket connections at, such as /api/ws behind a path-routing gateway")
+	flag.DurationVar(&cfg.ReconnectSpread, "reconnect-spread", cfg.ReconnectSpread, "window over which WebSocket clients are told to reconnect after a shutdown")
+	flag.DurationVar(&cfg.WSDrain, "ws-drain", cfg.WSDrain, "how long a shutdown waits for queued WebSocket frames to be delivered before disconnecting clients (0 to disconnect at once)")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "how long to reuse channel list and first message page responses (0 to disable)")
+	flag.DurationVar(&cfg.PingInterval, "ws-ping-interval", cfg.PingInterval, "how often to ping WebSocket clients; clients missing three pongs are disconnected (0 to disable)")
+	flag.DurationVar(&cfg.SessionTTL, "session-ttl", cfg.SessionTTL, "how long a disconnected WebSocket client may resume its session (0 to disable)")
+	flag.BoolVar(&cfg.DebugHub, "debug-hub", cfg.DebugHub, "serve a snapshot of WebSocket hub state at /debug/hub to localhost")
+	flag.BoolVar(&cfg.DebugHubRemote, "debug-hub-remote", cfg.DebugHubRemote, "serve /debug/hub to any client, not just localhost")
+	flag.BoolVar(&cfg.Unfurl, "unfurl", cfg.Unfurl, "fetch link previews for URLs in messages")
+	flag.BoolVar(&cfg.AutoCreateChannels, "auto-create-channels", cfg.AutoCreateChannels, "let messages posted to name:<name> with ?create_channel=true create the channel")
+	flag.Float64Var(&cfg.AccessLogSampleRate, "access-log-sample", cfg.AccessLogSampleRate, "fraction of requests to write to the access log, from 0 to 1; server errors are always logged (0 to disable)")
+	accessLogExclude := flag.String("access-log-exclude", strings.Join(cfg.AccessLogExclude, ","), "comma-separated paths to leave out of the access log; a trailing / covers everything under it")
+	botTokens := flag.String("bot-tokens", "", "file of \"author token\" lines; bots skip slow mode and may post in read-only channels")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated CIDRs of proxies whose X-Forwarded-For is trusted")
+	dbPath := flag.String("db", "slacklite.db", "SQLite database path (empty to keep state in memory only)")
+	sanitize := flag.String("sanitize", string(handlers.SanitizeStrip), "what to do with control and format characters in message content that can spoof its display: strip or reject")
+	idScheme := flag.String("id-scheme", string(db.IDUUIDv7), "how IDs for new rows are generated: uuidv7 (sortable by creation), uuidv4 or sequence")
+	createDirs := flag.Bool("create-dirs", false, "create the -db file's parent directories if they don't exist")
+	debugSQL := flag.Bool("debug-sql", false, "log each SQL statement's duration and add a Server-Timing header to REST responses")
+	defaultChannel := flag.String("default-channel", "general", "channel to create when the database has none (empty to disable)")
+	flag.Parse()
+
+	if !strings.HasPrefix(cfg.WSPath, "/") {
+		log.Fatal("-ws-path must start with /")
+	}
+
+	if cfg.AccessLogSampleRate < 0 || cfg.AccessLogSampleRate > 1 {
+		log.Fatal("-access-log-sample must be between 0 and 1")
+	}
+	cfg.AccessLogExclude = nil
+	for _, path := range strings.Split(*accessLogExclude, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			cfg.AccessLogExclude = append(cfg.AccessLogExclude, path)
+		}
+	}
+
+	var err error
+	if cfg.Sanitize, err = handlers.ParseSanitizeMode(*sanitize); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.TrustedProxies, err = handlers.ParseCIDRs(*trustedProxies); err != nil {
+		log.Fatal(err)
+	}
+	if *botTokens != "" {
+		if cfg.BotTokens, err = handlers.LoadBotTokens(*botTokens); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *dbPath != "" {
+		if err := cfg.FitMessageLengthToDB(); err != nil {
+			log.Fatalf("-max-message-length: %v", err)
+		}
+	}
+
+	hub := handlers.NewHub()
+	api := handlers.NewAPI(cfg, hub)
+	ws := handlers.NewWSHandler(cfg, hub)
+
+	if *debugSQL {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	var database *db.DB
+	if *dbPath != "" {
+		opts := db.DefaultOptions()
+		opts.TimeQueries = *debugSQL
+		opts.CreateDirs = *createDirs
+		if opts.IDScheme, err = db.ParseIDScheme(*idScheme); err != nil {
+			log.Fatal(err)
+		}
+		database, err = db.InitDBWithOptions(*dbPath, opts)
+		if errors.Is(err, db.ErrDirNotFound) {
+			log.Fatalf("%v (pass -create-dirs to create it)", err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer database.Close()
+
+		if err := api.Persist(database); err != nil {
+			log.Fatal(err)
+		}
+		if !cfg.Maintenance {
+			if err := api.EnsureDefaultChannel(*defaultChannel); err != nil {
+				log.Fatal(err)
+			}
+		}
+		ws.ValidateChannels(database)
+	}
 
 	mux := http.NewServeMux()
 	api.RegisterRoutes(mux)
 	ws.RegisterRoutes(mux)
 
-	log.Println("SlackLite server starting on :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatal(err)
+	var handler http.Handler = mux
+	if cfg.Maintenance {
+		handler = handlers.RejectWrites(handler)
+	}
+	if cfg.Compression {
+		handler = handlers.Gzip(handler)
+	}
+	if *debugSQL && database != nil {
+		handler = handlers.ServerTiming(handler, database)
+	}
+	if cfg.AccessLogSampleRate > 0 {
+		handler = handlers.AccessLog(handler, cfg)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go hub.RunReaper(ctx, cfg.PingInterval)
+
+	srv := &http.Server{Addr: ":8080", Handler: handler}
+	go func() {
+		log.Println("SlackLite server starting on :8080")
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("SlackLite server shutting down")
+	// Open WebSocket connections keep receiving what in-flight requests
+	// broadcast, but no new ones are accepted
+	hub.BeginDrain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
 	}
+	// Shutdown leaves WebSocket connections alone, so close them explicitly
+	// once their queued frames are out
+	hub.Drain(cfg.WSDrain)
 }
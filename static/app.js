@@ -9,7 +9,9 @@
         channels: [],
         currentChannel: null,
         messages: [],
-        ws: null
+        ws: null,
+        wsPath: '/ws',
+        reconnectAfter: null
     };
 
     // DOM Elements
@@ -40,6 +42,12 @@
     const api = {
         baseUrl: '/api',
 
+        async getConfig() {
+            const res = await fetch(`${this.baseUrl}/config`);
+            if (!res.ok) throw new Error('Failed to fetch config');
+            return res.json();
+        },
+
         async getChannels() {
             const res = await fetch(`${this.baseUrl}/channels`);
             if (!res.ok) throw new Error('Failed to fetch channels');
@@ -79,7 +87,7 @@
     // WebSocket connection
     function connectWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/ws`;
+        const wsUrl = `${protocol}//${window.location.host}${state.wsPath}?batch=true`;
 
         state.ws = new WebSocket(wsUrl);
 
@@ -96,9 +104,12 @@
             }
         };
 
-        state.ws.onclose = () => {
-            console.log('WebSocket disconnected, reconnecting in 3s...');
-            setTimeout(connectWebSocket, 3000);
+        state.ws.onclose = (event) => {
+            const reason = event.reason ? `: ${event.reason}` : '';
+            const delay = state.reconnectAfter || 3000;
+            state.reconnectAfter = null;
+            console.log(`WebSocket disconnected (${event.code}${reason}), reconnecting in ${delay}ms...`);
+            setTimeout(connectWebSocket, delay);
         };
 
         state.ws.onerror = (error) => {
@@ -108,6 +119,9 @@
 
     function handleWebSocketMessage(data) {
         switch (data.type) {
+            case 'batch':
+                data.messages.forEach(handleWebSocketMessage);
+                break;
             case 'message':
                 if (data.channel_id === state.currentChannel?.id) {
                     state.messages.push(data.message);
@@ -115,6 +129,18 @@
                     scrollToBottom();
                 }
                 break;
+            case 'message_unfurled': {
+                const msg = state.messages.find(m => m.id === data.message_id);
+                if (msg) {
+                    msg.unfurl = data.unfurl;
+                    renderMessages();
+                }
+                break;
+            }
+            case 'reconnect':
+                // The server is about to close the connection and says when to come back
+                state.reconnectAfter = data.after_ms;
+                break;
             case 'channel_created':
                 state.channels.push(data.channel);
                 renderChannels();
@@ -135,7 +161,7 @@
 
     function createMessageElement(msg) {
         const div = document.createElement('div');
-        div.className = 'message';
+        div.className = msg.subtype ? `message message-${msg.subtype}` : 'message';
 
         const avatar = document.createElement('div');
         avatar.className = 'message-avatar';
@@ -156,6 +182,12 @@
         time.textContent = formatTime(msg.created_at);
 
         header.appendChild(author);
+        if (msg.is_bot) {
+            const badge = document.createElement('span');
+            badge.className = 'message-bot-badge';
+            badge.textContent = 'BOT';
+            header.appendChild(badge);
+        }
         header.appendChild(time);
 
         const text = document.createElement('div');
@@ -164,6 +196,9 @@
 
         content.appendChild(header);
         content.appendChild(text);
+        if (msg.unfurl) {
+            content.appendChild(createUnfurlCard(msg.unfurl));
+        }
 
         div.appendChild(avatar);
         div.appendChild(content);
@@ -171,6 +206,28 @@
         return div;
     }
 
+    function createUnfurlCard(unfurl) {
+        const card = document.createElement('a');
+        card.className = 'unfurl-card';
+        card.href = unfurl.url;
+        card.target = '_blank';
+        card.rel = 'noopener noreferrer';
+
+        const title = document.createElement('div');
+        title.className = 'unfurl-title';
+        title.textContent = unfurl.title;
+        card.appendChild(title);
+
+        if (unfurl.description) {
+            const description = document.createElement('div');
+            description.className = 'unfurl-description';
+            description.textContent = unfurl.description;
+            card.appendChild(description);
+        }
+
+        return card;
+    }
+
     function createEmptyState(channelName) {
         const div = document.createElement('div');
         div.className = 'empty-state';
@@ -315,6 +372,18 @@
             if (e.key === 'Escape') hideModal();
         });
 
+        // The WebSocket path is configurable on the server
+        try {
+            const config = await api.getConfig();
+            if (config.ws_path) state.wsPath = config.ws_path;
+            if (config.read_only) {
+                elements.messageInput.disabled = true;
+                elements.messageInput.placeholder = 'Read-only during maintenance';
+            }
+        } catch (e) {
+            console.error('Failed to load config:', e);
+        }
+
         // Load channels
         try {
             state.channels = await api.getChannels();